@@ -0,0 +1,371 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/logger"
+	"github.com/chen102/ggbond/conn/ratelimit"
+	"github.com/chen102/ggbond/conn/trace"
+)
+
+// PING 服务端心跳路由
+const PING = 1
+
+var (
+	ErrorClient       = errors.New("client error")
+	ErrorClosed       = errors.New("client closed")
+	ErrorDisconnected = errors.New("client disconnected")
+	ErrorRateLimited  = errors.New("request rate limited")
+)
+
+// Handler 推送消息回调，在读协程中执行，不应阻塞
+type Handler func(msg connect.IMessage)
+
+// 请求按路由ID与消息ID关联回复，服务端回复时回传请求的消息ID
+type pendingKey struct {
+	routeid int32
+	msgid   int32
+}
+
+// Client 客户端
+// 维持一条到服务端的连接，断线后按指数退避自动重连，被踢下线时不重连，
+// 断线时未完成的请求立即返回ErrorDisconnected，收到断开通知时错误中包含*connect.CloseError
+// 服务端读超时(默认6秒)内收不到消息即断开连接，心跳间隔须小于服务端读超时，默认3秒
+type Client struct {
+	addr         string
+	heartbeat    time.Duration
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	reconnect    bool
+	onConnect    func(c *Client)
+	onClose      func(c *Client, ce *connect.CloseError)
+	logger       *slog.Logger
+	tracer       *trace.Tracer
+
+	wmu      sync.Mutex //串行写入，与mu分开，写阻塞时不影响读协程与请求登记
+	mu       sync.Mutex
+	conn     net.Conn
+	writer   *bufio.Writer
+	pending  map[pendingKey]chan connect.IMessage
+	handlers sync.Map //路由ID -> Handler
+	msgid    int32
+	lastrecv int64
+	closeerr *connect.CloseError //最近一次断线时服务端的断开通知
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// Dial 连接服务端，首次连接失败直接返回错误
+// addr:服务端地址 ip:port
+func Dial(addr string, opt ...ClientOption) (*Client, error) {
+	var options clientoptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			return nil, fmt.Errorf("%w: apply option error:%w", ErrorClient, err)
+		}
+	}
+	c := &Client{
+		addr:         addr,
+		heartbeat:    3 * time.Second,
+		dialTimeout:  3 * time.Second,
+		writeTimeout: 3 * time.Second,
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   10 * time.Second,
+		reconnect:    !options.noReconnect,
+		onConnect:    options.onConnect,
+		onClose:      options.onClose,
+		logger:       logger.L(),
+		tracer:       options.tracer,
+		pending:      make(map[pendingKey]chan connect.IMessage),
+		closed:       make(chan struct{}),
+	}
+	if options.logger != nil {
+		c.logger = options.logger
+	}
+	if options.heartbeat != nil {
+		c.heartbeat = *options.heartbeat
+	}
+	if options.dialTimeout != nil {
+		c.dialTimeout = *options.dialTimeout
+	}
+	if options.writeTimeout != nil {
+		c.writeTimeout = *options.writeTimeout
+	}
+	if options.minBackoff != nil {
+		c.minBackoff, c.maxBackoff = *options.minBackoff, *options.maxBackoff
+	}
+	conn, err := net.DialTimeout("tcp", addr, c.dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorClient, err)
+	}
+	c.attach(conn)
+	go c.run(conn)
+	go c.keepalive()
+	return c, nil
+}
+
+// Handle 注册推送消息回调，同一路由重复注册时覆盖
+func (c *Client) Handle(routeid int32, h Handler) {
+	c.handlers.Store(routeid, h)
+}
+
+// Send 发送消息，不等待回复
+func (c *Client) Send(routeid int32, body []byte) error {
+	return c.write(routeid, atomic.AddInt32(&c.msgid, 1), body, nil)
+}
+
+// Request 发送请求并等待服务端回复，断线或ctx结束时返回错误，被服务端限流时返回ErrorRateLimited
+func (c *Client) Request(ctx context.Context, routeid int32, body []byte) (msg connect.IMessage, err error) {
+	key := pendingKey{routeid, atomic.AddInt32(&c.msgid, 1)}
+	if c.tracer != nil {
+		var span *trace.Span
+		ctx, span = c.tracer.Start(ctx, "client.request", trace.Int64("route", int64(routeid)), trace.Int64("msgid", int64(key.msgid)))
+		span.SetKind(trace.SpanKindClient)
+		defer func() {
+			span.SetError(err)
+			span.End()
+		}()
+	}
+	reply := make(chan connect.IMessage, 1)
+	c.mu.Lock()
+	c.pending[key] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, key)
+		c.mu.Unlock()
+	}()
+	if err := c.write(routeid, key.msgid, body, trace.SpanContextFromContext(ctx).Encode()); err != nil {
+		return nil, err
+	}
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			if ce := c.Disconnect(); ce != nil {
+				return nil, fmt.Errorf("%w: %w: %w", ErrorClient, ErrorDisconnected, ce)
+			}
+			return nil, fmt.Errorf("%w: %w", ErrorClient, ErrorDisconnected)
+		}
+		if msg.RouteID() == ratelimit.RATELIMITED {
+			_, scope, _ := ratelimit.ParseReply(msg.Body())
+			return nil, fmt.Errorf("%w: %w: %s", ErrorClient, ErrorRateLimited, scope)
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %w", ErrorClient, ctx.Err())
+	case <-c.closed:
+		return nil, fmt.Errorf("%w: %w", ErrorClient, ErrorClosed)
+	}
+}
+
+// Disconnect 最近一次断线时服务端的断开通知，断线前未收到通知时为nil
+func (c *Client) Disconnect() *connect.CloseError {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeerr
+}
+
+// Connected 当前是否已连接
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// Close 关闭客户端，不再重连
+func (c *Client) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.mu.Unlock()
+	})
+	return nil
+}
+
+// tracectx:编码后的链路上下文，为nil时不携带
+func (c *Client) write(routeid, msgid int32, body []byte, tracectx []byte) error {
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write(body, msgid, routeid); err != nil {
+		return fmt.Errorf("%w: %w", ErrorClient, err)
+	}
+	if err := msg.SetTraceContext(tracectx); err != nil {
+		return fmt.Errorf("%w: %w", ErrorClient, err)
+	}
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		return fmt.Errorf("%w: %w", ErrorClient, ErrorClosed)
+	default:
+	}
+	conn, writer := c.conn, c.writer
+	c.mu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("%w: %w", ErrorClient, ErrorDisconnected)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	//服务端不读时写操作最多阻塞writeTimeout
+	_ = conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	if err := msg.PackAndWrite(writer); err != nil {
+		//写失败时关闭连接，由读协程触发重连
+		conn.Close()
+		return fmt.Errorf("%w: %w", ErrorClient, err)
+	}
+	return nil
+}
+
+// 连接断开后按指数退避重连
+func (c *Client) run(conn net.Conn) {
+	backoff := c.minBackoff
+	for {
+		if ce := c.serve(conn); !c.reconnect || (ce != nil && ce.Reason == connect.CloseKicked) {
+			c.Close()
+			return
+		}
+		for {
+			select {
+			case <-c.closed:
+				return
+			case <-time.After(backoff):
+			}
+			var err error
+			conn, err = net.DialTimeout("tcp", c.addr, c.dialTimeout)
+			if err == nil {
+				backoff = c.minBackoff
+				if !c.attach(conn) {
+					return
+				}
+				break
+			}
+			if backoff *= 2; backoff > c.maxBackoff {
+				backoff = c.maxBackoff
+			}
+		}
+	}
+}
+
+// 设置当前连接，客户端已关闭时返回false
+func (c *Client) attach(conn net.Conn) bool {
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		conn.Close()
+		return false
+	default:
+	}
+	c.conn = conn
+	c.writer = bufio.NewWriter(conn)
+	c.mu.Unlock()
+	atomic.StoreInt64(&c.lastrecv, time.Now().UnixNano())
+	if c.onConnect != nil {
+		go c.onConnect(c)
+	}
+	return true
+}
+
+// 读取直到断线，返回服务端的断开通知
+func (c *Client) serve(conn net.Conn) (ce *connect.CloseError) {
+	defer func() {
+		conn.Close()
+		c.mu.Lock()
+		c.conn, c.writer = nil, nil
+		c.closeerr = ce
+		//断线时结束未完成的请求
+		for key, reply := range c.pending {
+			close(reply)
+			delete(c.pending, key)
+		}
+		c.mu.Unlock()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		msg := connect.NewMessage("tcp")
+		if err := msg.ReadAndUnpack(reader); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				c.logger.Warn("client read error", "addr", c.addr, "error", err)
+			}
+			return
+		}
+		atomic.StoreInt64(&c.lastrecv, time.Now().UnixNano())
+		if msg.RouteID() == connect.DISCONNECT {
+			reason, text, err := connect.ParseDisconnect(msg.Body())
+			if err != nil {
+				c.logger.Warn("client disconnect frame error", "addr", c.addr, "error", err)
+				continue
+			}
+			ce = connect.NewCloseError(reason, text, nil)
+			c.logger.Info("disconnected by server", "addr", c.addr, "reason", reason.String(), "message", text)
+			if c.onClose != nil {
+				c.onClose(c, ce)
+			}
+			return ce
+		}
+		c.dispatch(msg)
+	}
+}
+
+func (c *Client) dispatch(msg connect.IMessage) {
+	key := pendingKey{msg.RouteID(), msg.MessageID()}
+	if msg.RouteID() == ratelimit.RATELIMITED {
+		//超限回复按被限流的请求关联
+		if routeid, _, err := ratelimit.ParseReply(msg.Body()); err == nil {
+			key.routeid = routeid
+		}
+	}
+	c.mu.Lock()
+	reply, ok := c.pending[key]
+	if ok {
+		delete(c.pending, key)
+	}
+	c.mu.Unlock()
+	if ok {
+		reply <- msg
+		return
+	}
+	if h, ok := c.handlers.Load(msg.RouteID()); ok {
+		h.(Handler)(msg)
+	}
+}
+
+// 定时发送心跳，3个周期收不到任何消息时断开连接触发重连
+func (c *Client) keepalive() {
+	ticker := time.NewTicker(c.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+		if !c.Connected() {
+			continue
+		}
+		last := time.Unix(0, atomic.LoadInt64(&c.lastrecv))
+		if time.Since(last) > 3*c.heartbeat {
+			c.mu.Lock()
+			if c.conn != nil {
+				c.conn.Close()
+			}
+			c.mu.Unlock()
+			continue
+		}
+		_ = c.Send(PING, nil)
+	}
+}
@@ -0,0 +1,259 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/routermanage"
+	"github.com/chen102/ggbond/conn/server"
+	"github.com/chen102/ggbond/conn/store"
+)
+
+const (
+	ECHO   = 10 //延迟消息体中的毫秒数后原样回复，回复顺序与请求顺序无关
+	NOTIFY = 20 //先以相同消息ID推送PUSH，再回复
+	PUSH   = 21
+)
+
+type testServer struct {
+	*server.TCPServer
+	connmanager server.ITCPConnManage
+	addr        string
+}
+
+// 启动监听在port上的服务器，port为0时使用随机端口
+func startTestServer(t *testing.T, port int64) *testServer {
+	t.Helper()
+	connmanager := server.NewConnManage("tcp", store.NewTCPShardMap(8), connect.NopHook{})
+	router := server.NewRouterManage("router", store.NewSyncMap[routermanage.RouterHandle]())
+	reply := func(connid int64, msgid, routeid int32, body []byte) error {
+		conn, err := connmanager.FindConn(connid)
+		if err != nil {
+			return err
+		}
+		msg := connect.NewMessage("tcp")
+		if err := msg.Write(body, msgid, routeid); err != nil {
+			return err
+		}
+		return conn.SendMessage(msg)
+	}
+	if err := router.RegisterRoute(ECHO, func(msgid int32, connid int64, parameter []byte) error {
+		delay, err := strconv.Atoi(string(parameter))
+		if err != nil {
+			return err
+		}
+		time.AfterFunc(time.Duration(delay)*time.Millisecond, func() { _ = reply(connid, msgid, ECHO, parameter) })
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.RegisterRoute(NOTIFY, func(msgid int32, connid int64, parameter []byte) error {
+		if err := reply(connid, msgid, PUSH, []byte("push")); err != nil {
+			return err
+		}
+		return reply(connid, msgid, NOTIFY, []byte("reply"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s := server.NewTCPServer(connmanager, router, server.WithPort(port))
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{TCPServer: s, connmanager: connmanager, addr: s.Listeners()[0].Addr}
+	t.Cleanup(func() { ts.stop(connect.CloseServerStop) })
+	return ts
+}
+
+// 停止服务器并以reason断开全部连接，可重复调用
+func (s *testServer) stop(reason connect.CloseReason) {
+	if s.TCPServer == nil {
+		return
+	}
+	_ = s.Stop()
+	s.closeAll(reason)
+	s.TCPServer = nil
+}
+
+func (s *testServer) closeAll(reason connect.CloseReason) {
+	for _, conn := range s.connmanager.AllConn() {
+		_ = s.connmanager.RemoveConn(conn, connect.NewCloseError(reason, "test", nil))
+	}
+}
+
+func (s *testServer) port(t *testing.T) int64 {
+	t.Helper()
+	_, port, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.ParseInt(port, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func dialTest(t *testing.T, addr string, opt ...ClientOption) *Client {
+	t.Helper()
+	c, err := Dial(addr, append([]ClientOption{WithBackoff(10*time.Millisecond, 50*time.Millisecond)}, opt...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRequestMatchesReply(t *testing.T) {
+	s := startTestServer(t, 0)
+	c := dialTest(t, s.addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	//先发的请求后回复，按消息ID关联
+	type result struct {
+		body string
+		err  error
+	}
+	results := make([]chan result, 3)
+	for i, delay := range []string{"200", "100", "0"} {
+		results[i] = make(chan result, 1)
+		go func(ch chan result, delay string) {
+			msg, err := c.Request(ctx, ECHO, []byte(delay))
+			if err != nil {
+				ch <- result{"", err}
+				return
+			}
+			ch <- result{string(msg.Body()), nil}
+		}(results[i], delay)
+	}
+	for i, want := range []string{"200", "100", "0"} {
+		if r := <-results[i]; r.err != nil || r.body != want {
+			t.Fatalf("request %d got %q %v, want %q", i, r.body, r.err, want)
+		}
+	}
+
+	//相同消息ID的其他路由消息不作为回复，交给推送回调
+	pushes := make(chan int32, 1)
+	c.Handle(PUSH, func(msg connect.IMessage) { pushes <- msg.MessageID() })
+	msg, err := c.Request(ctx, NOTIFY, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.RouteID() != NOTIFY || string(msg.Body()) != "reply" {
+		t.Fatalf("reply route %d body %q", msg.RouteID(), msg.Body())
+	}
+	select {
+	case msgid := <-pushes:
+		if msgid != msg.MessageID() {
+			t.Fatalf("push msgid %d, reply msgid %d", msgid, msg.MessageID())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for push")
+	}
+}
+
+func TestReconnectAfterServerStop(t *testing.T) {
+	s := startTestServer(t, 0)
+	var connects int32
+	var disconnect atomic.Value
+	c := dialTest(t, s.addr,
+		WithOnConnect(func(*Client) { atomic.AddInt32(&connects, 1) }),
+		WithOnDisconnect(func(_ *Client, ce *connect.CloseError) { disconnect.Store(ce.Reason) }))
+	waitFor(t, "first connect", func() bool { return atomic.LoadInt32(&connects) == 1 })
+
+	//未完成的请求在断线时立即返回
+	pending := make(chan error, 1)
+	go func() {
+		_, err := c.Request(context.Background(), ECHO, []byte("5000"))
+		pending <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	port := s.port(t)
+	s.stop(connect.CloseServerStop)
+	select {
+	case err := <-pending:
+		if !errors.Is(err, ErrorDisconnected) {
+			t.Fatalf("pending request: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending request not released")
+	}
+	waitFor(t, "disconnect notice", func() bool { return disconnect.Load() == connect.CloseServerStop })
+	if ce := c.Disconnect(); ce == nil || ce.Reason != connect.CloseServerStop {
+		t.Fatalf("disconnect %v", ce)
+	}
+
+	//服务器在同一端口重启后自动重连
+	restarted := startTestServer(t, port)
+	waitFor(t, "reconnect", func() bool { return atomic.LoadInt32(&connects) == 2 && c.Connected() })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if msg, err := c.Request(ctx, ECHO, []byte("0")); err != nil || string(msg.Body()) != "0" {
+		t.Fatalf("request after reconnect: %v", err)
+	}
+	if n := len(restarted.connmanager.AllConn()); n != 1 {
+		t.Fatalf("restarted server has %d conns", n)
+	}
+}
+
+func TestNoReconnectAfterKick(t *testing.T) {
+	s := startTestServer(t, 0)
+	var connects int32
+	c := dialTest(t, s.addr, WithOnConnect(func(*Client) { atomic.AddInt32(&connects, 1) }))
+	waitFor(t, "server conn", func() bool { return len(s.connmanager.AllConn()) == 1 })
+	s.closeAll(connect.CloseKicked)
+	select {
+	case <-c.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client not closed after kick")
+	}
+	if ce := c.Disconnect(); ce == nil || ce.Reason != connect.CloseKicked {
+		t.Fatalf("disconnect %v", ce)
+	}
+	//超过多个退避周期仍未重连
+	time.Sleep(200 * time.Millisecond)
+	if n := len(s.connmanager.AllConn()); n != 0 || atomic.LoadInt32(&connects) != 1 {
+		t.Fatalf("reconnected after kick: %d server conns, %d connects", n, atomic.LoadInt32(&connects))
+	}
+	if _, err := c.Request(context.Background(), ECHO, []byte("0")); !errors.Is(err, ErrorClosed) {
+		t.Fatalf("request after kick: %v", err)
+	}
+}
+
+func TestKeepaliveTimeout(t *testing.T) {
+	//服务器未注册PING路由，心跳收不到回复
+	s := startTestServer(t, 0)
+	var connects int32
+	c := dialTest(t, s.addr, WithHeartbeat(30*time.Millisecond), WithOnConnect(func(*Client) { atomic.AddInt32(&connects, 1) }))
+	waitFor(t, "server conn", func() bool { return len(s.connmanager.AllConn()) == 1 })
+	var first int64
+	for id := range s.connmanager.AllConn() {
+		first = id
+	}
+	//3个心跳周期收不到消息时断开并重连
+	waitFor(t, "keepalive reconnect", func() bool { return atomic.LoadInt32(&connects) >= 2 })
+	waitFor(t, "old server conn closed", func() bool {
+		_, err := s.connmanager.FindConn(first)
+		return err != nil
+	})
+	if c.Disconnect() != nil {
+		t.Fatalf("keepalive timeout reported a server notice %v", c.Disconnect())
+	}
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/trace"
+)
+
+// ClientOption 客户端选项
+type ClientOption func(options *clientoptions) error
+type clientoptions struct {
+	heartbeat    *time.Duration
+	dialTimeout  *time.Duration
+	writeTimeout *time.Duration
+	minBackoff   *time.Duration
+	maxBackoff   *time.Duration
+	noReconnect  bool
+	onConnect    func(c *Client)
+	onClose      func(c *Client, ce *connect.CloseError)
+	logger       *slog.Logger
+	tracer       *trace.Tracer
+}
+
+// heartbeat:心跳间隔，经PING路由发送，3个周期收不到任何消息视为断线
+// 须小于服务端的读超时(connmanage.WithReadTimeout，默认6秒)，否则空闲连接会被服务端断开
+func WithHeartbeat(heartbeat time.Duration) ClientOption {
+	return func(options *clientoptions) error {
+		if heartbeat <= 0 {
+			return errors.New("heartbeat is not valid")
+		}
+		options.heartbeat = &heartbeat
+		return nil
+	}
+}
+
+// dialTimeout:连接超时时间
+func WithDialTimeout(dialTimeout time.Duration) ClientOption {
+	return func(options *clientoptions) error {
+		if dialTimeout <= 0 {
+			return errors.New("dialTimeout is not valid")
+		}
+		options.dialTimeout = &dialTimeout
+		return nil
+	}
+}
+
+// writeTimeout:单次写入超时时间，超时后断开连接并重连
+func WithWriteTimeout(writeTimeout time.Duration) ClientOption {
+	return func(options *clientoptions) error {
+		if writeTimeout <= 0 {
+			return errors.New("writeTimeout is not valid")
+		}
+		options.writeTimeout = &writeTimeout
+		return nil
+	}
+}
+
+// min,max:断线重连的退避时间范围，每次失败翻倍
+func WithBackoff(min, max time.Duration) ClientOption {
+	return func(options *clientoptions) error {
+		if min <= 0 || max < min {
+			return errors.New("backoff is not valid")
+		}
+		options.minBackoff = &min
+		options.maxBackoff = &max
+		return nil
+	}
+}
+
+// 断线后不重连，客户端直接关闭
+func WithoutReconnect() ClientOption {
+	return func(options *clientoptions) error {
+		options.noReconnect = true
+		return nil
+	}
+}
+
+// onConnect:每次连接(包括重连)成功后调用，例如恢复会话
+func WithOnConnect(onConnect func(c *Client)) ClientOption {
+	return func(options *clientoptions) error {
+		options.onConnect = onConnect
+		return nil
+	}
+}
+
+// onClose:收到服务端断开通知时调用，ce为关闭原因与说明
+func WithOnDisconnect(onClose func(c *Client, ce *connect.CloseError)) ClientOption {
+	return func(options *clientoptions) error {
+		options.onClose = onClose
+		return nil
+	}
+}
+
+// logger:客户端日志，默认为库日志
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(options *clientoptions) error {
+		if logger == nil {
+			return errors.New("logger is nil")
+		}
+		options.logger = logger
+		return nil
+	}
+}
+
+// tracer:为每个请求创建client.request跨度，并经帧头把链路上下文传给服务端
+// 未设置时，ctx中带有跨度的请求仍会传递其链路上下文
+func WithTracer(tracer *trace.Tracer) ClientOption {
+	return func(options *clientoptions) error {
+		if tracer == nil {
+			return errors.New("tracer is nil")
+		}
+		options.tracer = tracer
+		return nil
+	}
+}
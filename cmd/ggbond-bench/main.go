@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chen102/ggbond/client"
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/service/bench"
+)
+
+var (
+	addr     = flag.String("addr", "127.0.0.1:8089", "服务端地址")
+	clients  = flag.Int("clients", 100, "模拟客户端数")
+	duration = flag.Duration("duration", 10*time.Second, "压测时长")
+	rate     = flag.Float64("rate", 0, "每个客户端每秒请求数，0为收到回复后立即发送下一个")
+	mix      = flag.String("mix", "ping=1", "路由比例，格式 ping=N,echo=N,broadcast=N")
+	size     = flag.Int("size", 64, "echo、broadcast消息体字节数")
+	timeout  = flag.Duration("timeout", 5*time.Second, "单个请求超时时间")
+	ramp     = flag.Duration("ramp", time.Second, "全部客户端建立连接的时间")
+	metrics  = flag.String("metrics", "", "服务端指标地址，例如 http://127.0.0.1:9100/metrics，设置后报告压测期间服务端丢弃的消息数")
+)
+
+// 服务端发送队列满丢弃消息的计数器
+const droppedMetric = "ggbond_send_dropped_total"
+
+// 请求类型
+type kind struct {
+	name   string
+	route  int32
+	weight int
+	body   bool
+}
+
+// 单个客户端的统计，压测结束后合并
+type stats struct {
+	latency  map[string][]time.Duration
+	errors   map[string]int
+	timeouts map[string]int
+}
+
+func newStats() *stats {
+	return &stats{
+		latency:  make(map[string][]time.Duration),
+		errors:   make(map[string]int),
+		timeouts: make(map[string]int),
+	}
+}
+
+func main() {
+	flag.Parse()
+	kinds, err := parseMix(*mix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	var (
+		wg          sync.WaitGroup
+		mu          sync.Mutex
+		total       = newStats()
+		connerrors  int64
+		disconnects int64
+		pushes      int64
+		connected   int64
+	)
+	var dropped float64
+	if *metrics != "" {
+		if dropped, err = scrape(*metrics, droppedMetric); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	payload := make([]byte, *size)
+	rand.Read(payload)
+	start := time.Now()
+	deadline := start.Add(*ramp + *duration)
+	for i := 0; i < *clients; i++ {
+		wg.Add(1)
+		delay := time.Duration(0)
+		if *clients > 1 {
+			delay = *ramp * time.Duration(i) / time.Duration(*clients)
+		}
+		go func(delay time.Duration) {
+			defer wg.Done()
+			time.Sleep(delay)
+			c, err := client.Dial(*addr, client.WithoutReconnect())
+			if err != nil {
+				atomic.AddInt64(&connerrors, 1)
+				return
+			}
+			defer c.Close()
+			atomic.AddInt64(&connected, 1)
+			//广播推送与请求回复使用不同路由，只统计推送
+			c.Handle(bench.BROADCASTPUSH, func(msg connect.IMessage) {
+				atomic.AddInt64(&pushes, 1)
+			})
+			st := run(c, kinds, payload, deadline)
+			if !c.Connected() {
+				atomic.AddInt64(&disconnects, 1)
+			}
+			mu.Lock()
+			for k, v := range st.latency {
+				total.latency[k] = append(total.latency[k], v...)
+			}
+			for k, v := range st.errors {
+				total.errors[k] += v
+			}
+			for k, v := range st.timeouts {
+				total.timeouts[k] += v
+			}
+			mu.Unlock()
+		}(delay)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	fmt.Printf("addr %s clients %d connected %d duration %s\n", *addr, *clients, connected, elapsed.Round(time.Millisecond))
+	fmt.Printf("connection errors %d disconnects %d broadcast pushes %d\n", connerrors, disconnects, pushes)
+	if *metrics != "" {
+		after, err := scrape(*metrics, droppedMetric)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			fmt.Printf("server dropped %.0f\n", after-dropped)
+		}
+	}
+	report(kinds, total, *duration)
+	if connerrors > 0 || disconnects > 0 {
+		os.Exit(1)
+	}
+}
+
+// 单个客户端压测循环，rate为0时收到回复立即发送下一个请求
+func run(c *client.Client, kinds []kind, payload []byte, deadline time.Time) *stats {
+	st := newStats()
+	var interval time.Duration
+	if *rate > 0 {
+		interval = time.Duration(float64(time.Second) / *rate)
+	}
+	totalweight := 0
+	for _, k := range kinds {
+		totalweight += k.weight
+	}
+	next := time.Now()
+	for time.Now().Before(deadline) {
+		if interval > 0 {
+			if wait := time.Until(next); wait > 0 {
+				time.Sleep(wait)
+			}
+			next = next.Add(interval)
+		}
+		k := pick(kinds, totalweight)
+		var body []byte
+		if k.body {
+			body = payload
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		begin := time.Now()
+		_, err := c.Request(ctx, k.route, body)
+		cancel()
+		switch {
+		case err == nil:
+			st.latency[k.name] = append(st.latency[k.name], time.Since(begin))
+		case errors.Is(err, context.DeadlineExceeded):
+			st.timeouts[k.name]++
+		default:
+			st.errors[k.name]++
+			if !c.Connected() {
+				return st
+			}
+		}
+	}
+	return st
+}
+
+func pick(kinds []kind, totalweight int) kind {
+	n := rand.Intn(totalweight)
+	for _, k := range kinds {
+		if n < k.weight {
+			return k
+		}
+		n -= k.weight
+	}
+	return kinds[len(kinds)-1]
+}
+
+func parseMix(mix string) ([]kind, error) {
+	known := map[string]kind{
+		"ping":      {name: "ping", route: client.PING},
+		"echo":      {name: "echo", route: bench.ECHO, body: true},
+		"broadcast": {name: "broadcast", route: bench.BROADCAST, body: true},
+	}
+	var kinds []kind
+	for _, item := range strings.Split(mix, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			weight = "1"
+		}
+		k, exists := known[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown route %q in mix", name)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("weight of %q is not valid", name)
+		}
+		if w == 0 {
+			continue
+		}
+		k.weight = w
+		kinds = append(kinds, k)
+	}
+	if len(kinds) == 0 {
+		return nil, errors.New("mix is empty")
+	}
+	return kinds, nil
+}
+
+func report(kinds []kind, st *stats, duration time.Duration) {
+	fmt.Printf("%-10s %10s %8s %8s %10s %10s %10s %10s %10s\n", "route", "ok", "errors", "timeouts", "req/s", "p50", "p90", "p99", "max")
+	for _, k := range kinds {
+		lat := st.latency[k.name]
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		fmt.Printf("%-10s %10d %8d %8d %10.0f %10s %10s %10s %10s\n", k.name, len(lat), st.errors[k.name], st.timeouts[k.name],
+			float64(len(lat))/duration.Seconds(), percentile(lat, 0.5), percentile(lat, 0.9), percentile(lat, 0.99), percentile(lat, 1))
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i].Round(time.Microsecond)
+}
+
+// 读取服务端指标中无标签的样本值
+func scrape(url, name string) (float64, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0, fmt.Errorf("scrape metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("scrape metrics: %s", resp.Status)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		metric, value, ok := strings.Cut(scanner.Text(), " ")
+		if ok && metric == name {
+			return strconv.ParseFloat(strings.TrimSpace(value), 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("scrape metrics: %w", err)
+	}
+	return 0, fmt.Errorf("scrape metrics: %s not found", name)
+}
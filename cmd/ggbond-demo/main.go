@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/chen102/ggbond/client"
+)
+
+var addr = flag.String("addr", "127.0.0.1:8089", "服务端地址")
+
+// 示例客户端：发送10次PING后请求主动断开
+func main() {
+	flag.Parse()
+	c, err := client.Dial(*addr, client.WithHeartbeat(5*time.Second))
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		reply, err := c.Request(ctx, client.PING, nil)
+		cancel()
+		if err != nil {
+			fmt.Println("ping error:", err)
+		} else {
+			fmt.Println(string(reply.Body()))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	reply, err := c.Request(ctx, 10, []byte("chenhao"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(reply.Body()))
+}
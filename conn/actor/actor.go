@@ -0,0 +1,116 @@
+package actor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/chen102/ggbond/conn/logger"
+)
+
+var (
+	ErrorActor         = errors.New("actor error")
+	ErrorActorExists   = errors.New("actor already exists")
+	ErrorActorNotFound = errors.New("actor not exists")
+	ErrorMailboxFull   = errors.New("actor mailbox full")
+	ErrorActorStopped  = errors.New("actor stopped")
+)
+
+// 常用实体类型
+const (
+	PLAYER = "player"
+	ROOM   = "room"
+	GUILD  = "guild"
+)
+
+// ActorID 实体标识
+type ActorID struct {
+	Kind string
+	ID   int64
+}
+
+func (id ActorID) String() string {
+	return fmt.Sprintf("%s:%d", id.Kind, id.ID)
+}
+
+// Actor 实体，拥有独立邮箱，投递的任务在实体协程中串行执行
+// 实体状态只在实体协程中访问，无需加锁
+type Actor struct {
+	id      ActorID
+	mailbox chan func()
+	stop    chan struct{}
+	once    sync.Once
+	state   interface{}
+}
+
+func newActor(id ActorID, mailboxsize int) *Actor {
+	a := &Actor{
+		id:      id,
+		mailbox: make(chan func(), mailboxsize),
+		stop:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// ID 实体标识
+func (a *Actor) ID() ActorID {
+	return a.id
+}
+
+// State 实体状态，只能在实体协程中调用
+func (a *Actor) State() interface{} {
+	return a.state
+}
+
+// SetState 设置实体状态，只能在实体协程中调用
+func (a *Actor) SetState(state interface{}) {
+	a.state = state
+}
+
+// Post 投递任务到邮箱，邮箱满时直接返回错误不阻塞调用方
+func (a *Actor) Post(f func()) error {
+	select {
+	case <-a.stop:
+		return fmt.Errorf("%w: %s", ErrorActorStopped, a.id)
+	default:
+	}
+	select {
+	case a.mailbox <- f:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrorMailboxFull, a.id)
+	}
+}
+
+func (a *Actor) run() {
+	for {
+		select {
+		case <-a.stop:
+			return
+		case f := <-a.mailbox:
+			//停止与任务同时就绪时select随机选择，执行前再检查一次，保证停止后不再执行邮箱中的任务
+			select {
+			case <-a.stop:
+				return
+			default:
+			}
+			a.exec(f)
+		}
+	}
+}
+
+func (a *Actor) exec(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L().Error("actor panic", "actor", a.id, "panic", r)
+		}
+	}()
+	f()
+}
+
+func (a *Actor) close() {
+	a.once.Do(func() {
+		close(a.stop)
+	})
+}
@@ -0,0 +1,186 @@
+package actor
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+)
+
+func waitDone(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for actor")
+	}
+}
+
+func TestActorMailboxOrder(t *testing.T) {
+	s := NewSystem(128)
+	a, err := s.Spawn(ActorID{Kind: PLAYER, ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	done := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		i := i
+		if err := a.Post(func() { got = append(got, i) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Post(func() { close(done) }); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, done)
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("task %d ran at %d", v, i)
+		}
+	}
+	if len(got) != 100 {
+		t.Fatalf("ran %d tasks", len(got))
+	}
+}
+
+func TestActorMailboxFull(t *testing.T) {
+	s := NewSystem(1)
+	a, _ := s.Spawn(ActorID{Kind: ROOM, ID: 1})
+	running, release := make(chan struct{}), make(chan struct{})
+	if err := a.Post(func() {
+		close(running)
+		<-release
+	}); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, running)
+	done := make(chan struct{})
+	if err := a.Post(func() { close(done) }); err != nil {
+		t.Fatal(err)
+	}
+	//邮箱满时不阻塞调用方
+	if err := a.Post(func() {}); !errors.Is(err, ErrorMailboxFull) {
+		t.Fatalf("post to full mailbox: %v", err)
+	}
+	close(release)
+	waitDone(t, done)
+}
+
+func TestActorStop(t *testing.T) {
+	s := NewSystem(8)
+	id := ActorID{Kind: ROOM, ID: 2}
+	a, _ := s.Spawn(id)
+	if _, err := s.Spawn(id); !errors.Is(err, ErrorActorExists) {
+		t.Fatalf("spawn twice: %v", err)
+	}
+	running, release := make(chan struct{}), make(chan struct{})
+	_ = a.Post(func() {
+		close(running)
+		<-release
+	})
+	waitDone(t, running)
+	var mu sync.Mutex
+	dropped := true
+	_ = a.Post(func() {
+		mu.Lock()
+		dropped = false
+		mu.Unlock()
+	})
+	if err := s.Stop(id); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := a.Post(func() {}); !errors.Is(err, ErrorActorStopped) {
+		t.Fatalf("post after stop: %v", err)
+	}
+	if _, err := s.Find(id); !errors.Is(err, ErrorActorNotFound) {
+		t.Fatalf("find after stop: %v", err)
+	}
+	if err := s.Stop(id); !errors.Is(err, ErrorActorNotFound) {
+		t.Fatalf("stop twice: %v", err)
+	}
+	//停止后邮箱中的任务被丢弃
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if !dropped {
+		t.Fatal("queued task ran after stop")
+	}
+}
+
+func TestActorPanicRecovered(t *testing.T) {
+	s := NewSystem(8)
+	a, _ := s.Spawn(ActorID{Kind: PLAYER, ID: 3})
+	done := make(chan struct{})
+	_ = a.Post(func() { panic("boom") })
+	_ = a.Post(func() { close(done) })
+	waitDone(t, done)
+}
+
+func TestSystemRoute(t *testing.T) {
+	s := NewSystem(8)
+	type call struct {
+		actor ActorID
+		msgid int32
+		body  string
+	}
+	calls := make(chan call, 1)
+	route := s.Route(ByConn(PLAYER), func(a *Actor, msgid int32, connid int64, parameter []byte) error {
+		//状态只在实体协程中访问
+		n, _ := a.State().(int)
+		a.SetState(n + 1)
+		calls <- call{a.ID(), msgid, string(parameter)}
+		return nil
+	})
+	if err := route(1, 5, nil); !errors.Is(err, ErrorActorNotFound) {
+		t.Fatalf("route to missing actor: %v", err)
+	}
+	if _, err := s.Spawn(ActorID{Kind: PLAYER, ID: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := route(7, 5, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-calls:
+		if c.actor != (ActorID{Kind: PLAYER, ID: 5}) || c.msgid != 7 || c.body != "hi" {
+			t.Fatalf("call %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for actor route")
+	}
+
+	resolveErr := errors.New("no target")
+	failed := s.Route(func(msgid int32, connid int64, parameter []byte) (ActorID, error) {
+		return ActorID{}, resolveErr
+	}, nil)
+	if err := failed(1, 1, nil); !errors.Is(err, resolveErr) || !errors.Is(err, ErrorActor) {
+		t.Fatalf("resolve error: %v", err)
+	}
+}
+
+func TestConnHook(t *testing.T) {
+	s := NewSystem(8)
+	h := s.ConnHook(PLAYER)
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	conn := connect.NewTCPConn(a, 9, "tcp")
+	if err := h.AfterConn(conn); err != nil {
+		t.Fatal(err)
+	}
+	id := ActorID{Kind: PLAYER, ID: 9}
+	if _, err := s.Find(id); err != nil {
+		t.Fatal(err)
+	}
+	h.(connect.CloseHook).OnClose(conn, connect.CloseNormal, nil)
+	if _, err := s.Find(id); !errors.Is(err, ErrorActorNotFound) {
+		t.Fatalf("actor after close: %v", err)
+	}
+	//连接被拒绝时实体未创建，关闭不报错
+	h.(connect.CloseHook).OnClose(conn, connect.CloseNormal, nil)
+}
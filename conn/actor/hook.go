@@ -0,0 +1,33 @@
+package actor
+
+import (
+	"errors"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/logger"
+)
+
+// ConnHook 连接钩子，连接建立后创建以连接ID为实体ID的实体，连接关闭时停止该实体
+// kind:实体类型，与ByConn使用的类型一致
+func (s *System) ConnHook(kind string) connect.Hook {
+	return connHook{s: s, kind: kind}
+}
+
+type connHook struct {
+	connect.NopHook
+	s    *System
+	kind string
+}
+
+func (h connHook) AfterConn(conn connect.ITCPConn) error {
+	_, err := h.s.Spawn(ActorID{Kind: h.kind, ID: conn.ConnID()})
+	return err
+}
+
+// 连接被拒绝时实体可能未创建，忽略不存在的实体
+func (h connHook) OnClose(conn connect.ITCPConn, reason connect.CloseReason, err error) {
+	id := ActorID{Kind: h.kind, ID: conn.ConnID()}
+	if e := h.s.Stop(id); e != nil && !errors.Is(e, ErrorActorNotFound) {
+		logger.L().Warn("actor stop error", "actor", id, "error", e)
+	}
+}
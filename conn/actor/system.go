@@ -0,0 +1,109 @@
+package actor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/chen102/ggbond/conn/logger"
+)
+
+// Resolver 根据消息确定目标实体
+type Resolver func(msgid int32, connid int64, parameter []byte) (ActorID, error)
+
+// Handle 实体路由处理函数，在目标实体协程中串行执行
+type Handle func(a *Actor, msgid int32, connid int64, parameter []byte) error
+
+// System 实体管理器
+type System struct {
+	mu          sync.RWMutex
+	actors      map[ActorID]*Actor
+	mailboxsize int
+}
+
+// NewSystem 创建实体管理器
+// mailboxsize:每个实体的邮箱容量
+func NewSystem(mailboxsize int) *System {
+	if mailboxsize <= 0 {
+		panic("mailboxsize is not valid")
+	}
+	return &System{
+		actors:      make(map[ActorID]*Actor),
+		mailboxsize: mailboxsize,
+	}
+}
+
+// Spawn 创建并启动实体
+func (s *System) Spawn(id ActorID) (*Actor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.actors[id]; ok {
+		return nil, fmt.Errorf("%w: %w: %s", ErrorActor, ErrorActorExists, id)
+	}
+	a := newActor(id, s.mailboxsize)
+	s.actors[id] = a
+	return a, nil
+}
+
+// Stop 停止并移除实体，邮箱中未处理的任务将被丢弃
+func (s *System) Stop(id ActorID) error {
+	s.mu.Lock()
+	a, ok := s.actors[id]
+	delete(s.actors, id)
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %w: %s", ErrorActor, ErrorActorNotFound, id)
+	}
+	a.close()
+	return nil
+}
+
+// Find 查找实体
+func (s *System) Find(id ActorID) (*Actor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.actors[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %w: %s", ErrorActor, ErrorActorNotFound, id)
+	}
+	return a, nil
+}
+
+// Tell 向实体投递任务
+func (s *System) Tell(id ActorID, f func(a *Actor)) error {
+	a, err := s.Find(id)
+	if err != nil {
+		return err
+	}
+	return a.Post(func() { f(a) })
+}
+
+// Route 生成实体路由，消息投递到目标实体邮箱后立即返回
+// handler的错误在实体协程中产生，只记录日志
+func (s *System) Route(resolve Resolver, handler Handle) func(msgid int32, connid int64, parameter []byte) error {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		id, err := resolve(msgid, connid, parameter)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrorActor, err)
+		}
+		return s.Tell(id, func(a *Actor) {
+			if err := handler(a, msgid, connid, parameter); err != nil {
+				logger.L().Warn("actor handle error", "actor", id, "error", err)
+			}
+		})
+	}
+}
+
+// ByConn 以连接ID作为实体ID，例如玩家实体
+// 实体随连接创建与停止，需在连接管理器的钩子中加入ConnHook(kind)
+func ByConn(kind string) Resolver {
+	return func(msgid int32, connid int64, parameter []byte) (ActorID, error) {
+		return ActorID{Kind: kind, ID: connid}, nil
+	}
+}
+
+// Fixed 固定投递到某个实体，例如全局房间
+func Fixed(id ActorID) Resolver {
+	return func(msgid int32, connid int64, parameter []byte) (ActorID, error) {
+		return id, nil
+	}
+}
@@ -0,0 +1,600 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/ipfilter"
+	"github.com/chen102/ggbond/conn/listener"
+)
+
+var (
+	ErrorAdmin            = errors.New("admin error")
+	ErrorNotFound         = errors.New("not found")
+	ErrorBadRequest       = errors.New("bad request")
+	ErrorNotSupported     = errors.New("not supported")
+	ErrorUnauthorized     = errors.New("unauthorized")
+	ErrorMethodNotAllowed = errors.New("method not allowed")
+)
+
+// ConnManager 本节点连接管理器
+type ConnManager interface {
+	AllConn() map[int64]connect.ITCPConn
+	FindConn(id int64) (connect.ITCPConn, error)
+}
+
+// GroupManager 本节点分组管理器
+type GroupManager interface {
+	Groups() []connmanage.GroupHook
+	Group(g connmanage.GroupHook) (map[int64]struct{}, error)
+	ConnGroups(conn int64) []connmanage.GroupHook
+}
+
+// RouteLister 已注册路由
+type RouteLister interface {
+	Routes() []int32
+}
+
+// Kicker 踢出任意节点上的连接、用户，一般为集群节点
+type Kicker interface {
+	KickConn(connid int64, reason string) error
+	KickUser(userid, reason string) error
+}
+
+// UserFinder 用户当前连接查找
+type UserFinder interface {
+	UserConn(userid string) (connect.ITCPConn, error)
+}
+
+// RateLimitStater 限流统计
+type RateLimitStater interface {
+	Stats() map[string]uint64
+	Bans() map[string]time.Time
+}
+
+// IPFilter 远端IP过滤器
+type IPFilter interface {
+	AddAllow(cidr string) error
+	RemoveAllow(cidr string) (bool, error)
+	AddDeny(cidr string) error
+	RemoveDeny(cidr string) (bool, error)
+	SetMaxConnsPerIP(max int) error
+	Rules() ipfilter.Rules
+	Conns() map[string]int
+}
+
+// ListenerLister 服务器各监听器的统计
+type ListenerLister interface {
+	Listeners() []listener.Stats
+}
+
+// Broadcaster 分组广播
+type Broadcaster interface {
+	Broadcast(g connmanage.GroupHook, from int64, msg connect.IMessage) error
+}
+
+// Admin 运维管理接口
+// 以JSON提供连接、分组、路由的查询，以及踢出连接、向连接或分组发送消息
+//
+//	GET  /conns               连接列表
+//	GET  /conns/{id}          单个连接
+//	POST /conns/{id}/kick     踢出连接 {"reason":""}
+//	POST /conns/{id}/send     发送消息 {"route":0,"msgid":0,"body":""}
+//	POST /users/{id}/kick     踢出用户 {"reason":""}
+//	GET  /groups              分组列表
+//	GET  /groups/{name}       分组成员
+//	POST /groups/{name}/send  向分组发送消息 {"route":0,"msgid":0,"body":""}
+//	GET  /routes              已注册路由
+//	GET  /ratelimit           各范围超限消息数与封禁中的IP
+//	GET  /ipfilter            IP过滤规则与各IP连接数
+//	POST /ipfilter/allow      加入允许列表 {"cidr":""}，DELETE 移除
+//	POST /ipfilter/deny       加入拒绝列表并踢出本节点上匹配的连接 {"cidr":""}，DELETE 移除
+//	POST /ipfilter/limit      设置单IP连接数上限 {"max_conns_per_ip":0}
+//	GET  /listeners           各监听器的地址与连接统计
+type Admin struct {
+	conns       ConnManager
+	groups      GroupManager
+	routes      RouteLister
+	token       string
+	kicker      Kicker
+	users       UserFinder
+	broadcaster Broadcaster
+	limiter     RateLimitStater
+	ipfilter    IPFilter
+	listeners   ListenerLister
+}
+
+// NewAdmin 创建管理接口
+// conns:连接管理器 groups:分组管理器 routes:路由管理器
+func NewAdmin(conns ConnManager, groups GroupManager, routes RouteLister, opt ...AdminOption) (*Admin, error) {
+	var options adminoptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			return nil, fmt.Errorf("%w: apply option error:%w", ErrorAdmin, err)
+		}
+	}
+	return &Admin{
+		conns:       conns,
+		groups:      groups,
+		routes:      routes,
+		token:       options.token,
+		kicker:      options.kicker,
+		users:       options.users,
+		broadcaster: options.broadcaster,
+		limiter:     options.limiter,
+		ipfilter:    options.ipfilter,
+		listeners:   options.listeners,
+	}, nil
+}
+
+// ConnInfo 连接信息
+type ConnInfo struct {
+	ID         int64       `json:"id"`
+	Remote     string      `json:"remote"`
+	Proxy      string      `json:"proxy,omitempty"` //经PROXY协议时为代理地址
+	State      string      `json:"state"`
+	LastActive time.Time   `json:"last_active"`
+	Groups     []GroupInfo `json:"groups"`
+}
+
+// GroupInfo 分组信息
+type GroupInfo struct {
+	ID      int32   `json:"id"`
+	Name    string  `json:"name"`
+	Members []int64 `json:"members,omitempty"`
+}
+
+// 发送消息请求，body按原始字节发送
+type sendRequest struct {
+	Route int32  `json:"route"`
+	MsgID int32  `json:"msgid"`
+	Body  string `json:"body"`
+}
+
+type kickRequest struct {
+	Reason string `json:"reason"`
+}
+
+type cidrRequest struct {
+	CIDR string `json:"cidr"`
+}
+
+type limitRequest struct {
+	MaxConnsPerIP *int `json:"max_conns_per_ip"`
+}
+
+// Handler 管理接口处理器
+func (a *Admin) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			writeError(w, ErrorUnauthorized)
+			return
+		}
+		result, err := a.serve(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+func (a *Admin) authorized(r *http.Request) bool {
+	if a.token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// 按路径分发
+func (a *Admin) serve(r *http.Request) (interface{}, error) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "conns":
+		return a.get(r, a.listConns)
+	case len(parts) == 2 && parts[0] == "conns":
+		return a.get(r, func() (interface{}, error) { return a.conn(parts[1]) })
+	case len(parts) == 3 && parts[0] == "conns" && parts[2] == "kick":
+		return a.post(r, func() (interface{}, error) { return a.kickConn(r, parts[1]) })
+	case len(parts) == 3 && parts[0] == "conns" && parts[2] == "send":
+		return a.post(r, func() (interface{}, error) { return a.sendConn(r, parts[1]) })
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "kick":
+		return a.post(r, func() (interface{}, error) { return a.kickUser(r, parts[1]) })
+	case len(parts) == 1 && parts[0] == "groups":
+		return a.get(r, a.listGroups)
+	case len(parts) == 2 && parts[0] == "groups":
+		return a.get(r, func() (interface{}, error) { return a.group(parts[1]) })
+	case len(parts) == 3 && parts[0] == "groups" && parts[2] == "send":
+		return a.post(r, func() (interface{}, error) { return a.sendGroup(r, parts[1]) })
+	case len(parts) == 1 && parts[0] == "routes":
+		return a.get(r, func() (interface{}, error) { return a.routes.Routes(), nil })
+	case len(parts) == 1 && parts[0] == "ratelimit":
+		return a.get(r, a.rateLimit)
+	case len(parts) == 1 && parts[0] == "listeners":
+		return a.get(r, a.listListeners)
+	case len(parts) == 1 && parts[0] == "ipfilter":
+		return a.get(r, a.ipFilter)
+	case len(parts) == 2 && parts[0] == "ipfilter" && parts[1] == "limit":
+		return a.post(r, func() (interface{}, error) { return a.ipLimit(r) })
+	case len(parts) == 2 && parts[0] == "ipfilter" && (parts[1] == "allow" || parts[1] == "deny"):
+		if r.Method == http.MethodDelete {
+			return a.ipRemove(r, parts[1])
+		}
+		return a.post(r, func() (interface{}, error) { return a.ipAdd(r, parts[1]) })
+	}
+	return nil, fmt.Errorf("%w: %s", ErrorNotFound, r.URL.Path)
+}
+
+func (a *Admin) get(r *http.Request, f func() (interface{}, error)) (interface{}, error) {
+	if r.Method != http.MethodGet {
+		return nil, ErrorMethodNotAllowed
+	}
+	return f()
+}
+
+func (a *Admin) rateLimit() (interface{}, error) {
+	if a.limiter == nil {
+		return nil, fmt.Errorf("%w: rate limit is not enabled", ErrorNotSupported)
+	}
+	return map[string]interface{}{"limited": a.limiter.Stats(), "bans": a.limiter.Bans()}, nil
+}
+
+func (a *Admin) listListeners() (interface{}, error) {
+	if a.listeners == nil {
+		return nil, fmt.Errorf("%w: listener stats is not enabled", ErrorNotSupported)
+	}
+	return a.listeners.Listeners(), nil
+}
+
+func (a *Admin) ipFilter() (interface{}, error) {
+	if a.ipfilter == nil {
+		return nil, fmt.Errorf("%w: ip filter is not enabled", ErrorNotSupported)
+	}
+	return map[string]interface{}{"rules": a.ipfilter.Rules(), "conns": a.ipfilter.Conns()}, nil
+}
+
+func (a *Admin) ipAdd(r *http.Request, list string) (interface{}, error) {
+	cidr, err := a.decodeCIDR(r)
+	if err != nil {
+		return nil, err
+	}
+	if list == "allow" {
+		if err := a.ipfilter.AddAllow(cidr); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrorBadRequest, err)
+		}
+		return map[string]bool{"ok": true}, nil
+	}
+	if err := a.ipfilter.AddDeny(cidr); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorBadRequest, err)
+	}
+	//过滤器只检查新连接，已建立的匹配连接在此踢出
+	n, _ := ipfilter.ParseCIDR(cidr)
+	kicked := 0
+	for _, conn := range a.conns.AllConn() {
+		if ip := ipfilter.IPOf(conn.RemoteAddr()); ip != nil && n.Contains(ip) {
+			go conn.SignalClose(connect.NewCloseError(connect.CloseRejected, "ip denied", nil))
+			kicked++
+		}
+	}
+	return map[string]int{"kicked": kicked}, nil
+}
+
+func (a *Admin) ipRemove(r *http.Request, list string) (interface{}, error) {
+	cidr, err := a.decodeCIDR(r)
+	if err != nil {
+		return nil, err
+	}
+	remove := a.ipfilter.RemoveDeny
+	if list == "allow" {
+		remove = a.ipfilter.RemoveAllow
+	}
+	ok, err := remove(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorBadRequest, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not in %s list", ErrorNotFound, cidr, list)
+	}
+	return map[string]bool{"ok": true}, nil
+}
+
+func (a *Admin) ipLimit(r *http.Request) (interface{}, error) {
+	if a.ipfilter == nil {
+		return nil, fmt.Errorf("%w: ip filter is not enabled", ErrorNotSupported)
+	}
+	var req limitRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if req.MaxConnsPerIP == nil {
+		return nil, fmt.Errorf("%w: max_conns_per_ip is required", ErrorBadRequest)
+	}
+	if err := a.ipfilter.SetMaxConnsPerIP(*req.MaxConnsPerIP); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorBadRequest, err)
+	}
+	return map[string]bool{"ok": true}, nil
+}
+
+func (a *Admin) decodeCIDR(r *http.Request) (string, error) {
+	if a.ipfilter == nil {
+		return "", fmt.Errorf("%w: ip filter is not enabled", ErrorNotSupported)
+	}
+	var req cidrRequest
+	if err := decode(r, &req); err != nil {
+		return "", err
+	}
+	if req.CIDR == "" {
+		return "", fmt.Errorf("%w: cidr is required", ErrorBadRequest)
+	}
+	return req.CIDR, nil
+}
+
+func (a *Admin) post(r *http.Request, f func() (interface{}, error)) (interface{}, error) {
+	if r.Method != http.MethodPost {
+		return nil, ErrorMethodNotAllowed
+	}
+	return f()
+}
+
+func (a *Admin) listConns() (interface{}, error) {
+	conns := a.conns.AllConn()
+	infos := make([]ConnInfo, 0, len(conns))
+	for _, conn := range conns {
+		infos = append(infos, a.info(conn))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+func (a *Admin) conn(id string) (interface{}, error) {
+	conn, err := a.findConn(id)
+	if err != nil {
+		return nil, err
+	}
+	return a.info(conn), nil
+}
+
+func (a *Admin) info(conn connect.ITCPConn) ConnInfo {
+	info := ConnInfo{
+		ID:         conn.ConnID(),
+		State:      conn.Stat().String(),
+		LastActive: time.Unix(conn.LastActiveTime(), 0),
+		Groups:     []GroupInfo{},
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		info.Remote = addr.String()
+	}
+	if c, err := conn.Conn(); err == nil {
+		if pc, ok := c.(interface{ ProxyAddr() net.Addr }); ok {
+			info.Proxy = pc.ProxyAddr().String()
+		}
+	}
+	for _, g := range a.groups.ConnGroups(conn.ConnID()) {
+		info.Groups = append(info.Groups, GroupInfo{ID: g.ID(), Name: g.Name()})
+	}
+	sort.Slice(info.Groups, func(i, j int) bool { return info.Groups[i].ID < info.Groups[j].ID })
+	return info
+}
+
+func (a *Admin) kickConn(r *http.Request, id string) (interface{}, error) {
+	connid, err := parseConnID(id)
+	if err != nil {
+		return nil, err
+	}
+	var req kickRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	reason := kickReason(req.Reason)
+	if a.kicker != nil {
+		if err := a.kicker.KickConn(connid, reason); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrorNotFound, err)
+		}
+		return map[string]bool{"ok": true}, nil
+	}
+	conn, err := a.findConn(id)
+	if err != nil {
+		return nil, err
+	}
+	//关闭信号由连接协程处理，避免阻塞请求
+	go conn.SignalClose(connect.NewCloseError(connect.CloseKicked, reason, nil))
+	return map[string]bool{"ok": true}, nil
+}
+
+func (a *Admin) kickUser(r *http.Request, userid string) (interface{}, error) {
+	var req kickRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	reason := kickReason(req.Reason)
+	if a.kicker != nil {
+		if err := a.kicker.KickUser(userid, reason); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrorNotFound, err)
+		}
+		return map[string]bool{"ok": true}, nil
+	}
+	if a.users == nil {
+		return nil, fmt.Errorf("%w: user lookup is not enabled", ErrorNotSupported)
+	}
+	conn, err := a.users.UserConn(userid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorNotFound, err)
+	}
+	go conn.SignalClose(connect.NewCloseError(connect.CloseKicked, reason, nil))
+	return map[string]bool{"ok": true}, nil
+}
+
+func (a *Admin) sendConn(r *http.Request, id string) (interface{}, error) {
+	conn, err := a.findConn(id)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := decodeMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SendMessage(msg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorAdmin, err)
+	}
+	return map[string]bool{"ok": true}, nil
+}
+
+func (a *Admin) sendGroup(r *http.Request, name string) (interface{}, error) {
+	g, err := a.findGroup(name)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := decodeMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if a.broadcaster != nil {
+		//from为0，AOI分组不按发送者过滤
+		if err := a.broadcaster.Broadcast(g, 0, msg); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrorAdmin, err)
+		}
+		return map[string]bool{"ok": true}, nil
+	}
+	members, err := a.groups.Group(g)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorNotFound, err)
+	}
+	sent := 0
+	for id := range members {
+		conn, err := a.conns.FindConn(id)
+		if err != nil {
+			continue
+		}
+		if conn.SendMessage(msg) == nil {
+			sent++
+		}
+	}
+	return map[string]int{"sent": sent}, nil
+}
+
+func (a *Admin) listGroups() (interface{}, error) {
+	groups := a.groups.Groups()
+	infos := make([]GroupInfo, 0, len(groups))
+	for _, g := range groups {
+		infos = append(infos, GroupInfo{ID: g.ID(), Name: g.Name()})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+func (a *Admin) group(name string) (interface{}, error) {
+	g, err := a.findGroup(name)
+	if err != nil {
+		return nil, err
+	}
+	members, err := a.groups.Group(g)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorNotFound, err)
+	}
+	info := GroupInfo{ID: g.ID(), Name: g.Name(), Members: make([]int64, 0, len(members))}
+	for id := range members {
+		info.Members = append(info.Members, id)
+	}
+	sort.Slice(info.Members, func(i, j int) bool { return info.Members[i] < info.Members[j] })
+	return info, nil
+}
+
+func (a *Admin) findConn(id string) (connect.ITCPConn, error) {
+	connid, err := parseConnID(id)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := a.conns.FindConn(connid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorNotFound, err)
+	}
+	return conn, nil
+}
+
+func (a *Admin) findGroup(name string) (connmanage.GroupHook, error) {
+	for _, g := range a.groups.Groups() {
+		if g.Name() == name {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: group %s", ErrorNotFound, name)
+}
+
+func parseConnID(id string) (int64, error) {
+	connid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: conn id %s", ErrorBadRequest, id)
+	}
+	return connid, nil
+}
+
+func kickReason(reason string) string {
+	if reason == "" {
+		return "kicked by admin"
+	}
+	return reason
+}
+
+// 请求体可为空
+func decode(r *http.Request, v interface{}) error {
+	if r.ContentLength == 0 {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %w", ErrorBadRequest, err)
+	}
+	return nil
+}
+
+func decodeMessage(r *http.Request) (connect.IMessage, error) {
+	var req sendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorBadRequest, err)
+	}
+	if req.Route == 0 {
+		return nil, fmt.Errorf("%w: route is required", ErrorBadRequest)
+	}
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write([]byte(req.Body), req.MsgID, req.Route); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorBadRequest, err)
+	}
+	return msg, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrorUnauthorized):
+		status = http.StatusUnauthorized
+	case errors.Is(err, ErrorMethodNotAllowed):
+		status = http.StatusMethodNotAllowed
+	case errors.Is(err, ErrorBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrorNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrorNotSupported):
+		status = http.StatusNotImplemented
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
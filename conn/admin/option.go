@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"errors"
+)
+
+// AdminOption 管理接口选项
+type AdminOption func(options *adminoptions) error
+type adminoptions struct {
+	token       string
+	kicker      Kicker
+	users       UserFinder
+	broadcaster Broadcaster
+	limiter     RateLimitStater
+	ipfilter    IPFilter
+	listeners   ListenerLister
+}
+
+// token:访问令牌，请求需携带 Authorization: Bearer <token>，为空时不校验
+func WithToken(token string) AdminOption {
+	return func(options *adminoptions) error {
+		options.token = token
+		return nil
+	}
+}
+
+// kicker:集群节点，开启后可踢出其他节点上的连接、用户
+func WithKicker(kicker Kicker) AdminOption {
+	return func(options *adminoptions) error {
+		if kicker == nil {
+			return errors.New("kicker is nil")
+		}
+		options.kicker = kicker
+		return nil
+	}
+}
+
+// users:用户连接查找，一般为会话服务，单机时按用户踢出需要
+func WithUserFinder(users UserFinder) AdminOption {
+	return func(options *adminoptions) error {
+		if users == nil {
+			return errors.New("user finder is nil")
+		}
+		options.users = users
+		return nil
+	}
+}
+
+// broadcaster:分组广播，未设置时只发送给本节点的分组成员
+func WithBroadcaster(broadcaster Broadcaster) AdminOption {
+	return func(options *adminoptions) error {
+		if broadcaster == nil {
+			return errors.New("broadcaster is nil")
+		}
+		options.broadcaster = broadcaster
+		return nil
+	}
+}
+
+// limiter:消息限流器，开启后提供限流统计
+func WithRateLimiter(limiter RateLimitStater) AdminOption {
+	return func(options *adminoptions) error {
+		if limiter == nil {
+			return errors.New("limiter is nil")
+		}
+		options.limiter = limiter
+		return nil
+	}
+}
+
+// filter:远端IP过滤器，开启后可在运行时修改允许、拒绝列表与单IP连接数上限
+func WithIPFilter(filter IPFilter) AdminOption {
+	return func(options *adminoptions) error {
+		if filter == nil {
+			return errors.New("ip filter is nil")
+		}
+		options.ipfilter = filter
+		return nil
+	}
+}
+
+// listeners:服务器，开启后提供各监听器的统计
+func WithListeners(listeners ListenerLister) AdminOption {
+	return func(options *adminoptions) error {
+		if listeners == nil {
+			return errors.New("listeners is nil")
+		}
+		options.listeners = listeners
+		return nil
+	}
+}
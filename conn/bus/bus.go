@@ -0,0 +1,108 @@
+package bus
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/chen102/ggbond/conn/logger"
+)
+
+var (
+	ErrorBus       = errors.New("bus error")
+	ErrorBusClosed = errors.New("bus closed")
+)
+
+// Handler 订阅回调，payload不可在回调返回后继续持有
+type Handler func(topic string, payload []byte)
+
+// Subscription 订阅句柄
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Bus 消息总线，按主题发布订阅
+type Bus interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string, h Handler) (Subscription, error)
+	Close() error
+}
+
+// 按主题保存订阅者，内存总线与redis总线共用
+type handlers struct {
+	mu     sync.RWMutex
+	topics map[string]map[*subscription]struct{}
+}
+
+type subscription struct {
+	topic  string
+	h      Handler
+	cancel func(*subscription) error
+}
+
+func (s *subscription) Unsubscribe() error {
+	return s.cancel(s)
+}
+
+func newHandlers() *handlers {
+	return &handlers{
+		topics: make(map[string]map[*subscription]struct{}),
+	}
+}
+
+// 添加订阅，返回该主题是否为首个订阅
+func (hs *handlers) add(s *subscription) bool {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	subs, ok := hs.topics[s.topic]
+	if !ok {
+		subs = make(map[*subscription]struct{})
+		hs.topics[s.topic] = subs
+	}
+	subs[s] = struct{}{}
+	return !ok
+}
+
+// 移除订阅，返回该主题是否已无订阅
+func (hs *handlers) remove(s *subscription) bool {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	subs, ok := hs.topics[s.topic]
+	if !ok {
+		return false
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(hs.topics, s.topic)
+		return true
+	}
+	return false
+}
+
+func (hs *handlers) list() []string {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	topics := make([]string, 0, len(hs.topics))
+	for t := range hs.topics {
+		topics = append(topics, t)
+	}
+	return topics
+}
+
+func (hs *handlers) dispatch(topic string, payload []byte) {
+	hs.mu.RLock()
+	subs := make([]*subscription, 0, len(hs.topics[topic]))
+	for s := range hs.topics[topic] {
+		subs = append(subs, s)
+	}
+	hs.mu.RUnlock()
+	for _, s := range subs {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.L().Error("bus handler panic", "topic", topic, "panic", r)
+				}
+			}()
+			s.h(topic, payload)
+		}()
+	}
+}
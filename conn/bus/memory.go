@@ -0,0 +1,44 @@
+package bus
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// MemoryBus 进程内总线，发布时同步调用订阅者
+// 单机部署或测试时使用
+type MemoryBus struct {
+	handlers *handlers
+	closed   int32
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		handlers: newHandlers(),
+	}
+}
+
+func (b *MemoryBus) Publish(topic string, payload []byte) error {
+	if atomic.LoadInt32(&b.closed) == 1 {
+		return fmt.Errorf("%w: %w", ErrorBus, ErrorBusClosed)
+	}
+	b.handlers.dispatch(topic, payload)
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(topic string, h Handler) (Subscription, error) {
+	if atomic.LoadInt32(&b.closed) == 1 {
+		return nil, fmt.Errorf("%w: %w", ErrorBus, ErrorBusClosed)
+	}
+	s := &subscription{topic: topic, h: h, cancel: func(s *subscription) error {
+		b.handlers.remove(s)
+		return nil
+	}}
+	b.handlers.add(s)
+	return s, nil
+}
+
+func (b *MemoryBus) Close() error {
+	atomic.StoreInt32(&b.closed, 1)
+	return nil
+}
@@ -0,0 +1,286 @@
+package bus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chen102/ggbond/conn/logger"
+)
+
+// RedisBus 基于redis RESP协议的发布订阅总线
+// 发布与订阅各使用一条连接，订阅连接断开后自动重连并重新订阅全部主题
+type RedisBus struct {
+	addr        string
+	dialTimeout time.Duration
+	pubmu       sync.Mutex
+	pub         *respConn
+	submu       sync.Mutex
+	sub         *respConn
+	handlers    *handlers
+	stop        chan struct{}
+	once        sync.Once
+}
+
+// NewRedisBus 创建redis总线
+// addr:redis地址 ip:port
+func NewRedisBus(addr string) (*RedisBus, error) {
+	b := &RedisBus{
+		addr:        addr,
+		dialTimeout: 3 * time.Second,
+		handlers:    newHandlers(),
+		stop:        make(chan struct{}),
+	}
+	sub, err := b.dial()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorBus, err)
+	}
+	b.sub = sub
+	go b.receive(sub)
+	return b, nil
+}
+
+// Publish 发布消息
+func (b *RedisBus) Publish(topic string, payload []byte) error {
+	b.pubmu.Lock()
+	defer b.pubmu.Unlock()
+	for retry := 0; retry < 2; retry++ {
+		if b.pub == nil {
+			pub, err := b.dial()
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrorBus, err)
+			}
+			b.pub = pub
+		}
+		if err := b.pub.command("PUBLISH", []byte(topic), payload); err != nil {
+			b.pub.close()
+			b.pub = nil
+			continue
+		}
+		reply, err := b.pub.reply()
+		if err != nil {
+			b.pub.close()
+			b.pub = nil
+			continue
+		}
+		if e, ok := reply.(respError); ok {
+			return fmt.Errorf("%w: %s", ErrorBus, string(e))
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: publish failed", ErrorBus)
+}
+
+// Subscribe 订阅主题
+func (b *RedisBus) Subscribe(topic string, h Handler) (Subscription, error) {
+	select {
+	case <-b.stop:
+		return nil, fmt.Errorf("%w: %w", ErrorBus, ErrorBusClosed)
+	default:
+	}
+	s := &subscription{topic: topic, h: h, cancel: b.unsubscribe}
+	if b.handlers.add(s) {
+		b.submu.Lock()
+		err := b.sub.command("SUBSCRIBE", []byte(topic))
+		b.submu.Unlock()
+		if err != nil {
+			//订阅连接已断开，重连后会重新订阅
+			logger.L().Warn("redis bus subscribe error", "error", err)
+		}
+	}
+	return s, nil
+}
+
+func (b *RedisBus) unsubscribe(s *subscription) error {
+	if b.handlers.remove(s) {
+		b.submu.Lock()
+		defer b.submu.Unlock()
+		if err := b.sub.command("UNSUBSCRIBE", []byte(s.topic)); err != nil {
+			return fmt.Errorf("%w: %w", ErrorBus, err)
+		}
+	}
+	return nil
+}
+
+// Close 关闭总线
+func (b *RedisBus) Close() error {
+	b.once.Do(func() {
+		close(b.stop)
+		b.submu.Lock()
+		b.sub.close()
+		b.submu.Unlock()
+		b.pubmu.Lock()
+		if b.pub != nil {
+			b.pub.close()
+		}
+		b.pubmu.Unlock()
+	})
+	return nil
+}
+
+func (b *RedisBus) dial() (*respConn, error) {
+	conn, err := net.DialTimeout("tcp", b.addr, b.dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &respConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}, nil
+}
+
+// 读取订阅推送，连接断开后重连
+func (b *RedisBus) receive(sub *respConn) {
+	backoff := 100 * time.Millisecond
+	for {
+		reply, err := sub.reply()
+		if err != nil {
+			sub.close()
+			select {
+			case <-b.stop:
+				return
+			default:
+			}
+			for {
+				select {
+				case <-b.stop:
+					return
+				case <-time.After(backoff):
+				}
+				if backoff < 5*time.Second {
+					backoff *= 2
+				}
+				if sub, err = b.resubscribe(); err == nil {
+					backoff = 100 * time.Millisecond
+					break
+				}
+			}
+			continue
+		}
+		//推送格式 ["message", 主题, 消息体]
+		arr, ok := reply.([]interface{})
+		if !ok || len(arr) != 3 {
+			continue
+		}
+		kind, _ := arr[0].([]byte)
+		if string(kind) != "message" {
+			continue
+		}
+		topic, _ := arr[1].([]byte)
+		payload, _ := arr[2].([]byte)
+		b.handlers.dispatch(string(topic), payload)
+	}
+}
+
+func (b *RedisBus) resubscribe() (*respConn, error) {
+	sub, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	topics := b.handlers.list()
+	if len(topics) > 0 {
+		args := make([][]byte, len(topics))
+		for i, t := range topics {
+			args[i] = []byte(t)
+		}
+		if err := sub.command("SUBSCRIBE", args...); err != nil {
+			sub.close()
+			return nil, err
+		}
+	}
+	b.submu.Lock()
+	b.sub = sub
+	b.submu.Unlock()
+	return sub, nil
+}
+
+// respError redis错误回复
+type respError string
+
+// respConn RESP协议连接
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// 命令编码为bulk string数组
+func (c *respConn) command(name string, args ...[]byte) error {
+	c.w.WriteString("*" + strconv.Itoa(len(args)+1) + "\r\n")
+	c.writeBulk([]byte(name))
+	for _, a := range args {
+		c.writeBulk(a)
+	}
+	return c.w.Flush()
+}
+
+func (c *respConn) writeBulk(b []byte) {
+	c.w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	c.w.Write(b)
+	c.w.WriteString("\r\n")
+}
+
+// 解析回复 简单字符串为string，错误为respError，整数为int64，bulk string为[]byte，数组为[]interface{}
+func (c *respConn) reply() (interface{}, error) {
+	line, err := c.line()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("resp: empty line")
+	}
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return respError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = c.reply(); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("resp: unknown reply type %q", line[0])
+}
+
+func (c *respConn) line() ([]byte, error) {
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("resp: line is not valid")
+	}
+	return line[:len(line)-2], nil
+}
+
+func (c *respConn) close() {
+	c.conn.Close()
+}
@@ -0,0 +1,288 @@
+package bus
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 进程内的redis替身，只实现SUBSCRIBE、UNSUBSCRIBE、PUBLISH
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	clients  map[*fakeClient]struct{}
+}
+
+type fakeClient struct {
+	*respConn
+	wmu    sync.Mutex
+	topics map[string]struct{}
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: l, clients: make(map[*fakeClient]struct{})}
+	go f.accept()
+	t.Cleanup(func() {
+		l.Close()
+		f.kick()
+	})
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) accept() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &fakeClient{
+			respConn: &respConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)},
+			topics:   make(map[string]struct{}),
+		}
+		f.mu.Lock()
+		f.clients[c] = struct{}{}
+		f.mu.Unlock()
+		go f.serve(c)
+	}
+}
+
+// 命令与客户端发出的格式相同，复用respConn解析
+func (f *fakeRedis) serve(c *fakeClient) {
+	defer func() {
+		f.mu.Lock()
+		delete(f.clients, c)
+		f.mu.Unlock()
+		c.close()
+	}()
+	for {
+		v, err := c.reply()
+		if err != nil {
+			return
+		}
+		arr, ok := v.([]interface{})
+		if !ok || len(arr) == 0 {
+			c.write("-ERR protocol error\r\n")
+			continue
+		}
+		args := make([][]byte, len(arr))
+		for i, a := range arr {
+			args[i], _ = a.([]byte)
+		}
+		switch strings.ToUpper(string(args[0])) {
+		case "SUBSCRIBE", "UNSUBSCRIBE":
+			kind := strings.ToLower(string(args[0]))
+			for _, topic := range args[1:] {
+				f.mu.Lock()
+				if kind == "subscribe" {
+					c.topics[string(topic)] = struct{}{}
+				} else {
+					delete(c.topics, string(topic))
+				}
+				n := len(c.topics)
+				f.mu.Unlock()
+				//回复 [类型, 主题, 订阅数]
+				c.write("*3\r\n" + bulks([]byte(kind), topic) + ":" + strconv.Itoa(n) + "\r\n")
+			}
+		case "PUBLISH":
+			if len(args) != 3 {
+				c.write("-ERR wrong number of arguments\r\n")
+				continue
+			}
+			if string(args[1]) == "forbidden" {
+				c.write("-NOPERM no permissions to access the channel\r\n")
+				continue
+			}
+			n := 0
+			for _, sub := range f.subscribers(string(args[1])) {
+				sub.write("*3\r\n" + bulks([]byte("message"), args[1], args[2]))
+				n++
+			}
+			c.write(":" + strconv.Itoa(n) + "\r\n")
+		default:
+			c.write("-ERR unknown command\r\n")
+		}
+	}
+}
+
+func (f *fakeRedis) subscribers(topic string) []*fakeClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var subs []*fakeClient
+	for c := range f.clients {
+		if _, ok := c.topics[topic]; ok {
+			subs = append(subs, c)
+		}
+	}
+	return subs
+}
+
+// 断开全部客户端连接
+func (f *fakeRedis) kick() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.clients {
+		c.close()
+		delete(f.clients, c)
+	}
+}
+
+func (c *fakeClient) write(s string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.w.WriteString(s)
+	c.w.Flush()
+}
+
+// 编码为连续的bulk string，数组头由调用方写出
+func bulks(items ...[]byte) string {
+	var b strings.Builder
+	for _, item := range items {
+		b.WriteString("$" + strconv.Itoa(len(item)) + "\r\n")
+		b.Write(item)
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type received struct {
+	topic   string
+	payload []byte
+}
+
+func subscribe(t *testing.T, b Bus, topic string) (Subscription, chan received) {
+	t.Helper()
+	ch := make(chan received, 10)
+	sub, err := b.Subscribe(topic, func(topic string, payload []byte) {
+		ch <- received{topic, append([]byte(nil), payload...)}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub, ch
+}
+
+func expect(t *testing.T, ch chan received, topic string, payload []byte) {
+	t.Helper()
+	select {
+	case r := <-ch:
+		if r.topic != topic || string(r.payload) != string(payload) {
+			t.Fatalf("received %s %q, want %s %q", r.topic, r.payload, topic, payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for %s", topic)
+	}
+}
+
+func expectNone(t *testing.T, ch chan received) {
+	t.Helper()
+	select {
+	case r := <-ch:
+		t.Fatalf("unexpected message %s %q", r.topic, r.payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRedisBusPublishSubscribe(t *testing.T) {
+	redis := startFakeRedis(t)
+	node1, err := NewRedisBus(redis.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node1.Close()
+	node2, err := NewRedisBus(redis.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node2.Close()
+
+	sub, ch := subscribe(t, node2, "group")
+	_, other := subscribe(t, node2, "kick")
+	waitFor(t, "subscribe", func() bool { return len(redis.subscribers("group")) == 1 && len(redis.subscribers("kick")) == 1 })
+
+	//消息体可以包含任意字节
+	payload := []byte("hello\r\n$3\r\n\x00\xff")
+	if err := node1.Publish("group", payload); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ch, "group", payload)
+	expectNone(t, other)
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "unsubscribe", func() bool { return len(redis.subscribers("group")) == 0 })
+	if err := node1.Publish("group", payload); err != nil {
+		t.Fatal(err)
+	}
+	expectNone(t, ch)
+
+	if err := node1.Publish("forbidden", payload); err == nil || !errors.Is(err, ErrorBus) || !strings.Contains(err.Error(), "NOPERM") {
+		t.Fatalf("publish error reply: %v", err)
+	}
+}
+
+func TestRedisBusReconnect(t *testing.T) {
+	redis := startFakeRedis(t)
+	node1, err := NewRedisBus(redis.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node1.Close()
+	node2, err := NewRedisBus(redis.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node2.Close()
+
+	_, ch := subscribe(t, node2, "group")
+	waitFor(t, "subscribe", func() bool { return len(redis.subscribers("group")) == 1 })
+	if err := node1.Publish("group", []byte("before")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ch, "group", []byte("before"))
+
+	//redis断开全部连接后，订阅连接重连并重新订阅，发布连接在下一次发布时重连
+	redis.kick()
+	waitFor(t, "resubscribe", func() bool { return len(redis.subscribers("group")) == 1 })
+	if err := node1.Publish("group", []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ch, "group", []byte("after"))
+}
+
+func TestRedisBusClosed(t *testing.T) {
+	redis := startFakeRedis(t)
+	b, err := NewRedisBus(redis.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if _, err := b.Subscribe("group", func(string, []byte) {}); !errors.Is(err, ErrorBusClosed) {
+		t.Fatalf("subscribe after close: %v", err)
+	}
+}
@@ -0,0 +1,881 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chen102/ggbond/conn/bus"
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/logger"
+	"github.com/chen102/ggbond/conn/trace"
+	"github.com/chen102/ggbond/message"
+)
+
+var (
+	ErrorCluster      = errors.New("cluster error")
+	ErrorLinkClosed   = errors.New("cluster link closed")
+	ErrorLinkBusy     = errors.New("cluster link send queue full")
+	ErrorUserNotFound = errors.New("user not exists in directory")
+	ErrorConnNotFound = errors.New("conn not exists in directory")
+	ErrorNodeNotFound = errors.New("node not linked")
+	ErrorNoRouter     = errors.New("cluster router not set")
+	ErrorIDNodeInUse  = errors.New("id generator node already used by another cluster node")
+)
+
+// 总线主题
+const (
+	TOPICGROUP = "ggbond.cluster.group"
+	TOPICKICK  = "ggbond.cluster.kick"
+)
+
+// ConnFinder 本节点连接查找，一般为连接管理器
+type ConnFinder interface {
+	FindConn(id int64) (connect.ITCPConn, error)
+}
+
+// GroupFinder 本节点分组成员查找，一般为分组管理器
+type GroupFinder interface {
+	Receivers(g connmanage.GroupHook, from int64) ([]int64, error)
+}
+
+// AOIGroupFinder 可选，分组绑定AOI时随广播发送发送者坐标，
+// 其他节点按坐标过滤本节点成员，发送者不在其他节点的AOI中
+type AOIGroupFinder interface {
+	Position(g connmanage.GroupHook, id int64) (x, y float32, ok bool)
+	ReceiversAt(g connmanage.GroupHook, x, y float32) ([]int64, error)
+}
+
+// RouteHandler 本节点路由
+type RouteHandler interface {
+	HandleMessageContext(ctx context.Context, routerid int32, connid int64, msgid int32, parameter []byte) error
+}
+
+// Cluster 集群节点
+// 节点之间两两建立内部链路，各自维护本节点的用户、连接目录并同步给其他节点，
+// 向其他节点上的用户、连接发送消息时经内部链路转发。
+// 房间按一致性哈希分配到唯一节点，节点增减时只迁移归属发生变化的房间。
+// 内部链路不认证也不加密，任何能连上内部地址的一方都可以冒充节点转发消息、踢人，
+// 内部地址只能监听在可信的内网，不能暴露到公网
+type Cluster struct {
+	id             string
+	addr           string
+	conns          ConnFinder
+	group          GroupFinder
+	listener       net.Listener
+	mu             sync.RWMutex
+	peers          map[string]string             //节点ID -> 内部地址
+	links          map[string]*link              //节点ID -> 链路
+	dialing        map[string]struct{}           //正在连接的节点
+	users          map[string]string             //用户ID -> 节点ID
+	conndir        map[int64]string              //连接ID -> 节点ID
+	localusers     map[string]int64              //本节点 用户ID -> 连接ID
+	connusers      map[int64]map[string]struct{} //本节点 连接ID -> 用户ID
+	gossipInterval time.Duration
+	dialTimeout    time.Duration
+	bus            bus.Bus
+	ring           *Ring
+	rooms          map[int32]struct{} //本节点承载的房间
+	onmigrate      []func(roomid int32, to string)
+	router         RouteHandler
+	idnode         *int64
+	stop           chan struct{}
+}
+
+// NewCluster 创建集群节点
+// id:节点ID，集群内唯一 addr:内部链路监听地址 conns:本节点连接查找 group:本节点分组查找
+func NewCluster(id, addr string, conns ConnFinder, group GroupFinder, opt ...ClusterOption) *Cluster {
+	var options clusteroptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			panic(fmt.Errorf("apply option error:%w", err))
+		}
+	}
+	if id == "" {
+		panic("cluster node id is not valid")
+	}
+	c := &Cluster{
+		id:             id,
+		addr:           addr,
+		conns:          conns,
+		group:          group,
+		peers:          make(map[string]string),
+		links:          make(map[string]*link),
+		dialing:        make(map[string]struct{}),
+		users:          make(map[string]string),
+		conndir:        make(map[int64]string),
+		localusers:     make(map[string]int64),
+		connusers:      make(map[int64]map[string]struct{}),
+		gossipInterval: 3 * time.Second,
+		dialTimeout:    3 * time.Second,
+		rooms:          make(map[int32]struct{}),
+		stop:           make(chan struct{}),
+	}
+	for pid, paddr := range options.peers {
+		if pid != id {
+			c.peers[pid] = paddr
+		}
+	}
+	if options.gossipInterval != nil {
+		c.gossipInterval = *options.gossipInterval
+	}
+	if options.dialTimeout != nil {
+		c.dialTimeout = *options.dialTimeout
+	}
+	c.bus = options.bus
+	c.router = options.router
+	c.idnode = options.idnode
+	replicas := 160
+	if options.replicas != nil {
+		replicas = *options.replicas
+	}
+	c.ring = NewRing(replicas)
+	c.ring.Add(id)
+	return c
+}
+
+// ID 本节点ID
+func (c *Cluster) ID() string {
+	return c.id
+}
+
+// Start 监听内部地址并连接已知节点
+func (c *Cluster) Start() error {
+	listener, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorCluster, err)
+	}
+	c.listener = listener
+	if c.bus != nil {
+		if _, err := c.bus.Subscribe(TOPICGROUP, c.onBus); err != nil {
+			return fmt.Errorf("%w: %w", ErrorCluster, err)
+		}
+		if _, err := c.bus.Subscribe(TOPICKICK, c.onBus); err != nil {
+			return fmt.Errorf("%w: %w", ErrorCluster, err)
+		}
+	}
+	logger.L().Info("cluster node listen", "node", c.id, "addr", c.addr)
+	go c.accept()
+	go c.gossip()
+	c.connectPeers()
+	return nil
+}
+
+// Stop 关闭全部内部链路
+func (c *Cluster) Stop() error {
+	close(c.stop)
+	err := c.listener.Close()
+	c.mu.Lock()
+	links := make([]*link, 0, len(c.links))
+	for _, l := range c.links {
+		links = append(links, l)
+	}
+	c.mu.Unlock()
+	for _, l := range links {
+		l.close()
+	}
+	return err
+}
+
+// Nodes 当前已连接的节点
+func (c *Cluster) Nodes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	nodes := make([]string, 0, len(c.links))
+	for id := range c.links {
+		nodes = append(nodes, id)
+	}
+	return nodes
+}
+
+// AddConn 本节点新增连接，同步到其他节点
+func (c *Cluster) AddConn(connid int64) {
+	c.mu.Lock()
+	c.conndir[connid] = c.id
+	c.mu.Unlock()
+	c.publish(UPDATE, update{Op: opaddconn, Conn: connid})
+}
+
+// RemoveConn 本节点连接断开，连接上绑定的用户一并解绑
+func (c *Cluster) RemoveConn(connid int64) {
+	c.mu.Lock()
+	delete(c.conndir, connid)
+	var users []string
+	for user := range c.connusers[connid] {
+		users = append(users, user)
+		delete(c.localusers, user)
+		if c.users[user] == c.id {
+			delete(c.users, user)
+		}
+	}
+	delete(c.connusers, connid)
+	c.mu.Unlock()
+	c.publish(UPDATE, update{Op: opdelconn, Conn: connid})
+	for _, user := range users {
+		c.publish(UPDATE, update{Op: opunbind, User: user})
+	}
+}
+
+// BindUser 绑定用户到本节点连接
+func (c *Cluster) BindUser(userid string, connid int64) error {
+	c.mu.Lock()
+	if old, ok := c.localusers[userid]; ok {
+		delete(c.connusers[old], userid)
+	}
+	c.localusers[userid] = connid
+	if _, ok := c.connusers[connid]; !ok {
+		c.connusers[connid] = make(map[string]struct{})
+	}
+	c.connusers[connid][userid] = struct{}{}
+	c.users[userid] = c.id
+	c.mu.Unlock()
+	c.publish(UPDATE, update{Op: opbind, User: userid})
+	return nil
+}
+
+// UnbindUser 解绑本节点用户
+func (c *Cluster) UnbindUser(userid string) {
+	c.mu.Lock()
+	if connid, ok := c.localusers[userid]; ok {
+		delete(c.connusers[connid], userid)
+		delete(c.localusers, userid)
+	}
+	if c.users[userid] == c.id {
+		delete(c.users, userid)
+	}
+	c.mu.Unlock()
+	c.publish(UPDATE, update{Op: opunbind, User: userid})
+}
+
+// UserNode 查询用户所在节点
+func (c *Cluster) UserNode(userid string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	node, ok := c.users[userid]
+	if !ok {
+		return "", fmt.Errorf("%w: %w: %s", ErrorCluster, ErrorUserNotFound, userid)
+	}
+	return node, nil
+}
+
+// ConnNode 查询连接所在节点
+func (c *Cluster) ConnNode(connid int64) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	node, ok := c.conndir[connid]
+	if !ok {
+		return "", fmt.Errorf("%w: %w: %d", ErrorCluster, ErrorConnNotFound, connid)
+	}
+	return node, nil
+}
+
+// SendToConn 向任意节点上的连接发送消息
+func (c *Cluster) SendToConn(connid int64, msg connect.IMessage) error {
+	node, err := c.ConnNode(connid)
+	if err != nil {
+		return err
+	}
+	f := forward{To: toconn, Conn: connid, RouteID: msg.RouteID(), MsgID: msg.MessageID(), Body: msg.Body()}
+	if node == c.id {
+		return c.deliver(f)
+	}
+	return c.send(node, FORWARD, f)
+}
+
+// SendToUser 向任意节点上的用户发送消息
+func (c *Cluster) SendToUser(userid string, msg connect.IMessage) error {
+	node, err := c.UserNode(userid)
+	if err != nil {
+		return err
+	}
+	f := forward{To: touser, User: userid, RouteID: msg.RouteID(), MsgID: msg.MessageID(), Body: msg.Body()}
+	if node == c.id {
+		return c.deliver(f)
+	}
+	return c.send(node, FORWARD, f)
+}
+
+// BroadcastGroup 向其他节点上的分组成员广播，本节点成员由调用方负责下发
+func (c *Cluster) BroadcastGroup(g connmanage.GroupHook, from int64, msg connect.IMessage) error {
+	f := forward{To: togroup, GroupID: g.ID(), GroupName: g.Name(), From: from, RouteID: msg.RouteID(), MsgID: msg.MessageID(), Body: msg.Body()}
+	if finder, ok := c.group.(AOIGroupFinder); ok {
+		if x, y, ok := finder.Position(g, from); ok {
+			f.Pos = &position{X: x, Y: y}
+		}
+	}
+	if c.bus != nil {
+		return c.publishBus(TOPICGROUP, f)
+	}
+	c.publish(FORWARD, f)
+	return nil
+}
+
+// KickConn 断开任意节点上的连接
+func (c *Cluster) KickConn(connid int64, reason string) error {
+	node, err := c.ConnNode(connid)
+	if err != nil {
+		return err
+	}
+	return c.kick(node, kick{Conn: connid, Reason: reason})
+}
+
+// KickUser 断开任意节点上用户的连接
+func (c *Cluster) KickUser(userid, reason string) error {
+	node, err := c.UserNode(userid)
+	if err != nil {
+		return err
+	}
+	return c.kick(node, kick{User: userid, Reason: reason})
+}
+
+func (c *Cluster) kick(node string, k kick) error {
+	if node == c.id {
+		return c.kickLocal(k)
+	}
+	if c.bus != nil {
+		return c.publishBus(TOPICKICK, k)
+	}
+	return c.send(node, KICK, k)
+}
+
+func (c *Cluster) kickLocal(k kick) error {
+	connid := k.Conn
+	if k.User != "" {
+		c.mu.RLock()
+		id, ok := c.localusers[k.User]
+		c.mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("%w: %w: %s", ErrorCluster, ErrorUserNotFound, k.User)
+		}
+		connid = id
+	}
+	conn, err := c.conns.FindConn(connid)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorCluster, err)
+	}
+	go conn.SignalClose(connect.NewCloseError(connect.CloseKicked, k.Reason, ErrorCluster))
+	return nil
+}
+
+func (c *Cluster) publishBus(topic string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorCluster, err)
+	}
+	data, err := json.Marshal(envelope{Node: c.id, Payload: payload})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorCluster, err)
+	}
+	if err := c.bus.Publish(topic, data); err != nil {
+		return fmt.Errorf("%w: %w", ErrorCluster, err)
+	}
+	return nil
+}
+
+// 总线消息，忽略本节点发布的消息
+func (c *Cluster) onBus(topic string, data []byte) {
+	var e envelope
+	if err := json.Unmarshal(data, &e); err != nil || e.Node == c.id {
+		return
+	}
+	switch topic {
+	case TOPICGROUP:
+		var f forward
+		if err := json.Unmarshal(e.Payload, &f); err != nil {
+			return
+		}
+		if err := c.deliver(f); err != nil {
+			logger.L().Warn("cluster bus deliver error", "node", c.id, "error", err)
+		}
+	case TOPICKICK:
+		var k kick
+		if err := json.Unmarshal(e.Payload, &k); err != nil {
+			return
+		}
+		//每个节点都会收到，只处理本节点的连接
+		_ = c.kickLocal(k)
+	}
+}
+
+// RoomNode 查询房间归属节点
+func (c *Cluster) RoomNode(roomid int32) (string, error) {
+	node, ok := c.ring.Get(roomid)
+	if !ok {
+		return "", fmt.Errorf("%w: %w", ErrorCluster, ErrorNodeNotFound)
+	}
+	return node, nil
+}
+
+// AddRoom 本节点开始承载房间，房间不属于本节点时返回归属节点错误
+func (c *Cluster) AddRoom(roomid int32) error {
+	node, err := c.RoomNode(roomid)
+	if err != nil {
+		return err
+	}
+	if node != c.id {
+		return fmt.Errorf("%w: room %d belongs to node %s", ErrorCluster, roomid, node)
+	}
+	c.mu.Lock()
+	c.rooms[roomid] = struct{}{}
+	c.mu.Unlock()
+	return nil
+}
+
+// RemoveRoom 本节点不再承载房间
+func (c *Cluster) RemoveRoom(roomid int32) {
+	c.mu.Lock()
+	delete(c.rooms, roomid)
+	c.mu.Unlock()
+}
+
+// OnMigrate 注册房间迁移回调，节点变化导致本节点房间归属其他节点时调用，
+// 回调负责把房间状态交给新节点，回调返回后房间不再由本节点承载
+func (c *Cluster) OnMigrate(f func(roomid int32, to string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onmigrate = append(c.onmigrate, f)
+}
+
+// LocateRoom 返回房间消息需要转发到的节点，无需转发时返回空
+// 只转发本节点连接的消息，其他节点转发来的消息即使环暂未收敛也在本节点处理，避免来回转发
+func (c *Cluster) LocateRoom(roomid int32, connid int64) (string, error) {
+	node, err := c.RoomNode(roomid)
+	if err != nil {
+		return "", err
+	}
+	if node == c.id {
+		return "", nil
+	}
+	c.mu.RLock()
+	owner, ok := c.conndir[connid]
+	c.mu.RUnlock()
+	if ok && owner != c.id {
+		return "", nil
+	}
+	return node, nil
+}
+
+// ForwardRoute 把路由消息转发到指定节点，由该节点路由处理
+// ctx中的链路上下文随消息转发，目标节点的跨度接续本节点的链路
+func (c *Cluster) ForwardRoute(ctx context.Context, node string, routeid int32, connid int64, msgid int32, parameter []byte) error {
+	ctx, span := trace.Start(ctx, "cluster.forward", trace.String("node", node), trace.Int64("route", int64(routeid)))
+	span.SetKind(trace.SpanKindClient)
+	err := c.send(node, ROUTE, route{Route: routeid, Conn: connid, MsgID: msgid, Body: parameter, Trace: trace.SpanContextFromContext(ctx).Encode()})
+	span.SetError(err)
+	span.End()
+	return err
+}
+
+// 节点变化后检查本节点房间归属
+func (c *Cluster) rebalance() {
+	type migration struct {
+		roomid int32
+		to     string
+	}
+	var moved []migration
+	c.mu.Lock()
+	for roomid := range c.rooms {
+		if node, ok := c.ring.Get(roomid); ok && node != c.id {
+			delete(c.rooms, roomid)
+			moved = append(moved, migration{roomid, node})
+		}
+	}
+	onmigrate := c.onmigrate
+	c.mu.Unlock()
+	for _, m := range moved {
+		logger.L().Info("cluster migrate room", "node", c.id, "room", m.roomid, "to", m.to)
+		for _, f := range onmigrate {
+			f(m.roomid, m.to)
+		}
+	}
+}
+
+// 投递到本节点
+func (c *Cluster) deliver(f forward) error {
+	var receivers []int64
+	switch f.To {
+	case toconn:
+		receivers = []int64{f.Conn}
+	case touser:
+		c.mu.RLock()
+		connid, ok := c.localusers[f.User]
+		c.mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("%w: %w: %s", ErrorCluster, ErrorUserNotFound, f.User)
+		}
+		receivers = []int64{connid}
+	case togroup:
+		g := &groupRef{id: f.GroupID, name: f.GroupName}
+		var ids []int64
+		var err error
+		if finder, ok := c.group.(AOIGroupFinder); ok && f.Pos != nil {
+			ids, err = finder.ReceiversAt(g, f.Pos.X, f.Pos.Y)
+		} else {
+			ids, err = c.group.Receivers(g, f.From)
+		}
+		if err != nil {
+			//本节点没有该分组
+			return nil
+		}
+		receivers = ids
+	}
+	for _, id := range receivers {
+		conn, err := c.conns.FindConn(id)
+		if err != nil {
+			if f.To == togroup {
+				continue
+			}
+			return fmt.Errorf("%w: %w", ErrorCluster, err)
+		}
+		msg := connect.NewMessage("tcp")
+		if err := msg.Write(f.Body, f.MsgID, f.RouteID); err != nil {
+			return fmt.Errorf("%w: %w", ErrorCluster, err)
+		}
+		if err := conn.SendMessage(msg); err != nil {
+			return fmt.Errorf("%w: %w", ErrorCluster, err)
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) send(node string, op int32, v interface{}) error {
+	c.mu.RLock()
+	l, ok := c.links[node]
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %w: %s", ErrorCluster, ErrorNodeNotFound, node)
+	}
+	if err := l.post(op, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrorCluster, err)
+	}
+	return nil
+}
+
+// 发送给全部已连接节点
+func (c *Cluster) publish(op int32, v interface{}) {
+	c.mu.RLock()
+	links := make([]*link, 0, len(c.links))
+	for _, l := range c.links {
+		links = append(links, l)
+	}
+	c.mu.RUnlock()
+	for _, l := range links {
+		if err := l.post(op, v); err != nil {
+			logger.L().Warn("cluster publish error", "node", c.id, "peer", l.peer, "error", err)
+		}
+	}
+}
+
+func (c *Cluster) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			select {
+			case <-c.stop:
+				return
+			default:
+			}
+			logger.L().Error("cluster accept error", "node", c.id, "error", err)
+			continue
+		}
+		go c.handshake(conn, false)
+	}
+}
+
+// 周期交换节点列表并重连断开的节点
+func (c *Cluster) gossip() {
+	ticker := time.NewTicker(c.gossipInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.connectPeers()
+			c.publish(PEERS, c.knownPeers())
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Cluster) knownPeers() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	peers := make(map[string]string, len(c.peers)+1)
+	for id, addr := range c.peers {
+		peers[id] = addr
+	}
+	peers[c.id] = c.addr
+	return peers
+}
+
+func (c *Cluster) connectPeers() {
+	c.mu.Lock()
+	var targets []string
+	for id := range c.peers {
+		if _, ok := c.links[id]; ok {
+			continue
+		}
+		if _, ok := c.dialing[id]; ok {
+			continue
+		}
+		c.dialing[id] = struct{}{}
+		targets = append(targets, id)
+	}
+	c.mu.Unlock()
+	for _, id := range targets {
+		go c.dial(id)
+	}
+}
+
+func (c *Cluster) dial(id string) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.dialing, id)
+		c.mu.Unlock()
+	}()
+	c.mu.RLock()
+	addr := c.peers[id]
+	c.mu.RUnlock()
+	conn, err := net.DialTimeout("tcp", addr, c.dialTimeout)
+	if err != nil {
+		return
+	}
+	c.handshake(conn, true)
+}
+
+// 握手：发起方先发送HELLO，接收方回复HELLO
+func (c *Cluster) handshake(conn net.Conn, dialer bool) {
+	l := newLink(conn)
+	me := hello{ID: c.id, Addr: c.addr, Peers: c.knownPeers(), IDNode: c.idnode}
+	_ = conn.SetDeadline(time.Now().Add(c.dialTimeout))
+	if dialer {
+		if err := l.write(HELLO, me); err != nil {
+			l.close()
+			return
+		}
+	}
+	msg, err := l.read()
+	if err != nil || msg.RouteID() != HELLO {
+		l.close()
+		return
+	}
+	var peer hello
+	if err := json.Unmarshal(msg.Body(), &peer); err != nil || peer.ID == "" || peer.ID == c.id {
+		l.close()
+		return
+	}
+	if !dialer {
+		if err := l.write(HELLO, me); err != nil {
+			l.close()
+			return
+		}
+	}
+	//连接ID生成器节点号重复时两端生成的连接ID会冲突，双方都拒绝链路，由运维修正配置
+	if c.idnode != nil && peer.IDNode != nil && *c.idnode == *peer.IDNode {
+		logger.L().Error("cluster handshake rejected", "node", c.id, "peer", peer.ID, "idnode", *c.idnode, "error", ErrorIDNodeInUse)
+		l.close()
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	l.peer, l.addr = peer.ID, peer.Addr
+	l.dialer = peer.ID
+	if dialer {
+		l.dialer = c.id
+	}
+	c.learn(peer.Peers)
+	if !c.register(l) {
+		l.close()
+		return
+	}
+	go l.writeloop()
+	c.readloop(l)
+}
+
+// 记录链路，两端同时建立链路时保留较小节点ID发起的链路
+func (c *Cluster) register(l *link) bool {
+	c.mu.Lock()
+	if old, ok := c.links[l.peer]; ok {
+		keep := c.id
+		if l.peer < keep {
+			keep = l.peer
+		}
+		if old.dialer == keep {
+			c.mu.Unlock()
+			return false
+		}
+		delete(c.links, l.peer)
+		old.close()
+	}
+	c.links[l.peer] = l
+	c.peers[l.peer] = l.addr
+	local := directory{}
+	for user, node := range c.users {
+		if node == c.id {
+			local.Users = append(local.Users, user)
+		}
+	}
+	for conn, node := range c.conndir {
+		if node == c.id {
+			local.Conns = append(local.Conns, conn)
+		}
+	}
+	c.mu.Unlock()
+	logger.L().Info("cluster node linked", "node", c.id, "peer", l.peer)
+	c.ring.Add(l.peer)
+	c.rebalance()
+	if err := l.post(SYNC, local); err != nil {
+		logger.L().Warn("cluster sync error", "node", c.id, "peer", l.peer, "error", err)
+	}
+	return true
+}
+
+// 链路断开时清除该节点的目录
+func (c *Cluster) unregister(l *link) {
+	c.mu.Lock()
+	if c.links[l.peer] != l {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.links, l.peer)
+	c.purge(l.peer)
+	c.mu.Unlock()
+	logger.L().Info("cluster node unlinked", "node", c.id, "peer", l.peer)
+	//节点离开只会让其房间落到其他节点，本节点房间归属不变
+	c.ring.Remove(l.peer)
+}
+
+func (c *Cluster) purge(node string) {
+	for user, n := range c.users {
+		if n == node {
+			delete(c.users, user)
+		}
+	}
+	for conn, n := range c.conndir {
+		if n == node {
+			delete(c.conndir, conn)
+		}
+	}
+}
+
+func (c *Cluster) learn(peers map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, addr := range peers {
+		if id == c.id || addr == "" {
+			continue
+		}
+		if _, ok := c.peers[id]; !ok {
+			c.peers[id] = addr
+		}
+	}
+}
+
+func (c *Cluster) readloop(l *link) {
+	defer c.unregister(l)
+	defer l.close()
+	for {
+		msg, err := l.read()
+		if err != nil {
+			return
+		}
+		if err := c.handle(l, msg); err != nil {
+			logger.L().Warn("cluster handle error", "node", c.id, "peer", l.peer, "error", err)
+		}
+	}
+}
+
+func (c *Cluster) handle(l *link, msg *message.TCPMessage) error {
+	switch msg.RouteID() {
+	case PEERS:
+		var peers map[string]string
+		if err := json.Unmarshal(msg.Body(), &peers); err != nil {
+			return err
+		}
+		c.learn(peers)
+		c.connectPeers()
+	case SYNC:
+		var d directory
+		if err := json.Unmarshal(msg.Body(), &d); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.purge(l.peer)
+		for _, user := range d.Users {
+			c.users[user] = l.peer
+		}
+		for _, conn := range d.Conns {
+			c.conndir[conn] = l.peer
+		}
+		c.mu.Unlock()
+	case UPDATE:
+		var u update
+		if err := json.Unmarshal(msg.Body(), &u); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		switch u.Op {
+		case opbind:
+			c.users[u.User] = l.peer
+		case opunbind:
+			if c.users[u.User] == l.peer {
+				delete(c.users, u.User)
+			}
+		case opaddconn:
+			c.conndir[u.Conn] = l.peer
+		case opdelconn:
+			if c.conndir[u.Conn] == l.peer {
+				delete(c.conndir, u.Conn)
+			}
+		}
+		c.mu.Unlock()
+	case FORWARD:
+		var f forward
+		if err := json.Unmarshal(msg.Body(), &f); err != nil {
+			return err
+		}
+		return c.deliver(f)
+	case KICK:
+		var k kick
+		if err := json.Unmarshal(msg.Body(), &k); err != nil {
+			return err
+		}
+		return c.kickLocal(k)
+	case ROUTE:
+		var r route
+		if err := json.Unmarshal(msg.Body(), &r); err != nil {
+			return err
+		}
+		if c.router == nil {
+			return ErrorNoRouter
+		}
+		ctx := context.Background()
+		if sc, err := trace.Decode(r.Trace); err == nil {
+			ctx = trace.ContextWithRemote(ctx, sc)
+		}
+		ctx, span := trace.Start(ctx, "cluster.route", trace.String("from", l.peer), trace.Int64("conn", r.Conn), trace.Int64("route", int64(r.Route)))
+		span.SetKind(trace.SpanKindServer)
+		err := c.router.HandleMessageContext(ctx, r.Route, r.Conn, r.MsgID, r.Body)
+		span.SetError(err)
+		span.End()
+		return err
+	}
+	return nil
+}
+
+// 转发分组广播时重建的分组引用
+type groupRef struct {
+	id   int32
+	name string
+}
+
+func (g *groupRef) ID() int32 {
+	return g.id
+}
+func (g *groupRef) Name() string {
+	return g.name
+}
@@ -0,0 +1,291 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+)
+
+// 本节点连接，只保存测试创建的连接
+type testConns struct {
+	mu    sync.Mutex
+	conns map[int64]connect.ITCPConn
+}
+
+func (t *testConns) FindConn(id int64) (connect.ITCPConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn, ok := t.conns[id]
+	if !ok {
+		return nil, errors.New("conn not exists")
+	}
+	return conn, nil
+}
+
+type testGroup struct{}
+
+func (testGroup) Receivers(g connmanage.GroupHook, from int64) ([]int64, error) {
+	return nil, errors.New("group not exists")
+}
+
+// 记录转发来的路由消息
+type testRouter struct {
+	routes chan route
+}
+
+func (r testRouter) HandleMessageContext(ctx context.Context, routerid int32, connid int64, msgid int32, parameter []byte) error {
+	r.routes <- route{Route: routerid, Conn: connid, MsgID: msgid, Body: parameter}
+	return nil
+}
+
+type testNode struct {
+	*Cluster
+	conns  *testConns
+	routes chan route
+}
+
+// 在本机空闲端口上启动节点
+func startTestNode(t *testing.T, id string, peers ...string) *testNode {
+	t.Helper()
+	return startGroupNode(t, id, testGroup{}, peers...)
+}
+
+// group:本节点分组管理器
+func startGroupNode(t *testing.T, id string, group GroupFinder, peers ...string) *testNode {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	n := &testNode{
+		conns:  &testConns{conns: make(map[int64]connect.ITCPConn)},
+		routes: make(chan route, 10),
+	}
+	opt := []ClusterOption{WithGossipInterval(50 * time.Millisecond), WithRouter(testRouter{n.routes})}
+	if len(peers) > 0 {
+		opt = append(opt, WithPeers(peers...))
+	}
+	n.Cluster = NewCluster(id, addr, n.conns, group, opt...)
+	if err := n.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Stop() })
+	return n
+}
+
+// 本节点新增连接，返回连接的发送队列
+func (n *testNode) addConn(t *testing.T, connid int64) chan connect.IMessage {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	conn := connect.NewTCPConn(a, connid, "tcp")
+	n.conns.mu.Lock()
+	n.conns.conns[connid] = conn
+	n.conns.mu.Unlock()
+	n.AddConn(connid)
+	return conn.MessageChan()
+}
+
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func recvMessage(t *testing.T, ch chan connect.IMessage) connect.IMessage {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+		return nil
+	}
+}
+
+// 三个节点只配置到a的静态节点，经gossip两两互联
+func startTestCluster(t *testing.T) (a, b, c *testNode) {
+	a = startTestNode(t, "a")
+	b = startTestNode(t, "b", "a@"+a.addr)
+	c = startTestNode(t, "c", "a@"+a.addr)
+	for _, n := range []*testNode{a, b, c} {
+		n := n
+		waitFor(t, n.ID()+" linked", func() bool { return len(n.Nodes()) == 2 })
+	}
+	return a, b, c
+}
+
+func TestClusterGossipJoin(t *testing.T) {
+	a, b, c := startTestCluster(t)
+	for _, n := range []*testNode{a, b, c} {
+		nodes := n.Nodes()
+		sort.Strings(nodes)
+		var want []string
+		for _, id := range []string{"a", "b", "c"} {
+			if id != n.ID() {
+				want = append(want, id)
+			}
+		}
+		if len(nodes) != 2 || nodes[0] != want[0] || nodes[1] != want[1] {
+			t.Fatalf("node %s linked to %v, want %v", n.ID(), nodes, want)
+		}
+	}
+}
+
+func TestClusterRingLookup(t *testing.T) {
+	a, b, c := startTestCluster(t)
+	owners := make(map[string]int)
+	for roomid := int32(0); roomid < 300; roomid++ {
+		node, err := a.RoomNode(roomid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []*testNode{b, c} {
+			if other, err := n.RoomNode(roomid); err != nil || other != node {
+				t.Fatalf("room %d on %s: %s %v, on a: %s", roomid, n.ID(), other, err, node)
+			}
+		}
+		owners[node]++
+	}
+	if len(owners) != 3 {
+		t.Fatalf("rooms only spread over %v", owners)
+	}
+	//只有归属节点可以承载房间
+	for roomid := int32(0); roomid < 300; roomid++ {
+		node, _ := a.RoomNode(roomid)
+		if err := a.AddRoom(roomid); (err == nil) != (node == "a") {
+			t.Fatalf("add room %d owned by %s on a: %v", roomid, node, err)
+		}
+	}
+}
+
+func TestClusterRouteToRemoteConn(t *testing.T) {
+	a, b, c := startTestCluster(t)
+	inbox := c.addConn(t, 42)
+	waitFor(t, "conn directory sync", func() bool {
+		node, err := a.ConnNode(42)
+		return err == nil && node == "c"
+	})
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write([]byte("to conn"), 7, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SendToConn(42, msg); err != nil {
+		t.Fatal(err)
+	}
+	got := recvMessage(t, inbox)
+	if string(got.Body()) != "to conn" || got.MessageID() != 7 || got.RouteID() != 100 {
+		t.Fatalf("got route %d msgid %d body %q", got.RouteID(), got.MessageID(), got.Body())
+	}
+
+	if err := c.BindUser("alice", 42); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "user directory sync", func() bool {
+		node, err := b.UserNode("alice")
+		return err == nil && node == "c"
+	})
+	if err := b.SendToUser("alice", msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := recvMessage(t, inbox); string(got.Body()) != "to conn" {
+		t.Fatalf("got body %q", got.Body())
+	}
+
+	//路由消息转发到房间所在节点处理
+	if err := a.ForwardRoute(context.Background(), "b", 200, 42, 9, []byte("to room")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-b.routes:
+		if r.Route != 200 || r.Conn != 42 || r.MsgID != 9 || string(r.Body) != "to room" {
+			t.Fatalf("got route %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for forwarded route")
+	}
+
+	//连接断开后其他节点的目录随之清除
+	c.RemoveConn(42)
+	waitFor(t, "conn removed", func() bool {
+		_, err := a.ConnNode(42)
+		return errors.Is(err, ErrorConnNotFound)
+	})
+	if err := a.SendToConn(42, msg); !errors.Is(err, ErrorConnNotFound) {
+		t.Fatalf("send to removed conn: %v", err)
+	}
+}
+
+type testRoom struct{}
+
+func (testRoom) ID() int32    { return 7 }
+func (testRoom) Name() string { return "room" }
+
+// 创建绑定AOI的分组，entities为 连接ID -> x,y,视野半径
+func newAOIGroup(t *testing.T, entities map[int64][3]float32) *connmanage.ConnGroup {
+	t.Helper()
+	group := connmanage.NewConnGroup()
+	if err := group.AddGroup(testRoom{}); err != nil {
+		t.Fatal(err)
+	}
+	aoi := connmanage.NewGridAOI(0, 0, 1000, 1000, 50)
+	if err := group.SetAOI(testRoom{}, aoi); err != nil {
+		t.Fatal(err)
+	}
+	for id, e := range entities {
+		if err := group.AddConnToGroup(testRoom{}, id); err != nil {
+			t.Fatal(err)
+		}
+		if err := aoi.Enter(id, e[0], e[1], e[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return group
+}
+
+func TestClusterBroadcastGroupAOI(t *testing.T) {
+	//发送者1在a上，b上的2能看到发送者的坐标，3看不到
+	a := startGroupNode(t, "a", newAOIGroup(t, map[int64][3]float32{1: {100, 100, 50}}))
+	b := startGroupNode(t, "b", newAOIGroup(t, map[int64][3]float32{2: {120, 100, 50}, 3: {900, 900, 50}}), "a@"+a.addr)
+	waitFor(t, "linked", func() bool { return len(a.Nodes()) == 1 && len(b.Nodes()) == 1 })
+	near, far := b.addConn(t, 2), b.addConn(t, 3)
+
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write([]byte("hello"), 1, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.BroadcastGroup(testRoom{}, 1, msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := recvMessage(t, near); string(got.Body()) != "hello" {
+		t.Fatalf("got body %q", got.Body())
+	}
+	//不在任何AOI中的发送者广播给全部成员，far收到的第一条即为该消息
+	if err := a.BroadcastGroup(testRoom{}, 99, msg); err != nil {
+		t.Fatal(err)
+	}
+	recvMessage(t, near)
+	recvMessage(t, far)
+	select {
+	case got := <-far:
+		t.Fatalf("far member received %q", got.Body())
+	default:
+	}
+}
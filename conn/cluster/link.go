@@ -0,0 +1,183 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+
+	"github.com/chen102/ggbond/message"
+)
+
+// 节点间内部链路的消息类型，复用TCPMessage帧格式，路由ID即消息类型，消息体为json
+const (
+	HELLO   = 1 //握手，交换节点信息
+	PEERS   = 2 //交换已知节点列表
+	SYNC    = 3 //全量同步本节点目录
+	UPDATE  = 4 //增量更新本节点目录
+	FORWARD = 5 //转发消息
+	KICK    = 6 //踢下线
+	ROUTE   = 7 //转发路由消息到房间所在节点
+)
+
+type hello struct {
+	ID     string            `json:"id"`
+	Addr   string            `json:"addr"`
+	Peers  map[string]string `json:"peers"`
+	IDNode *int64            `json:"idnode,omitempty"` //连接ID生成器节点号
+}
+
+type directory struct {
+	Users []string `json:"users"`
+	Conns []int64  `json:"conns"`
+}
+
+// 目录更新操作
+const (
+	opbind    = "bind"
+	opunbind  = "unbind"
+	opaddconn = "addconn"
+	opdelconn = "delconn"
+)
+
+type update struct {
+	Op   string `json:"op"`
+	User string `json:"user,omitempty"`
+	Conn int64  `json:"conn,omitempty"`
+}
+
+// 转发目标类型
+const (
+	toconn  = "conn"
+	touser  = "user"
+	togroup = "group"
+)
+
+type forward struct {
+	To        string    `json:"to"`
+	Conn      int64     `json:"conn,omitempty"`
+	User      string    `json:"user,omitempty"`
+	GroupID   int32     `json:"gid,omitempty"`
+	GroupName string    `json:"gname,omitempty"`
+	From      int64     `json:"from,omitempty"`
+	Pos       *position `json:"pos,omitempty"` //发送者在分组AOI中的坐标
+	RouteID   int32     `json:"route"`
+	MsgID     int32     `json:"msg"`
+	Body      []byte    `json:"body"`
+}
+
+type position struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+}
+
+type route struct {
+	Route int32  `json:"route"`
+	Conn  int64  `json:"conn"`
+	MsgID int32  `json:"msg"`
+	Body  []byte `json:"body"`
+	Trace []byte `json:"trace,omitempty"` //链路上下文
+}
+
+type kick struct {
+	Conn   int64  `json:"conn,omitempty"`
+	User   string `json:"user,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// 经总线广播时附带来源节点，节点忽略自己发布的消息
+type envelope struct {
+	Node    string          `json:"node"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// link 节点间链路
+type link struct {
+	peer   string
+	addr   string
+	dialer string //发起连接的节点，两端同时建立链路时保留较小ID发起的链路
+	conn   net.Conn
+	reader *bufio.Reader
+	send   chan *message.TCPMessage
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newLink(conn net.Conn) *link {
+	return &link{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		send:   make(chan *message.TCPMessage, 1024),
+		closed: make(chan struct{}),
+	}
+}
+
+// 直接写入，只在握手阶段使用
+func (l *link) write(op int32, v interface{}) error {
+	msg, err := encode(op, v)
+	if err != nil {
+		return err
+	}
+	return msg.PackAndWrite(l.conn)
+}
+
+func (l *link) read() (*message.TCPMessage, error) {
+	msg := &message.TCPMessage{}
+	if err := msg.ReadAndUnpack(l.reader); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// 异步发送，链路已关闭或发送队列满时返回错误
+func (l *link) post(op int32, v interface{}) error {
+	msg, err := encode(op, v)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-l.closed:
+		return ErrorLinkClosed
+	default:
+	}
+	select {
+	case l.send <- msg:
+		return nil
+	default:
+		return ErrorLinkBusy
+	}
+}
+
+func (l *link) writeloop() {
+	writer := bufio.NewWriter(l.conn)
+	for {
+		select {
+		case <-l.closed:
+			return
+		case msg := <-l.send:
+			if err := msg.PackAndWrite(writer); err != nil {
+				l.close()
+				return
+			}
+		}
+	}
+}
+
+func (l *link) close() {
+	l.once.Do(func() {
+		close(l.closed)
+		l.conn.Close()
+	})
+}
+
+func encode(op int32, v interface{}) (*message.TCPMessage, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	msg := &message.TCPMessage{}
+	if err := msg.Write(body, 0, op); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/chen102/ggbond/conn/bus"
+)
+
+// ClusterOption 集群选项
+type ClusterOption func(options *clusteroptions) error
+type clusteroptions struct {
+	peers          map[string]string
+	gossipInterval *time.Duration
+	dialTimeout    *time.Duration
+	bus            bus.Bus
+	replicas       *int
+	router         RouteHandler
+	idnode         *int64
+}
+
+// peers:静态节点列表，格式 节点ID@ip:port
+func WithPeers(peers ...string) ClusterOption {
+	return func(options *clusteroptions) error {
+		if options.peers == nil {
+			options.peers = make(map[string]string)
+		}
+		for _, p := range peers {
+			id, addr, ok := strings.Cut(p, "@")
+			if !ok || id == "" || addr == "" {
+				return errors.New("peer is not valid:" + p)
+			}
+			options.peers[id] = addr
+		}
+		return nil
+	}
+}
+
+// gossipInterval:节点列表交换周期，同时用于重连断开的节点
+func WithGossipInterval(gossipInterval time.Duration) ClusterOption {
+	return func(options *clusteroptions) error {
+		if gossipInterval <= 0 {
+			return errors.New("gossipInterval is not valid")
+		}
+		options.gossipInterval = &gossipInterval
+		return nil
+	}
+}
+
+// dialTimeout:连接其他节点的超时时间
+func WithDialTimeout(dialTimeout time.Duration) ClusterOption {
+	return func(options *clusteroptions) error {
+		if dialTimeout <= 0 {
+			return errors.New("dialTimeout is not valid")
+		}
+		options.dialTimeout = &dialTimeout
+		return nil
+	}
+}
+
+// bus:消息总线，设置后分组广播与踢下线通知经总线发布，不再逐个链路发送
+func WithBus(b bus.Bus) ClusterOption {
+	return func(options *clusteroptions) error {
+		options.bus = b
+		return nil
+	}
+}
+
+// replicas:一致性哈希环上每个节点的虚拟节点数
+func WithReplicas(replicas int) ClusterOption {
+	return func(options *clusteroptions) error {
+		if replicas <= 0 {
+			return errors.New("replicas is not valid")
+		}
+		options.replicas = &replicas
+		return nil
+	}
+}
+
+// idnode:本节点连接ID生成器的节点号，握手时交换，与其他节点重复时拒绝建立链路
+func WithIDNode(idnode int64) ClusterOption {
+	return func(options *clusteroptions) error {
+		if idnode < 0 {
+			return errors.New("idnode is not valid")
+		}
+		options.idnode = &idnode
+		return nil
+	}
+}
+
+// router:本节点路由，处理其他节点转发来的房间消息
+func WithRouter(router RouteHandler) ClusterOption {
+	return func(options *clusteroptions) error {
+		options.router = router
+		return nil
+	}
+}
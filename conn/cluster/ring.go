@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Ring 一致性哈希环
+// 每个节点在环上放置replicas个虚拟节点，键顺时针归属第一个虚拟节点所在的节点，
+// 节点增减时只有落在变化区间内的键会更换归属
+type Ring struct {
+	mu       sync.RWMutex
+	replicas int
+	hashes   []uint32          //有序的虚拟节点哈希
+	owners   map[uint32]string //虚拟节点哈希 -> 节点ID
+	nodes    map[string]struct{}
+}
+
+// NewRing 创建一致性哈希环
+// replicas:每个节点的虚拟节点数
+func NewRing(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = 1
+	}
+	return &Ring{
+		replicas: replicas,
+		owners:   make(map[uint32]string),
+		nodes:    make(map[string]struct{}),
+	}
+}
+
+// Add 加入节点
+func (r *Ring) Add(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, node := range nodes {
+		if _, ok := r.nodes[node]; ok {
+			continue
+		}
+		r.nodes[node] = struct{}{}
+		r.place(node)
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Remove 移除节点
+// 按剩余节点重建环，冲突位置的归属与加入顺序无关
+func (r *Ring) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.nodes[node]; !ok {
+		return
+	}
+	delete(r.nodes, node)
+	r.hashes = r.hashes[:0]
+	r.owners = make(map[uint32]string, len(r.nodes)*r.replicas)
+	for other := range r.nodes {
+		r.place(other)
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// 放置节点的虚拟节点，调用方负责排序
+func (r *Ring) place(node string) {
+	for i := 0; i < r.replicas; i++ {
+		h := hash32([]byte(node + "#" + strconv.Itoa(i)))
+		//哈希冲突时保留ID较小的节点，保证各节点的环一致
+		if old, ok := r.owners[h]; ok {
+			if old < node {
+				continue
+			}
+		} else {
+			r.hashes = append(r.hashes, h)
+		}
+		r.owners[h] = node
+	}
+}
+
+// Get 查询键所属节点，环为空时返回false
+func (r *Ring) Get(key int32) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.hashes) == 0 {
+		return "", false
+	}
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(key))
+	h := hash32(buf[:])
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]], true
+}
+
+// Nodes 环上的节点
+func (r *Ring) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// FNV-1a后再做murmur3的fmix32，短键也能均匀分布
+func hash32(b []byte) uint32 {
+	f := fnv.New32a()
+	_, _ = f.Write(b)
+	h := f.Sum32()
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
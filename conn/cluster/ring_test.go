@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+const ringKeys = 10000
+
+func ringOwners(t *testing.T, r *Ring) map[int32]string {
+	t.Helper()
+	owners := make(map[int32]string, ringKeys)
+	for key := int32(0); key < ringKeys; key++ {
+		node, ok := r.Get(key)
+		if !ok {
+			t.Fatal("empty ring")
+		}
+		owners[key] = node
+	}
+	return owners
+}
+
+func TestRingMembershipChangeMovesAffectedKeysOnly(t *testing.T) {
+	r := NewRing(160)
+	r.Add("a", "b", "c")
+	before := ringOwners(t, r)
+
+	//新节点只接管键，其他节点之间不交换
+	r.Add("d")
+	added := ringOwners(t, r)
+	moved := 0
+	for key, node := range added {
+		if node != before[key] {
+			if node != "d" {
+				t.Fatalf("key %d moved from %s to %s after adding d", key, before[key], node)
+			}
+			moved++
+		}
+	}
+	//约四分之一的键迁移到新节点
+	if moved < ringKeys/8 || moved > ringKeys*3/8 {
+		t.Fatalf("%d of %d keys moved to d", moved, ringKeys)
+	}
+
+	//移除节点只迁移该节点的键
+	r.Remove("b")
+	removed := ringOwners(t, r)
+	for key, node := range removed {
+		if node != added[key] && added[key] != "b" {
+			t.Fatalf("key %d moved from %s to %s after removing b", key, added[key], node)
+		}
+		if node == "b" {
+			t.Fatalf("key %d still owned by removed node", key)
+		}
+	}
+
+	//移除新节点后恢复原来的归属
+	r.Add("b")
+	r.Remove("d")
+	if !reflect.DeepEqual(ringOwners(t, r), before) {
+		t.Fatal("owners changed after adding and removing d")
+	}
+}
+
+func TestRingDeterministic(t *testing.T) {
+	//加入、移除顺序不同的环归属一致
+	r1 := NewRing(160)
+	r1.Add("a", "b", "c", "d")
+	r1.Remove("b")
+	r2 := NewRing(160)
+	r2.Add("d")
+	r2.Add("c", "b")
+	r2.Remove("b")
+	r2.Add("a")
+	if !reflect.DeepEqual(ringOwners(t, r1), ringOwners(t, r2)) {
+		t.Fatal("rings built in different orders disagree")
+	}
+	if nodes := r1.Nodes(); !reflect.DeepEqual(nodes, []string{"a", "c", "d"}) {
+		t.Fatalf("nodes %v", nodes)
+	}
+}
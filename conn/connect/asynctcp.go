@@ -3,39 +3,40 @@ package connect
 //使用epoll
 import (
 	"io"
-	"log"
 	"time"
+
+	"github.com/chen102/ggbond/conn/logger"
 )
 
 type AsyncTcpConn struct {
 	fd               int
-	connID           int32
+	connID           int64
 	connType         string
 	lastactivatetime int64
 	r                io.Reader
 	w                io.Writer
 	sendChan         chan IMessage
 	close            chan error
+	attrs            *Attributes
 }
 
-func NewAsyncTcpConn(fd int, connID int32, connType string) *AsyncTcpConn {
-	return &AsyncTcpConn{}
+func NewAsyncTcpConn(fd int, connID int64, connType string) *AsyncTcpConn {
+	return &AsyncTcpConn{attrs: NewAttributes()}
 }
 func (t *AsyncTcpConn) ConnType() (string, error) {
 	return t.connType, nil
 }
-func (t *AsyncTcpConn) ConnID() int32 {
+func (t *AsyncTcpConn) ConnID() int64 {
 	return t.connID
 }
 func (t *AsyncTcpConn) Conn() (interface{}, error) {
 	return t.fd, nil
 }
 func (t *AsyncTcpConn) CheckHealth(timeout int64) bool {
-	log.Println("check health:", t.connID)
 	return time.Now().Unix()-t.lastactivatetime < timeout
 }
 func (t *AsyncTcpConn) Close(err error) error {
-	log.Println("连接关闭:", t.connID)
+	logger.L().Debug("conn close", "conn", t.connID, "reason", err)
 	return nil
 }
 func (t *AsyncTcpConn) WaitForClosed() chan error {
@@ -53,6 +54,9 @@ func (t *AsyncTcpConn) Reader() io.Reader {
 func (t *AsyncTcpConn) UpdateLastActiveTime() {
 	t.lastactivatetime = time.Now().Unix()
 }
+func (t *AsyncTcpConn) LastActiveTime() int64 {
+	return t.lastactivatetime
+}
 func (t *AsyncTcpConn) SendMessage(msg IMessage) error {
 	t.sendChan <- msg
 	return nil
@@ -66,3 +70,6 @@ func (t *AsyncTcpConn) Stat() ConnStat {
 func (c *AsyncTcpConn) SetStat(stat ConnStat) {
 	return
 }
+func (c *AsyncTcpConn) Attrs() *Attributes {
+	return c.attrs
+}
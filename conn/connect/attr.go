@@ -0,0 +1,161 @@
+package connect
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Serializer 属性序列化器，会话恢复或跨节点迁移时使用
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONSerializer json序列化，反序列化后数字为float64，可通过类型辅助方法读取
+type JSONSerializer struct{}
+
+func (JSONSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+func (JSONSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Attributes 连接属性，并发安全
+// 用于在连接上保存登录后的业务数据，例如玩家名、角色、所在房间
+type Attributes struct {
+	mu sync.RWMutex
+	m  map[string]interface{}
+}
+
+func NewAttributes() *Attributes {
+	return &Attributes{
+		m: make(map[string]interface{}),
+	}
+}
+
+func (a *Attributes) Set(key string, value interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.m[key] = value
+}
+func (a *Attributes) Get(key string) (interface{}, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	v, ok := a.m[key]
+	return v, ok
+}
+func (a *Attributes) Delete(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.m, key)
+}
+
+// Keys 获取全部属性名
+func (a *Attributes) Keys() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	keys := make([]string, 0, len(a.m))
+	for k := range a.m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (a *Attributes) GetString(key string) (string, bool) {
+	return GetAttr[string](a, key)
+}
+func (a *Attributes) GetBool(key string) (bool, bool) {
+	return GetAttr[bool](a, key)
+}
+
+// GetInt64 读取整数属性，兼容反序列化后的float64
+func (a *Attributes) GetInt64(key string) (int64, bool) {
+	v, ok := a.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+func (a *Attributes) GetInt32(key string) (int32, bool) {
+	n, ok := a.GetInt64(key)
+	return int32(n), ok
+}
+func (a *Attributes) GetInt(key string) (int, bool) {
+	n, ok := a.GetInt64(key)
+	return int(n), ok
+}
+func (a *Attributes) GetFloat64(key string) (float64, bool) {
+	v, ok := a.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	if i, ok := a.GetInt64(key); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// Export 序列化全部属性
+func (a *Attributes) Export(s Serializer) (map[string][]byte, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	res := make(map[string][]byte, len(a.m))
+	for k, v := range a.m {
+		data, err := s.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("export attribute %s:%w", k, err)
+		}
+		res[k] = data
+	}
+	return res, nil
+}
+
+// Import 反序列化属性，已存在的同名属性将被覆盖
+func (a *Attributes) Import(s Serializer, data map[string][]byte) error {
+	values := make(map[string]interface{}, len(data))
+	for k, raw := range data {
+		var v interface{}
+		if err := s.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("import attribute %s:%w", k, err)
+		}
+		values[k] = v
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, v := range values {
+		a.m[k] = v
+	}
+	return nil
+}
+
+// GetAttr 按类型读取属性，类型不匹配时返回false
+func GetAttr[T any](a *Attributes, key string) (T, bool) {
+	v, ok := a.Get(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	t, ok := v.(T)
+	return t, ok
+}
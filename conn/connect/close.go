@@ -0,0 +1,136 @@
+package connect
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// DISCONNECT 断开通知路由，服务端关闭连接前发送
+// 消息体:关闭原因(4字节 大端序)、说明文字(UTF-8)
+const DISCONNECT = 11
+
+// CloseReason 连接关闭原因，取值即断开通知中的原因码，只可追加
+type CloseReason int32
+
+const (
+	CloseUnknown       CloseReason = iota //未分类
+	CloseNormal                           //客户端关闭或连接已断开
+	CloseKicked                           //被踢下线(运维接口、集群、网关后端、会话在其他连接恢复)
+	CloseTimeout                          //连接、读写超时
+	CloseHeartbeat                        //健康检查失败
+	CloseServerStop                       //服务器停止或重启
+	CloseRejected                         //被拒绝(钩子、连接数上限)
+	CloseProtocolError                    //消息格式错误
+	CloseWriteError                       //写失败
+	CloseInternal                         //服务端内部错误
+	CloseRateLimited                      //消息超过限速或远端IP被封禁
+)
+
+func (r CloseReason) String() string {
+	switch r {
+	case CloseNormal:
+		return "normal"
+	case CloseKicked:
+		return "kicked"
+	case CloseTimeout:
+		return "timeout"
+	case CloseHeartbeat:
+		return "heartbeat"
+	case CloseServerStop:
+		return "server_stop"
+	case CloseRejected:
+		return "rejected"
+	case CloseProtocolError:
+		return "protocol_error"
+	case CloseWriteError:
+		return "write_error"
+	case CloseInternal:
+		return "internal"
+	case CloseRateLimited:
+		return "rate_limited"
+	}
+	return "unknown"
+}
+
+// Notify 是否向客户端发送断开通知，连接已断开或不可写时不发送
+func (r CloseReason) Notify() bool {
+	return r != CloseNormal && r != CloseWriteError
+}
+
+// CloseError 带原因的关闭错误
+// Message为发给客户端的说明，为空时使用原因名；Err为服务端内部的详细错误，不发给客户端
+type CloseError struct {
+	Reason  CloseReason
+	Message string
+	Err     error
+}
+
+// NewCloseError 创建关闭错误
+func NewCloseError(reason CloseReason, message string, err error) *CloseError {
+	return &CloseError{Reason: reason, Message: message, Err: err}
+}
+
+func (e *CloseError) Error() string {
+	s := e.Reason.String()
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *CloseError) Unwrap() error {
+	return e.Err
+}
+
+// AsCloseError 取得err中的关闭错误，没有时按错误类型归类
+func AsCloseError(err error) *CloseError {
+	var ce *CloseError
+	if errors.As(err, &ce) {
+		return ce
+	}
+	var operr net.Error
+	switch {
+	case err == nil, errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, net.ErrClosed), errors.Is(err, syscall.ECONNRESET):
+		return NewCloseError(CloseNormal, "", err)
+	case errors.As(err, &operr) && operr.Timeout():
+		return NewCloseError(CloseTimeout, "", err)
+	case errors.Is(err, ErrorHook):
+		return NewCloseError(CloseRejected, "", err)
+	}
+	return NewCloseError(CloseUnknown, "", err)
+}
+
+// ReasonOf 关闭原因
+func ReasonOf(err error) CloseReason {
+	return AsCloseError(err).Reason
+}
+
+// NewDisconnectMessage 创建断开通知消息
+func NewDisconnectMessage(conntype string, ce *CloseError) (IMessage, error) {
+	text := ce.Message
+	if text == "" {
+		text = ce.Reason.String()
+	}
+	body := make([]byte, 4+len(text))
+	binary.BigEndian.PutUint32(body, uint32(ce.Reason))
+	copy(body[4:], text)
+	msg := NewMessage(conntype)
+	if err := msg.Write(body, 0, DISCONNECT); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ParseDisconnect 解析断开通知消息体
+func ParseDisconnect(body []byte) (CloseReason, string, error) {
+	if len(body) < 4 {
+		return CloseUnknown, "", errors.New("disconnect body is too short")
+	}
+	return CloseReason(binary.BigEndian.Uint32(body)), string(body[4:]), nil
+}
@@ -0,0 +1,132 @@
+package connect
+
+import (
+	"errors"
+	"net"
+)
+
+// ErrorHook 钩子拒绝连接或消息，连接以此错误关闭
+var ErrorHook = errors.New("hook error")
+
+// 连接生命周期中的可选阶段，钩子按需实现，服务器按接口断言调用
+// 返回错误的阶段(BeforeAccept AfterConn OnMessage)出错时关闭连接，其余阶段只做通知
+
+// AcceptHook 分配连接ID之前调用，返回错误时直接关闭底层连接
+type AcceptHook interface {
+	BeforeAccept(remoteAddr net.Addr) error
+}
+
+// MessageHook 消息分发到路由之前调用，在读协程中执行
+type MessageHook interface {
+	OnMessage(conn ITCPConn, msg IMessage) error
+}
+
+// SendHook 消息写出后调用，在写协程中执行
+type SendHook interface {
+	OnSend(conn ITCPConn, msg IMessage)
+}
+
+// HealthHook 健康检查状态变化时调用
+type HealthHook interface {
+	OnHealthStateChange(conn ITCPConn, from, to ConnStat)
+}
+
+// CloseHook 连接从管理器移除并关闭后调用，AfterConn之前被拒绝的连接不会调用
+// err为*CloseError，包含发给客户端的说明与服务端的详细错误
+type CloseHook interface {
+	OnClose(conn ITCPConn, reason CloseReason, err error)
+}
+
+// StopHook 服务器停止时调用
+type StopHook interface {
+	OnServerStop()
+}
+
+// NopHook 空钩子，只关心部分阶段的钩子嵌入它以满足Hook接口
+type NopHook struct{}
+
+func (NopHook) AfterConn(ITCPConn) error {
+	return nil
+}
+
+// Hooks 组合多个钩子，各阶段按顺序调用实现了该阶段的钩子
+// 返回错误的阶段在第一个错误处停止
+type Hooks []Hook
+
+// ChainHook 组合钩子，忽略nil，嵌套的Hooks展开
+func ChainHook(hooks ...Hook) Hooks {
+	var hs Hooks
+	for _, h := range hooks {
+		switch x := h.(type) {
+		case nil:
+		case Hooks:
+			hs = append(hs, x...)
+		default:
+			hs = append(hs, h)
+		}
+	}
+	return hs
+}
+
+func (hs Hooks) BeforeAccept(remoteAddr net.Addr) error {
+	for _, h := range hs {
+		if a, ok := h.(AcceptHook); ok {
+			if err := a.BeforeAccept(remoteAddr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (hs Hooks) AfterConn(conn ITCPConn) error {
+	for _, h := range hs {
+		if err := h.AfterConn(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hs Hooks) OnMessage(conn ITCPConn, msg IMessage) error {
+	for _, h := range hs {
+		if m, ok := h.(MessageHook); ok {
+			if err := m.OnMessage(conn, msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (hs Hooks) OnSend(conn ITCPConn, msg IMessage) {
+	for _, h := range hs {
+		if s, ok := h.(SendHook); ok {
+			s.OnSend(conn, msg)
+		}
+	}
+}
+
+func (hs Hooks) OnHealthStateChange(conn ITCPConn, from, to ConnStat) {
+	for _, h := range hs {
+		if hh, ok := h.(HealthHook); ok {
+			hh.OnHealthStateChange(conn, from, to)
+		}
+	}
+}
+
+func (hs Hooks) OnClose(conn ITCPConn, reason CloseReason, err error) {
+	for _, h := range hs {
+		if c, ok := h.(CloseHook); ok {
+			c.OnClose(conn, reason, err)
+		}
+	}
+}
+
+func (hs Hooks) OnServerStop() {
+	for _, h := range hs {
+		if s, ok := h.(StopHook); ok {
+			s.OnServerStop()
+		}
+	}
+}
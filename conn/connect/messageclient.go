@@ -14,6 +14,8 @@ type IMessage interface {
 	RouteID() int32
 	Length() int32
 	Write(body []byte, messageID int32, routeID int32) error
+	TraceContext() []byte
+	SetTraceContext(trace []byte) error
 	Reset()
 }
 
@@ -1,12 +1,19 @@
 package connect
 
 import (
+	"errors"
 	"io"
-	"log"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/chen102/ggbond/conn/logger"
+	"github.com/chen102/ggbond/conn/trace"
 )
 
+var ErrorSendQueueFull = errors.New("send queue full")
+
 type ConnStat int
 
 const (
@@ -15,9 +22,21 @@ const (
 	ACTIVE
 )
 
+func (s ConnStat) String() string {
+	switch s {
+	case ACTIVE:
+		return "active"
+	case TIMEOUT:
+		return "timeout"
+	case CLOSE:
+		return "close"
+	}
+	return "removed"
+}
+
 type TCP struct {
 	conn             net.Conn
-	connID           int32
+	connID           int64
 	connType         string
 	lastactivatetime int64
 	r                io.Reader
@@ -25,10 +44,27 @@ type TCP struct {
 	sendChan         chan IMessage
 	close            chan error
 	stat             ConnStat
+	attrs            *Attributes
+	ondrop           func(IMessage)
+	tracectx         atomic.Pointer[trace.SpanContext]
+	wmu              sync.Mutex //写出整帧期间持有
+}
+
+// WriteLocker 写协程写出整帧期间持有写锁，关闭连接时据此判断能否安全写出断开通知
+type WriteLocker interface {
+	WriteLock() sync.Locker
+}
+
+// TracedMessage 处理采样请求期间发送的消息，写出时记录send跨度并关联到该请求
+// 写出的内容与原消息一致，不携带链路上下文
+type TracedMessage struct {
+	IMessage
+	Parent   trace.SpanContext
+	Enqueued time.Time
 }
 
 // 初始化一个TCP连接
-func NewTCPConn(conn net.Conn, connID int32, connType string) *TCP {
+func NewTCPConn(conn net.Conn, connID int64, connType string) *TCP {
 	return &TCP{
 		conn:             conn,
 		connID:           connID,
@@ -37,8 +73,9 @@ func NewTCPConn(conn net.Conn, connID int32, connType string) *TCP {
 		r:                conn,
 		w:                conn,
 		sendChan:         make(chan IMessage, 100),
-		close:            make(chan error),
+		close:            make(chan error, 1),
 		stat:             ACTIVE,
+		attrs:            NewAttributes(),
 	}
 }
 
@@ -58,7 +95,7 @@ func (c *TCP) ConnType() (string, error) {
 }
 
 // 获取连接ID
-func (c *TCP) ConnID() int32 {
+func (c *TCP) ConnID() int64 {
 	return c.connID
 }
 
@@ -69,16 +106,29 @@ func (c *TCP) Conn() (interface{}, error) {
 
 // 检查连接是否健康 timeout:超时时间 单位秒
 func (c *TCP) CheckHealth(timeout int64) bool {
-	log.Println("check health:", c.connID)
 	return time.Now().Unix()-c.lastactivatetime < timeout
 }
 
-// 关闭连接
+// 关闭连接，需要通知客户端的关闭原因先发送断开通知
+// 写协程正在写出时不发送通知，避免与其写入交错，直接关闭连接使其退出
 func (c *TCP) Close(err error) error {
-	log.Println("连接关闭:", c.connID)
+	ce := AsCloseError(err)
+	logger.L().Debug("conn close", "conn", c.connID, "reason", ce.Reason.String(), "error", err)
+	if ce.Reason.Notify() && c.wmu.TryLock() {
+		if msg, e := NewDisconnectMessage(c.connType, ce); e == nil {
+			_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			_ = msg.PackAndWrite(c.conn)
+		}
+		c.wmu.Unlock()
+	}
 	return c.conn.Close()
 }
 
+// WriteLock 写锁，写协程写出每一帧时持有
+func (c *TCP) WriteLock() sync.Locker {
+	return &c.wmu
+}
+
 //两种不同的超时方式 1.通过系统路由心跳命令，更新上次活动时间，每一段时间检查一次，判断是否超时（业务实现）
 //2.通过net.Conn.SetDeadline()设置超时时间，每次读写都会更新超时时间，判断是否超时（底层实现)
 func (c *TCP) SetDeadline(i int64) error {
@@ -99,10 +149,40 @@ func (c *TCP) UpdateLastActiveTime() {
 	c.lastactivatetime = time.Now().Unix()
 }
 
-// 发送消息
+// 最后活跃时间 unix秒
+func (c *TCP) LastActiveTime() int64 {
+	return c.lastactivatetime
+}
+
+// 发送消息，发送队列满时丢弃并返回ErrorSendQueueFull，不阻塞调用方
 func (c *TCP) SendMessage(msg IMessage) error {
-	c.sendChan <- msg
-	return nil
+	if sc := c.tracectx.Load(); sc != nil {
+		msg = &TracedMessage{IMessage: msg, Parent: *sc, Enqueued: time.Now()}
+	}
+	select {
+	case c.sendChan <- msg:
+		return nil
+	default:
+		if c.ondrop != nil {
+			c.ondrop(msg)
+		}
+		return ErrorSendQueueFull
+	}
+}
+
+// SetTraceContext 设置当前处理中请求的链路上下文，期间发送的消息关联到该请求
+// 未采样或无效的上下文清除关联
+func (c *TCP) SetTraceContext(sc trace.SpanContext) {
+	if !sc.IsValid() || !sc.Sampled {
+		c.tracectx.Store(nil)
+		return
+	}
+	c.tracectx.Store(&sc)
+}
+
+// OnDrop 设置发送队列满丢弃消息时的回调，需在连接开始收发前设置
+func (c *TCP) OnDrop(f func(IMessage)) {
+	c.ondrop = f
 }
 
 // 获取消息通道
@@ -115,9 +195,12 @@ func (c *TCP) WaitForClosed() chan error {
 	return c.close
 }
 
-// 通知连接关闭
+// 通知连接关闭，只保留第一个关闭原因，不阻塞调用方
 func (c *TCP) SignalClose(err error) {
-	c.close <- err
+	select {
+	case c.close <- err:
+	default:
+	}
 }
 func (c *TCP) Stat() ConnStat {
 	return c.stat
@@ -125,3 +208,13 @@ func (c *TCP) Stat() ConnStat {
 func (c *TCP) SetStat(stat ConnStat) {
 	c.stat = stat
 }
+
+// 获取连接属性
+func (c *TCP) Attrs() *Attributes {
+	return c.attrs
+}
+
+// 获取客户端地址
+func (c *TCP) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
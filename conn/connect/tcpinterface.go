@@ -8,7 +8,7 @@ import (
 // ITCPConn 接口定义了连接的基本操作。
 type ITCPConn interface {
 	ConnType() (string, error)
-	ConnID() int32
+	ConnID() int64
 	Conn() (interface{}, error)
 	CheckHealth(timeout int64) bool
 	Close(err error) error
@@ -17,6 +17,7 @@ type ITCPConn interface {
 	Sender() io.Writer
 	Reader() io.Reader
 	UpdateLastActiveTime()
+	LastActiveTime() int64
 	SendMessage(IMessage) error
 	MessageChan() chan IMessage
 	Stat() ConnStat
@@ -24,14 +25,17 @@ type ITCPConn interface {
 	SetDeadline(t int64) error
 	SetReadDeadline(t int64) error
 	SetWriteDeadline(t int64) error
+	Attrs() *Attributes
+	RemoteAddr() net.Addr //客户端地址，经PROXY协议时为代理传来的地址，未知时为nil
 }
 
+// Hook 连接钩子，其余生命周期阶段见hook.go中的可选接口
 type Hook interface {
 	AfterConn(ITCPConn) error
 }
 
 // NewConn 创建一个新的连接。
-func NewConn(conn interface{}, connID int32, conntype string) ITCPConn {
+func NewConn(conn interface{}, connID int64, conntype string) ITCPConn {
 	switch conntype {
 	case "tcp":
 		return NewTCPConn(conn.(net.Conn), connID, conntype)
@@ -0,0 +1,299 @@
+package connmanage
+
+import (
+	"errors"
+	"math"
+	"sync"
+)
+
+// AOIEvent AOI事件类型
+type AOIEvent int32
+
+const (
+	AOIENTER AOIEvent = iota + 1 //实体进入视野
+	AOIMOVE                      //视野内实体移动
+	AOILEAVE                     //实体离开视野
+)
+
+var (
+	ErrorAOIEntityExists   = errors.New("aoi entity already exists")
+	ErrorAOIEntityNotFound = errors.New("aoi entity not exists")
+)
+
+// AOIHandle AOI事件回调
+// watcher:关注该事件的连接ID entity:产生事件的实体ID x,y:实体当前坐标
+type AOIHandle func(event AOIEvent, watcher, entity int64, x, y float32)
+
+// AOI 感兴趣区域管理器，实体ID即连接ID
+type AOI interface {
+	Enter(id int64, x, y, radius float32) error
+	Move(id int64, x, y float32) error
+	Leave(id int64) error
+	Watchers(id int64) ([]int64, error)
+	WatchersAt(x, y float32) []int64
+	Position(id int64) (x, y float32, err error)
+	SetHandle(AOIHandle)
+}
+
+type aoiEntity struct {
+	id     int64
+	x, y   float32
+	radius float32 //视野半径
+	cell   int
+}
+
+// GridAOI 网格AOI
+// 地图按cellsize切分为网格，查询时只扫描半径覆盖的网格
+type GridAOI struct {
+	mu        sync.RWMutex
+	minx      float32
+	miny      float32
+	cellsize  float32
+	cols      int
+	rows      int
+	maxradius float32 //出现过的最大视野半径，用于确定"谁能看到我"的扫描范围
+	cells     map[int]map[int64]*aoiEntity
+	entities  map[int64]*aoiEntity
+	handle    AOIHandle
+}
+
+// NewGridAOI 创建一个网格AOI
+// minx,miny,maxx,maxy:地图边界 cellsize:网格边长，一般取常用视野半径
+func NewGridAOI(minx, miny, maxx, maxy, cellsize float32) *GridAOI {
+	if maxx <= minx || maxy <= miny || cellsize <= 0 {
+		panic("aoi bounds is not valid")
+	}
+	return &GridAOI{
+		minx:     minx,
+		miny:     miny,
+		cellsize: cellsize,
+		cols:     int(math.Ceil(float64((maxx - minx) / cellsize))),
+		rows:     int(math.Ceil(float64((maxy - miny) / cellsize))),
+		cells:    make(map[int]map[int64]*aoiEntity),
+		entities: make(map[int64]*aoiEntity),
+	}
+}
+
+// SetHandle 设置事件回调
+func (a *GridAOI) SetHandle(h AOIHandle) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handle = h
+}
+
+// Enter 实体进入地图
+// radius:该实体(连接)的视野半径
+func (a *GridAOI) Enter(id int64, x, y, radius float32) error {
+	a.mu.Lock()
+	if _, ok := a.entities[id]; ok {
+		a.mu.Unlock()
+		return ErrorAOIEntityExists
+	}
+	e := &aoiEntity{id: id, x: x, y: y, radius: radius}
+	if radius > a.maxradius {
+		a.maxradius = radius
+	}
+	a.place(e)
+	var events []aoiNotify
+	for _, other := range a.around(x, y, a.maxradius) {
+		if other.id == id {
+			continue
+		}
+		if other.sees(e) {
+			events = append(events, aoiNotify{AOIENTER, other.id, e.id, e.x, e.y})
+		}
+		if e.sees(other) {
+			events = append(events, aoiNotify{AOIENTER, e.id, other.id, other.x, other.y})
+		}
+	}
+	h := a.handle
+	a.mu.Unlock()
+	notify(h, events)
+	return nil
+}
+
+// Move 实体移动
+// 视野外->视野内 触发ENTER，视野内->视野外 触发LEAVE，视野内移动触发MOVE
+func (a *GridAOI) Move(id int64, x, y float32) error {
+	a.mu.Lock()
+	e, ok := a.entities[id]
+	if !ok {
+		a.mu.Unlock()
+		return ErrorAOIEntityNotFound
+	}
+	scan := a.maxradius
+	before := make(map[int64]*aoiEntity)
+	for _, other := range a.around(e.x, e.y, scan) {
+		if other.id != id {
+			before[other.id] = other
+		}
+	}
+	old := *e
+	delete(a.cells[e.cell], id)
+	e.x, e.y = x, y
+	a.place(e)
+
+	var events []aoiNotify
+	for _, other := range a.around(x, y, scan) {
+		if other.id == id {
+			continue
+		}
+		delete(before, other.id)
+		sawbefore, seesnow := other.sees(&old), other.sees(e)
+		switch {
+		case seesnow && sawbefore:
+			events = append(events, aoiNotify{AOIMOVE, other.id, e.id, e.x, e.y})
+		case seesnow:
+			events = append(events, aoiNotify{AOIENTER, other.id, e.id, e.x, e.y})
+		case sawbefore:
+			events = append(events, aoiNotify{AOILEAVE, other.id, e.id, e.x, e.y})
+		}
+		sawbefore, seesnow = old.sees(other), e.sees(other)
+		if seesnow && !sawbefore {
+			events = append(events, aoiNotify{AOIENTER, e.id, other.id, other.x, other.y})
+		} else if sawbefore && !seesnow {
+			events = append(events, aoiNotify{AOILEAVE, e.id, other.id, other.x, other.y})
+		}
+	}
+	//移动后扫描不到的实体，若原先互相可见则离开视野
+	for _, other := range before {
+		if other.sees(&old) {
+			events = append(events, aoiNotify{AOILEAVE, other.id, e.id, e.x, e.y})
+		}
+		if old.sees(other) {
+			events = append(events, aoiNotify{AOILEAVE, e.id, other.id, other.x, other.y})
+		}
+	}
+	h := a.handle
+	a.mu.Unlock()
+	notify(h, events)
+	return nil
+}
+
+// Leave 实体离开地图
+func (a *GridAOI) Leave(id int64) error {
+	a.mu.Lock()
+	e, ok := a.entities[id]
+	if !ok {
+		a.mu.Unlock()
+		return ErrorAOIEntityNotFound
+	}
+	delete(a.cells[e.cell], id)
+	delete(a.entities, id)
+	var events []aoiNotify
+	for _, other := range a.around(e.x, e.y, a.maxradius) {
+		if other.sees(e) {
+			events = append(events, aoiNotify{AOILEAVE, other.id, e.id, e.x, e.y})
+		}
+	}
+	h := a.handle
+	a.mu.Unlock()
+	notify(h, events)
+	return nil
+}
+
+// Watchers 获取视野内能看到该实体的连接
+func (a *GridAOI) Watchers(id int64) ([]int64, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	e, ok := a.entities[id]
+	if !ok {
+		return nil, ErrorAOIEntityNotFound
+	}
+	return a.watchers(e), nil
+}
+
+// WatchersAt 获取视野覆盖坐标的连接，用于不在本AOI中的实体(例如其他节点上的发送者)
+func (a *GridAOI) WatchersAt(x, y float32) []int64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.watchers(&aoiEntity{id: math.MinInt64, x: x, y: y})
+}
+
+// Position 获取实体坐标
+func (a *GridAOI) Position(id int64) (float32, float32, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	e, ok := a.entities[id]
+	if !ok {
+		return 0, 0, ErrorAOIEntityNotFound
+	}
+	return e.x, e.y, nil
+}
+
+func (a *GridAOI) watchers(e *aoiEntity) []int64 {
+	var watchers []int64
+	for _, other := range a.around(e.x, e.y, a.maxradius) {
+		if other.id != e.id && other.sees(e) {
+			watchers = append(watchers, other.id)
+		}
+	}
+	return watchers
+}
+
+func (a *GridAOI) place(e *aoiEntity) {
+	e.cell = a.cellindex(a.cellpos(e.x, e.y))
+	if _, ok := a.cells[e.cell]; !ok {
+		a.cells[e.cell] = make(map[int64]*aoiEntity)
+	}
+	a.cells[e.cell][e.id] = e
+	a.entities[e.id] = e
+}
+
+// 获取坐标所在网格，越界坐标归入边缘网格
+func (a *GridAOI) cellpos(x, y float32) (int, int) {
+	cx := int((x - a.minx) / a.cellsize)
+	cy := int((y - a.miny) / a.cellsize)
+	return clamp(cx, 0, a.cols-1), clamp(cy, 0, a.rows-1)
+}
+
+func (a *GridAOI) cellindex(cx, cy int) int {
+	return cy*a.cols + cx
+}
+
+// 半径范围内所有网格中的实体
+func (a *GridAOI) around(x, y, radius float32) []*aoiEntity {
+	x0, y0 := a.cellpos(x-radius, y-radius)
+	x1, y1 := a.cellpos(x+radius, y+radius)
+	var res []*aoiEntity
+	for cy := y0; cy <= y1; cy++ {
+		for cx := x0; cx <= x1; cx++ {
+			for _, e := range a.cells[a.cellindex(cx, cy)] {
+				res = append(res, e)
+			}
+		}
+	}
+	return res
+}
+
+func (e *aoiEntity) sees(other *aoiEntity) bool {
+	dx, dy := e.x-other.x, e.y-other.y
+	return dx*dx+dy*dy <= e.radius*e.radius
+}
+
+type aoiNotify struct {
+	event   AOIEvent
+	watcher int64
+	entity  int64
+	x, y    float32
+}
+
+// 回调在锁外执行，防止回调中再次操作AOI死锁
+func notify(h AOIHandle, events []aoiNotify) {
+	if h == nil {
+		return
+	}
+	for _, n := range events {
+		h(n.event, n.watcher, n.entity, n.x, n.y)
+	}
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
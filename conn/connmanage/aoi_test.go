@@ -0,0 +1,194 @@
+package connmanage
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type aoiRecord struct {
+	event           AOIEvent
+	watcher, entity int64
+}
+
+// 记录事件的AOI
+func newTestAOI() (*GridAOI, *[]aoiRecord) {
+	aoi := NewGridAOI(0, 0, 1000, 1000, 50)
+	var events []aoiRecord
+	aoi.SetHandle(func(event AOIEvent, watcher, entity int64, x, y float32) {
+		events = append(events, aoiRecord{event, watcher, entity})
+	})
+	return aoi, &events
+}
+
+// 取出并清空已记录的事件，按观察者、实体排序
+func takeEvents(events *[]aoiRecord) []aoiRecord {
+	res := *events
+	*events = nil
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].watcher != res[j].watcher {
+			return res[i].watcher < res[j].watcher
+		}
+		return res[i].entity < res[j].entity
+	})
+	return res
+}
+
+func expectEvents(t *testing.T, events *[]aoiRecord, want ...aoiRecord) {
+	t.Helper()
+	got := takeEvents(events)
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events %v, want %v", got, want)
+	}
+}
+
+func TestGridAOIEnter(t *testing.T) {
+	aoi, events := newTestAOI()
+	if err := aoi.Enter(1, 100, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events)
+	//视野半径不对称:1能看到2，2看不到1
+	if err := aoi.Enter(2, 150, 100, 10); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events, aoiRecord{AOIENTER, 1, 2})
+	//视野外进入不产生事件
+	if err := aoi.Enter(3, 900, 900, 100); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events)
+	if err := aoi.Enter(1, 0, 0, 1); !errors.Is(err, ErrorAOIEntityExists) {
+		t.Fatalf("enter twice: %v", err)
+	}
+	if watchers, err := aoi.Watchers(2); err != nil || !reflect.DeepEqual(watchers, []int64{1}) {
+		t.Fatalf("watchers of 2: %v %v", watchers, err)
+	}
+	if watchers, err := aoi.Watchers(1); err != nil || len(watchers) != 0 {
+		t.Fatalf("watchers of 1: %v %v", watchers, err)
+	}
+}
+
+func TestGridAOIMove(t *testing.T) {
+	aoi, events := newTestAOI()
+	for _, e := range []struct {
+		id        int64
+		x, y, rad float32
+	}{{1, 100, 100, 100}, {2, 150, 100, 100}} {
+		if err := aoi.Enter(e.id, e.x, e.y, e.rad); err != nil {
+			t.Fatal(err)
+		}
+	}
+	takeEvents(events)
+	//视野内移动
+	if err := aoi.Move(2, 160, 100); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events, aoiRecord{AOIMOVE, 1, 2})
+	//移出视野，双方互相离开
+	if err := aoi.Move(2, 600, 600); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events, aoiRecord{AOILEAVE, 1, 2}, aoiRecord{AOILEAVE, 2, 1})
+	//视野外移动不产生事件
+	if err := aoi.Move(2, 700, 700); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events)
+	//移入视野，双方互相进入
+	if err := aoi.Move(2, 120, 100); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events, aoiRecord{AOIENTER, 1, 2}, aoiRecord{AOIENTER, 2, 1})
+	if x, y, err := aoi.Position(2); err != nil || x != 120 || y != 100 {
+		t.Fatalf("position %v %v %v", x, y, err)
+	}
+	if err := aoi.Move(3, 0, 0); !errors.Is(err, ErrorAOIEntityNotFound) {
+		t.Fatalf("move missing entity: %v", err)
+	}
+}
+
+func TestGridAOILeave(t *testing.T) {
+	aoi, events := newTestAOI()
+	if err := aoi.Enter(1, 100, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := aoi.Enter(2, 150, 100, 10); err != nil {
+		t.Fatal(err)
+	}
+	takeEvents(events)
+	//只通知能看到离开者的实体
+	if err := aoi.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events)
+	if err := aoi.Leave(2); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events)
+	if err := aoi.Enter(1, 100, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := aoi.Enter(2, 150, 100, 10); err != nil {
+		t.Fatal(err)
+	}
+	takeEvents(events)
+	if err := aoi.Leave(2); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events, aoiRecord{AOILEAVE, 1, 2})
+	if _, err := aoi.Watchers(2); !errors.Is(err, ErrorAOIEntityNotFound) {
+		t.Fatalf("watchers of left entity: %v", err)
+	}
+	if err := aoi.Leave(2); !errors.Is(err, ErrorAOIEntityNotFound) {
+		t.Fatalf("leave twice: %v", err)
+	}
+}
+
+func TestGroupReceiversAt(t *testing.T) {
+	groups := NewConnGroup()
+	room := testRoom{}
+	if err := groups.AddGroup(room); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{1, 2, 3} {
+		if err := groups.AddConnToGroup(room, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//未绑定AOI时为全部成员
+	if ids, err := groups.ReceiversAt(room, 0, 0); err != nil || len(ids) != 3 {
+		t.Fatalf("receivers without aoi: %v %v", ids, err)
+	}
+	if _, _, ok := groups.Position(room, 1); ok {
+		t.Fatal("position without aoi")
+	}
+	aoi, _ := newTestAOI()
+	if err := groups.SetAOI(room, aoi); err != nil {
+		t.Fatal(err)
+	}
+	//4不是分组成员
+	for _, e := range []struct {
+		id   int64
+		x, y float32
+	}{{1, 100, 100}, {2, 900, 900}, {4, 110, 100}} {
+		if err := aoi.Enter(e.id, e.x, e.y, 50); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids, err := groups.ReceiversAt(room, 120, 100); err != nil || !reflect.DeepEqual(ids, []int64{1}) {
+		t.Fatalf("receivers at point: %v %v", ids, err)
+	}
+	if x, y, ok := groups.Position(room, 2); !ok || x != 900 || y != 900 {
+		t.Fatalf("position %v %v %v", x, y, ok)
+	}
+}
+
+type testRoom struct{}
+
+func (testRoom) ID() int32    { return 1 }
+func (testRoom) Name() string { return "room" }
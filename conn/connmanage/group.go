@@ -1,10 +1,16 @@
 package connmanage
 
-import "errors"
+import (
+	"errors"
+	"sync"
+)
 
 type ConnGroup struct {
-	groups map[string]GroupHook
-	conns  map[int32]map[int32]struct{}
+	mu       sync.RWMutex
+	groups   map[string]GroupHook
+	conns    map[int32]map[int64]struct{}
+	aois     map[int32]AOI
+	onremove []func(GroupHook)
 }
 
 type GroupHook interface {
@@ -15,11 +21,14 @@ type GroupHook interface {
 func NewConnGroup() *ConnGroup {
 	return &ConnGroup{
 		groups: make(map[string]GroupHook),
-		conns:  make(map[int32]map[int32]struct{}),
+		conns:  make(map[int32]map[int64]struct{}),
+		aois:   make(map[int32]AOI),
 	}
 }
 
 func (m *ConnGroup) AddGroup(g GroupHook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if _, ok := m.groups[g.Name()]; ok {
 		return errors.New("group already exists")
 	}
@@ -27,41 +36,187 @@ func (m *ConnGroup) AddGroup(g GroupHook) error {
 	return nil
 }
 func (m *ConnGroup) RemoveGroup(g GroupHook) error {
+	m.mu.Lock()
 	if _, ok := m.groups[g.Name()]; !ok {
+		m.mu.Unlock()
 		return errors.New("group not exists")
 	}
 	delete(m.conns, g.ID())
+	delete(m.aois, g.ID())
 	delete(m.groups, g.Name())
+	onremove := m.onremove
+	m.mu.Unlock()
+	for _, f := range onremove {
+		f(g)
+	}
 	return nil
 }
 
-func (m *ConnGroup) Group(g GroupHook) (map[int32]struct{}, error) {
+// OnRemoveGroup 注册分组移除回调
+func (m *ConnGroup) OnRemoveGroup(f func(g GroupHook)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onremove = append(m.onremove, f)
+}
+
+// Group 获取分组成员，返回副本
+func (m *ConnGroup) Group(g GroupHook) (map[int64]struct{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	if _, ok := m.groups[g.Name()]; !ok {
 		return nil, errors.New("group not exists")
 	}
-	return m.conns[g.ID()], nil
+	members := make(map[int64]struct{}, len(m.conns[g.ID()]))
+	for id := range m.conns[g.ID()] {
+		members[id] = struct{}{}
+	}
+	return members, nil
+}
+
+// Groups 获取全部分组
+func (m *ConnGroup) Groups() []GroupHook {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	groups := make([]GroupHook, 0, len(m.groups))
+	for _, g := range m.groups {
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// ConnGroups 获取连接所在的分组
+func (m *ConnGroup) ConnGroups(conn int64) []GroupHook {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var groups []GroupHook
+	for _, g := range m.groups {
+		if _, ok := m.conns[g.ID()][conn]; ok {
+			groups = append(groups, g)
+		}
+	}
+	return groups
 }
-func (m *ConnGroup) AddConnToGroup(g GroupHook, conn int32) error {
+func (m *ConnGroup) AddConnToGroup(g GroupHook, conn int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if _, ok := m.groups[g.Name()]; !ok {
 		return errors.New("group not exists")
 	}
 	if _, ok := m.conns[g.ID()]; !ok {
-		m.conns[g.ID()] = make(map[int32]struct{})
+		m.conns[g.ID()] = make(map[int64]struct{})
 	}
 	m.conns[g.ID()][conn] = struct{}{}
 	return nil
 }
-func (m *ConnGroup) RemoveConnFromGroup(g GroupHook, conn int32) error {
+func (m *ConnGroup) RemoveConnFromGroup(g GroupHook, conn int64) error {
+	m.mu.Lock()
 	if _, ok := m.groups[g.Name()]; !ok {
+		m.mu.Unlock()
 		return errors.New("group not exists")
 	}
 	delete(m.conns[g.ID()], conn)
+	aoi, ok := m.aois[g.ID()]
+	m.mu.Unlock()
+	if ok {
+		_ = aoi.Leave(conn)
+	}
 	return nil
 }
 func (m *ConnGroup) ClearGroup(g GroupHook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if _, ok := m.groups[g.Name()]; !ok {
 		return errors.New("group not exists")
 	}
 	delete(m.conns, g.ID())
 	return nil
 }
+
+// SetAOI 为分组绑定AOI，绑定后广播只下发给关注发送者的连接
+func (m *ConnGroup) SetAOI(g GroupHook, aoi AOI) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.groups[g.Name()]; !ok {
+		return errors.New("group not exists")
+	}
+	m.aois[g.ID()] = aoi
+	return nil
+}
+
+// AOI 获取分组绑定的AOI
+func (m *ConnGroup) AOI(g GroupHook) (AOI, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.groups[g.Name()]; !ok {
+		return nil, errors.New("group not exists")
+	}
+	aoi, ok := m.aois[g.ID()]
+	if !ok {
+		return nil, errors.New("group aoi not exists")
+	}
+	return aoi, nil
+}
+
+// Receivers 获取广播接收者
+// 分组未绑定AOI或from不在AOI中时返回分组全部连接，否则只返回视野内能看到from的分组成员
+func (m *ConnGroup) Receivers(g GroupHook, from int64) ([]int64, error) {
+	members, err := m.Group(g)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	aoi, ok := m.aois[g.ID()]
+	m.mu.RUnlock()
+	if ok {
+		if watchers, err := aoi.Watchers(from); err == nil {
+			return filterMembers(members, watchers), nil
+		}
+	}
+	return allMembers(members), nil
+}
+
+// ReceiversAt 获取视野覆盖坐标(x,y)的分组成员，发送者在其他节点时按其坐标过滤接收者
+// 分组未绑定AOI时返回分组全部连接
+func (m *ConnGroup) ReceiversAt(g GroupHook, x, y float32) ([]int64, error) {
+	members, err := m.Group(g)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	aoi, ok := m.aois[g.ID()]
+	m.mu.RUnlock()
+	if ok {
+		return filterMembers(members, aoi.WatchersAt(x, y)), nil
+	}
+	return allMembers(members), nil
+}
+
+// Position 获取连接在分组AOI中的坐标，分组未绑定AOI或连接不在AOI中时返回false
+func (m *ConnGroup) Position(g GroupHook, id int64) (float32, float32, bool) {
+	m.mu.RLock()
+	aoi, ok := m.aois[g.ID()]
+	m.mu.RUnlock()
+	if !ok {
+		return 0, 0, false
+	}
+	x, y, err := aoi.Position(id)
+	return x, y, err == nil
+}
+
+func filterMembers(members map[int64]struct{}, ids []int64) []int64 {
+	receivers := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := members[id]; ok {
+			receivers = append(receivers, id)
+		}
+	}
+	return receivers
+}
+
+func allMembers(members map[int64]struct{}) []int64 {
+	receivers := make([]int64, 0, len(members))
+	for id := range members {
+		receivers = append(receivers, id)
+	}
+	return receivers
+}
@@ -1,5 +1,7 @@
 package connmanage
 
+import "log/slog"
+
 // ConnManagerOption 连接管理器选项c
 // 用于设置连接管理器的参数
 type ConnManagerOption func(options *connManageroptions) error
@@ -14,6 +16,7 @@ type connManageroptions struct {
 	writeTimeout        *int64 //写超时时间
 	readbuffer          *int32 //读缓冲区大小
 	writebuffer         *int32 //写缓冲区大小
+	logger              *slog.Logger
 }
 
 // readbuffer:读缓冲区大小
@@ -104,3 +107,11 @@ func WithDetectionTimeout(detectionTimeout int64) ConnManagerOption {
 		return nil
 	}
 }
+
+// logger:连接管理器日志，默认为库日志
+func WithLogger(logger *slog.Logger) ConnManagerOption {
+	return func(options *connManageroptions) error {
+		options.logger = logger
+		return nil
+	}
+}
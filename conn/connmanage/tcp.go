@@ -4,20 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/logger"
 	"github.com/chen102/ggbond/conn/store"
 )
 
 var ErrorTCPManager error = errors.New("tcp connmanager error")
+var ErrorConnIDConflict error = errors.New("conn id already exists")
+var ErrorMaximumConnection error = errors.New("maximum connection")
 
 type TCPConnManager struct {
 	store.ITCPStore
 	hook                connect.Hook
-	tcpnums             int32
 	maximumConnection   int32 //最大连接数
 	connectionTimedOut  int64 //连接超时时间
 	transmissionTimeout int64 //传输超时时间
@@ -28,6 +32,10 @@ type TCPConnManager struct {
 	writeTimeout        int64 //写超时时间
 	readbuffer          int32 //读缓冲区大小
 	writebuffer         int32 //写缓冲区大小
+	onhealth            []func(conn connect.ITCPConn, from, to connect.ConnStat)
+	logger              *slog.Logger
+	conns               int32    //已登记及正在登记的连接数，插入前预留名额
+	counted             sync.Map //已占用名额的连接实例，移除时只释放一次
 }
 
 // NewTCPConnManager 创建一个tcp连接管理器
@@ -43,78 +51,90 @@ func NewTCPConn(v store.ITCPStore, h connect.Hook, opt ...ConnManagerOption) *TC
 }
 
 // AddConn 添加一个连接
-// ITCPConn :连接实例
+// ITCPConn :连接实例，连接ID已存在时返回ErrorConnIDConflict，不覆盖已有连接
 func (m *TCPConnManager) AddConn(conn connect.ITCPConn) error {
-	if m.maximumConnection > 0 && m.tcpnums >= m.maximumConnection {
-		return fmt.Errorf("%w: %s", ErrorTCPManager, "maximum connection")
+	//先预留名额再插入，并发登记时不会超过上限，插入失败时释放
+	if n := atomic.AddInt32(&m.conns, 1); m.maximumConnection > 0 && n > m.maximumConnection {
+		atomic.AddInt32(&m.conns, -1)
+		return fmt.Errorf("%w: %w", ErrorTCPManager, ErrorMaximumConnection)
 	}
 	connid := conn.ConnID()
-	_, err := m.Set(connid, conn)
+	ok, err := m.SetNX(connid, conn)
 	if err != nil {
+		atomic.AddInt32(&m.conns, -1)
 		return fmt.Errorf("%w: %w ", ErrorTCPManager, err)
 	}
-	m.tcpnums++
+	if !ok {
+		atomic.AddInt32(&m.conns, -1)
+		return fmt.Errorf("%w: %w: %d", ErrorTCPManager, ErrorConnIDConflict, connid)
+	}
+	m.counted.Store(conn, struct{}{})
 	return nil
 }
 
 // RemoveConn 移除一个连接
 // ITCPConn :连接实例
 func (m *TCPConnManager) RemoveConn(conn connect.ITCPConn, err error) error {
-	if err := m.Del(conn.ConnID()); err != nil {
-		return fmt.Errorf("%w: %s", ErrorTCPManager, err)
+	//只移除同一个连接实例，避免误删ID冲突的已有连接
+	if exist, e := m.Get(conn.ConnID()); e == nil && exist == conn {
+		if err := m.Del(conn.ConnID()); err != nil {
+			return fmt.Errorf("%w: %s", ErrorTCPManager, err)
+		}
+	}
+	//同一连接可能被关闭流程与健康检查同时移除，名额只释放一次
+	if _, ok := m.counted.LoadAndDelete(conn); ok {
+		atomic.AddInt32(&m.conns, -1)
 	}
-	m.tcpnums--
 	return conn.Close(err)
 }
 
 // FindConn 查找一个连接
 // connID 连接ID
-func (m *TCPConnManager) FindConn(connID int32) (connect.ITCPConn, error) {
-	conn, err := m.Get(connID)
-	if err != nil {
-		return nil, err
-	}
-	store, ok := conn.(connect.ITCPConn)
-	if !ok {
-		return nil, fmt.Errorf("%w: %s", ErrorTCPManager, "connection is not a TCP connection")
-	}
-	return store, nil
+func (m *TCPConnManager) FindConn(connID int64) (connect.ITCPConn, error) {
+	return m.Get(connID)
 }
 
 // 健康检查
 // 防止客户端因为网络原因管理器误删除连接:
-// 连接共有三张状态 活动:2 超时:1 关闭：0 单个连接，检查失败，依次递减直到状态为-1 连接管理器删除连接
+// 连接共有三张状态 活动:2 超时:1 关闭：0 单个连接，检查失败，依次递减直到状态为-1 通知连接关闭，仍未关闭时连接管理器删除连接
 func (m *TCPConnManager) CheckHealths(ctx context.Context) {
 	close := make(chan struct{})
 	go func() {
 		for {
 			select {
 			case <-time.After(time.Second * time.Duration(m.explorationCycle)):
-				m.RangeStroe(func(key, value interface{}) bool {
-					conn := value.(connect.ITCPConn)
+				m.RangeStroe(func(key int64, conn connect.ITCPConn) bool {
 					id := conn.ConnID()
-					log.Println("check health:", id)
 					stat := conn.Stat()
+					m.logger.Debug("check health", "conn", id, "stat", stat.String())
 					if stat < 0 {
-						log.Println("check health:", id, "failed")
-						if err := m.RemoveConn(conn, errors.New("connect timeout")); err != nil {
-							log.Println("remove conn:", id, "failed")
+						closeerr := connect.NewCloseError(connect.CloseHeartbeat, "", nil)
+						if stat == connect.CLOSE-1 {
+							//先通知连接所属协程关闭，由其停止读写后发送断开通知并移除
+							conn.SetStat(stat - 1)
+							conn.SignalClose(closeerr)
+							return true
+						}
+						//下个周期仍未移除时直接移除
+						if err := m.RemoveConn(conn, closeerr); err != nil {
+							m.logger.Warn("remove unhealthy conn error", "conn", id, "error", err)
 						}
-						m.Del(key.(int32))
-						log.Println("remove conn:", id, "success")
+						m.logger.Info("removed unhealthy conn", "conn", id)
 						return true
 					}
 					if !conn.CheckHealth(m.detectionTimeout) {
 						conn.SetStat(stat - 1)
+						m.healthChanged(conn, stat, stat-1)
 						return true
 					}
 					if stat < connect.ACTIVE {
 						conn.SetStat(stat + 1)
+						m.healthChanged(conn, stat, stat+1)
 					}
 					return true
 				})
 			case <-ctx.Done():
-				log.Println("check healths done")
+				m.logger.Debug("check healths done")
 				close <- struct{}{}
 				break
 			}
@@ -122,6 +142,17 @@ func (m *TCPConnManager) CheckHealths(ctx context.Context) {
 	}()
 	<-close
 }
+// OnHealthChange 注册健康检查状态变化回调，状态降为-1后连接被移除
+// 需在CheckHealths启动前注册
+func (m *TCPConnManager) OnHealthChange(f func(conn connect.ITCPConn, from, to connect.ConnStat)) {
+	m.onhealth = append(m.onhealth, f)
+}
+
+func (m *TCPConnManager) healthChanged(conn connect.ITCPConn, from, to connect.ConnStat) {
+	for _, f := range m.onhealth {
+		f(conn, from, to)
+	}
+}
 func (m *TCPConnManager) SetHook(hook connect.Hook) {
 	m.hook = hook
 }
@@ -162,11 +193,10 @@ func (m *TCPConnManager) WriteBuffer() int32 {
 }
 
 // GetAllConn 获取所有连接
-func (c *TCPConnManager) AllConn() map[int32]connect.ITCPConn {
-	conns := make(map[int32]connect.ITCPConn, c.tcpnums)
-	c.RangeStroe(func(key, value interface{}) bool {
-		conn := value.(connect.ITCPConn)
-		conns[key.(int32)] = conn
+func (c *TCPConnManager) AllConn() map[int64]connect.ITCPConn {
+	conns := make(map[int64]connect.ITCPConn, c.Len())
+	c.RangeStroe(func(key int64, conn connect.ITCPConn) bool {
+		conns[key] = conn
 		return true
 	})
 	return conns
@@ -199,54 +229,54 @@ func (m *TCPConnManager) setoption(opt ...ConnManagerOption) error {
 	}
 	if options.connectionTimedOut != nil {
 		if *options.connectionTimedOut < 0 || *options.connectionTimedOut > math.MaxInt64 {
-			fmt.Errorf("%w:connectionTimedOut is not valid", baseerr)
+			return fmt.Errorf("%w:connectionTimedOut is not valid", baseerr)
 		}
 		connectionTimedOut = *options.connectionTimedOut
 	}
 	if options.transmissionTimeout != nil {
 		if *options.transmissionTimeout < 0 || *options.transmissionTimeout > math.MaxInt64 {
-			fmt.Errorf("%w:transmissionTimeout is not valid", baseerr)
+			return fmt.Errorf("%w:transmissionTimeout is not valid", baseerr)
 		}
 	}
 	if options.explorationCycle != nil {
 		if *options.explorationCycle < 0 || *options.explorationCycle > math.MaxInt64 {
-			fmt.Errorf("%w:explorationCycle is not valid", baseerr)
+			return fmt.Errorf("%w:explorationCycle is not valid", baseerr)
 		}
 		explorationCycle = *options.explorationCycle
 	}
 	if options.detectionTimeout != nil {
 		if *options.detectionTimeout < 0 || *options.detectionTimeout > math.MaxInt64 {
-			fmt.Errorf("%w:detectionTimeout is not valid", baseerr)
+			return fmt.Errorf("%w:detectionTimeout is not valid", baseerr)
 		}
 		detectionTimeout = *options.detectionTimeout
 	}
 	if options.readwriteTimeout != nil {
 		if *options.readwriteTimeout < 0 || *options.readwriteTimeout > math.MaxInt64 {
-			fmt.Errorf("%w:readwriteTimeout is not valid", baseerr)
+			return fmt.Errorf("%w:readwriteTimeout is not valid", baseerr)
 		}
 		readwriteTimeout = *options.readwriteTimeout
 	}
 	if options.readTimeout != nil {
 		if *options.readTimeout < 0 || *options.readTimeout > math.MaxInt64 {
-			fmt.Errorf("%w:readTimeout is not valid", baseerr)
+			return fmt.Errorf("%w:readTimeout is not valid", baseerr)
 		}
 		readTimeout = *options.readTimeout
 	}
 	if options.writeTimeout != nil {
 		if *options.writeTimeout < 0 || *options.writeTimeout > math.MaxInt64 {
-			fmt.Errorf("%w:writeTimeout is not valid", baseerr)
+			return fmt.Errorf("%w:writeTimeout is not valid", baseerr)
 		}
 		writeTimeout = *options.writeTimeout
 	}
 	if options.readbuffer != nil {
 		if *options.readbuffer < 0 || *options.readbuffer > math.MaxInt32 {
-			fmt.Errorf("%w:readbuffer is not valid", baseerr)
+			return fmt.Errorf("%w:readbuffer is not valid", baseerr)
 		}
 		readbuffer = *options.readbuffer
 	}
 	if options.writebuffer != nil {
 		if *options.writebuffer < 0 || *options.writebuffer > math.MaxInt32 {
-			fmt.Errorf("%w:writebuffer is not valid", baseerr)
+			return fmt.Errorf("%w:writebuffer is not valid", baseerr)
 		}
 		writebuffer = *options.writebuffer
 	}
@@ -261,6 +291,10 @@ func (m *TCPConnManager) setoption(opt ...ConnManagerOption) error {
 	m.writeTimeout = writeTimeout
 	m.readbuffer = readbuffer
 	m.writebuffer = writebuffer
+	m.logger = logger.L()
+	if options.logger != nil {
+		m.logger = options.logger
+	}
 
 	return nil
 }
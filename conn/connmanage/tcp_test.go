@@ -0,0 +1,82 @@
+package connmanage
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/store"
+)
+
+func newTestConn(t *testing.T, connid int64) connect.ITCPConn {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return connect.NewTCPConn(a, connid, "tcp")
+}
+
+func TestAddConnMaximumConnection(t *testing.T) {
+	const max = 10
+	m := NewTCPConn(store.NewTCPShardMap(8), connect.NopHook{}, WithMaximumConnection(max))
+	conns := make([]connect.ITCPConn, 100)
+	for i := range conns {
+		conns[i] = newTestConn(t, int64(i+1))
+	}
+	//并发登记时成功数不超过上限
+	var wg sync.WaitGroup
+	var added, rejected int32
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn connect.ITCPConn) {
+			defer wg.Done()
+			err := m.AddConn(conn)
+			switch {
+			case err == nil:
+				atomic.AddInt32(&added, 1)
+			case errors.Is(err, ErrorMaximumConnection):
+				atomic.AddInt32(&rejected, 1)
+			default:
+				t.Errorf("add conn %d: %v", conn.ConnID(), err)
+			}
+		}(conn)
+	}
+	wg.Wait()
+	if added != max || rejected != int32(len(conns))-max || m.Len() != max {
+		t.Fatalf("added %d rejected %d len %d", added, rejected, m.Len())
+	}
+
+	var registered []connect.ITCPConn
+	for _, conn := range conns {
+		if exist, err := m.Get(conn.ConnID()); err == nil && exist == conn {
+			registered = append(registered, conn)
+		}
+	}
+	if err := m.AddConn(newTestConn(t, 1000)); !errors.Is(err, ErrorMaximumConnection) {
+		t.Fatalf("add at maximum: %v", err)
+	}
+	//同一连接被并发移除时名额只释放一次
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.RemoveConn(registered[0], nil)
+		}()
+	}
+	wg.Wait()
+	//ID冲突时释放预留的名额
+	if err := m.AddConn(newTestConn(t, registered[1].ConnID())); !errors.Is(err, ErrorConnIDConflict) {
+		t.Fatalf("add conflicting conn: %v", err)
+	}
+	if err := m.AddConn(newTestConn(t, 1000)); err != nil {
+		t.Fatalf("add after remove: %v", err)
+	}
+	if err := m.AddConn(newTestConn(t, 1001)); !errors.Is(err, ErrorMaximumConnection) {
+		t.Fatalf("add after slot reused: %v", err)
+	}
+}
@@ -0,0 +1,400 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/logger"
+	"github.com/chen102/ggbond/conn/trace"
+	"github.com/chen102/ggbond/message"
+)
+
+// MessageHandler 后端路由
+type MessageHandler interface {
+	HandleMessageContext(ctx context.Context, routerid int32, connid int64, msgid int32, parameter []byte) error
+}
+
+// ConnManager 后端连接管理器，保存网关转发过来的远程连接
+type ConnManager interface {
+	AddConn(conn connect.ITCPConn) error
+	RemoveConn(conn connect.ITCPConn, err error) error
+	FindConn(id int64) (connect.ITCPConn, error)
+}
+
+// 网关链路单次写入超时时间，超时后断开链路，避免网关不读时发送方堆积
+const linkWriteTimeout = 5 * time.Second
+
+// Backend 后端服务
+// 接收网关的多路复用长连接，为每个客户端连接创建远程连接放入连接管理器，
+// 业务服务可以像直连一样通过FindConn(connid).SendMessage回复客户端
+type Backend struct {
+	addr        string
+	router      MessageHandler
+	connManager ConnManager
+	listener    net.Listener
+	stop        chan struct{}
+}
+
+// NewBackend 创建后端服务
+// addr:监听地址 router:后端路由 connManager:后端连接管理器
+func NewBackend(addr string, router MessageHandler, connManager ConnManager) *Backend {
+	return &Backend{
+		addr:        addr,
+		router:      router,
+		connManager: connManager,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start 启动后端服务
+func (b *Backend) Start() error {
+	listener, err := net.Listen("tcp", b.addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorGateway, err)
+	}
+	b.listener = listener
+	logger.L().Info("backend started", "addr", b.addr)
+	go b.accept()
+	return nil
+}
+
+// Stop 停止后端服务
+func (b *Backend) Stop() error {
+	close(b.stop)
+	return b.listener.Close()
+}
+
+func (b *Backend) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			select {
+			case <-b.stop:
+				return
+			default:
+			}
+			logger.L().Error("backend accept error", "error", err)
+			continue
+		}
+		go b.serve(conn)
+	}
+}
+
+// 一条网关链路，链路断开时释放该链路上的全部远程连接
+func (b *Backend) serve(conn net.Conn) {
+	gl := &gatewayLink{
+		conn:   conn,
+		send:   make(chan *message.TCPMessage, 1024),
+		closed: make(chan struct{}),
+		remote: make(map[int64]*RemoteConn),
+	}
+	go gl.writeloop()
+	defer func() {
+		gl.close()
+		gl.mu.Lock()
+		remote := gl.remote
+		gl.remote = make(map[int64]*RemoteConn)
+		gl.mu.Unlock()
+		for _, rc := range remote {
+			rc.stop()
+			_ = b.connManager.RemoveConn(rc, connect.NewCloseError(connect.CloseInternal, "gateway link closed", nil))
+		}
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		msg := &message.TCPMessage{}
+		if err := msg.ReadAndUnpack(reader); err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.L().Warn("backend read error", "error", err)
+			}
+			return
+		}
+		connid, body, err := decode(msg)
+		if err != nil {
+			logger.L().Warn("backend decode error", "error", err)
+			continue
+		}
+		gl.mu.Lock()
+		rc, ok := gl.remote[connid]
+		if msg.RouteID() == GATEWAYCLOSE {
+			delete(gl.remote, connid)
+			gl.mu.Unlock()
+			if ok {
+				rc.stop()
+				_ = b.connManager.RemoveConn(rc, connect.NewCloseError(connect.CloseNormal, "client closed", nil))
+			}
+			continue
+		}
+		if !ok {
+			rc = newRemoteConn(connid, gl, b.router, remoteAddr(conn, msg.RouteID(), body))
+			gl.remote[connid] = rc
+		}
+		gl.mu.Unlock()
+		if !ok {
+			if err := b.connManager.AddConn(rc); err != nil {
+				//未加入连接管理器的连接无法回复，要求网关断开
+				logger.L().Warn("backend add conn error", "conn", connid, "error", err)
+				b.kick(gl, rc, connect.NewCloseError(connect.CloseRejected, "backend add conn error", err))
+				continue
+			}
+		}
+		rc.UpdateLastActiveTime()
+		if msg.RouteID() == GATEWAYOPEN {
+			continue
+		}
+		if !rc.deliver(inbound{msg.RouteID(), msg.MessageID(), body, msg.TraceContext()}) {
+			//处理跟不上客户端发送速度时断开该连接，不阻塞链路上的其他连接
+			logger.L().Warn("backend conn inbox full", "conn", connid)
+			b.kick(gl, rc, connect.NewCloseError(connect.CloseRateLimited, "backend inbox full", nil))
+		}
+	}
+}
+
+// 客户端地址，取自GATEWAYOPEN，未携带或无法解析时使用网关链路地址
+func remoteAddr(link net.Conn, routeid int32, body []byte) net.Addr {
+	if routeid == GATEWAYOPEN && len(body) > 0 {
+		if addr, err := net.ResolveTCPAddr("tcp", string(body)); err == nil && addr.IP != nil {
+			return addr
+		}
+	}
+	return link.RemoteAddr()
+}
+
+// 移除远程连接并要求网关断开客户端连接
+func (b *Backend) kick(gl *gatewayLink, rc *RemoteConn, err error) {
+	gl.mu.Lock()
+	if gl.remote[rc.connID] == rc {
+		delete(gl.remote, rc.connID)
+	}
+	gl.mu.Unlock()
+	if e := b.connManager.RemoveConn(rc, err); e != nil {
+		logger.L().Warn("backend kick error", "conn", rc.connID, "error", e)
+	}
+}
+
+// gatewayLink 一条网关链路，发送经队列由写协程写出
+type gatewayLink struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	send   chan *message.TCPMessage
+	closed chan struct{}
+	once   sync.Once
+	remote map[int64]*RemoteConn
+}
+
+// 异步发送，链路已关闭时返回ErrorLinkClosed，发送队列满时返回connect.ErrorSendQueueFull
+func (gl *gatewayLink) post(msg *message.TCPMessage) error {
+	select {
+	case <-gl.closed:
+		return ErrorLinkClosed
+	default:
+	}
+	select {
+	case gl.send <- msg:
+		return nil
+	default:
+		return connect.ErrorSendQueueFull
+	}
+}
+
+func (gl *gatewayLink) writeloop() {
+	writer := bufio.NewWriter(gl.conn)
+	for {
+		select {
+		case <-gl.closed:
+			return
+		case msg := <-gl.send:
+			_ = gl.conn.SetWriteDeadline(time.Now().Add(linkWriteTimeout))
+			if err := msg.PackAndWrite(writer); err != nil {
+				logger.L().Warn("backend write error", "error", err)
+				//关闭链路，读协程随之退出并释放链路上的远程连接
+				gl.close()
+				return
+			}
+		}
+	}
+}
+
+func (gl *gatewayLink) close() {
+	gl.once.Do(func() {
+		close(gl.closed)
+		gl.conn.Close()
+	})
+}
+
+type inbound struct {
+	routeid int32
+	msgid   int32
+	body    []byte
+	trace   []byte //网关转发时附带的链路上下文
+}
+
+// RemoteConn 网关上客户端连接在后端的映射
+// 入站消息在独立协程中按序处理，发送的消息经网关链路发回
+type RemoteConn struct {
+	connID           int64
+	link             *gatewayLink
+	router           MessageHandler
+	inbox            chan inbound
+	closed           chan struct{}
+	close            chan error
+	once             sync.Once
+	lastactivatetime int64
+	stat             connect.ConnStat
+	attrs            *connect.Attributes
+	addr             net.Addr
+	sendq            chan connect.IMessage
+}
+
+func newRemoteConn(connid int64, link *gatewayLink, router MessageHandler, addr net.Addr) *RemoteConn {
+	rc := &RemoteConn{
+		connID:           connid,
+		link:             link,
+		router:           router,
+		addr:             addr,
+		sendq:            make(chan connect.IMessage),
+		inbox:            make(chan inbound, 100),
+		closed:           make(chan struct{}),
+		close:            make(chan error, 1),
+		lastactivatetime: time.Now().Unix(),
+		stat:             connect.ACTIVE,
+		attrs:            connect.NewAttributes(),
+	}
+	go rc.run()
+	return rc
+}
+
+func (c *RemoteConn) run() {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case in := <-c.inbox:
+			ctx := context.Background()
+			if sc, err := trace.Decode(in.trace); err == nil {
+				ctx = trace.ContextWithRemote(ctx, sc)
+			}
+			ctx, span := trace.Start(ctx, "backend.message", trace.Int64("conn", c.connID), trace.Int64("route", int64(in.routeid)), trace.Int64("msgid", int64(in.msgid)))
+			span.SetKind(trace.SpanKindServer)
+			err := c.router.HandleMessageContext(ctx, in.routeid, c.connID, in.msgid, in.body)
+			span.SetError(err)
+			span.End()
+			if err != nil {
+				logger.L().Warn("backend route error", "conn", c.connID, "route", in.routeid, "error", err)
+			}
+		}
+	}
+}
+
+// 投递入站消息，不阻塞链路读协程，收件箱满时返回false
+func (c *RemoteConn) deliver(in inbound) bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+	}
+	select {
+	case c.inbox <- in:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *RemoteConn) stop() {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+}
+
+func (c *RemoteConn) ConnType() (string, error) {
+	return "gateway", nil
+}
+func (c *RemoteConn) ConnID() int64 {
+	return c.connID
+}
+func (c *RemoteConn) Conn() (interface{}, error) {
+	return c.link.conn, nil
+}
+func (c *RemoteConn) CheckHealth(timeout int64) bool {
+	return time.Now().Unix()-c.lastactivatetime < timeout
+}
+
+// Close 要求网关断开客户端连接，网关已通知关闭时不再回发
+func (c *RemoteConn) Close(err error) error {
+	select {
+	case <-c.closed:
+		return nil
+	default:
+	}
+	c.stop()
+	msg, e := encode(c.connID, GATEWAYKICK, 0, nil)
+	if e != nil {
+		return e
+	}
+	return c.link.post(msg)
+}
+func (c *RemoteConn) WaitForClosed() chan error {
+	return c.close
+}
+func (c *RemoteConn) SignalClose(err error) {
+	select {
+	case c.close <- err:
+	default:
+	}
+}
+func (c *RemoteConn) Sender() io.Writer {
+	return nil
+}
+func (c *RemoteConn) Reader() io.Reader {
+	return nil
+}
+func (c *RemoteConn) UpdateLastActiveTime() {
+	c.lastactivatetime = time.Now().Unix()
+}
+func (c *RemoteConn) LastActiveTime() int64 {
+	return c.lastactivatetime
+}
+
+// SendMessage 经网关链路发回客户端，不阻塞调用方，链路发送队列满时返回connect.ErrorSendQueueFull
+func (c *RemoteConn) SendMessage(msg connect.IMessage) error {
+	frame, err := encode(c.connID, msg.RouteID(), msg.MessageID(), msg.Body())
+	if err != nil {
+		return err
+	}
+	return c.link.post(frame)
+}
+// MessageChan 消息直接写入网关链路的发送队列，返回的队列始终为空
+func (c *RemoteConn) MessageChan() chan connect.IMessage {
+	return c.sendq
+}
+func (c *RemoteConn) Stat() connect.ConnStat {
+	return c.stat
+}
+func (c *RemoteConn) SetStat(stat connect.ConnStat) {
+	c.stat = stat
+}
+func (c *RemoteConn) SetDeadline(t int64) error {
+	return nil
+}
+func (c *RemoteConn) SetReadDeadline(t int64) error {
+	return nil
+}
+func (c *RemoteConn) SetWriteDeadline(t int64) error {
+	return nil
+}
+func (c *RemoteConn) Attrs() *connect.Attributes {
+	return c.attrs
+}
+
+// RemoteAddr 网关传来的客户端地址，网关未知时为网关链路地址
+func (c *RemoteConn) RemoteAddr() net.Addr {
+	return c.addr
+}
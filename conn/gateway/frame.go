@@ -0,0 +1,44 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/chen102/ggbond/message"
+)
+
+// 网关与后端之间的控制帧，路由ID为负数，业务路由ID不能使用
+const (
+	GATEWAYCLOSE = -1 //网关->后端 客户端连接已关闭
+	GATEWAYKICK  = -2 //后端->网关 要求网关断开客户端连接
+	GATEWAYOPEN  = -3 //网关->后端 客户端连接首次转发，消息体为客户端地址
+)
+
+var (
+	ErrorGateway            = errors.New("gateway error")
+	ErrorFrame              = errors.New("gateway frame is not valid")
+	ErrorBackendUnavailable = errors.New("backend unavailable")
+	ErrorBackendBusy        = errors.New("backend send queue full")
+	ErrorLinkClosed         = errors.New("gateway link closed")
+)
+
+// 内部帧复用TCPMessage格式，路由ID、消息ID与客户端消息一致，
+// 消息体前8字节为客户端连接ID(大端序)，其后为原始消息体
+func encode(connid int64, routeid, msgid int32, body []byte) (*message.TCPMessage, error) {
+	payload := make([]byte, 8+len(body))
+	binary.BigEndian.PutUint64(payload, uint64(connid))
+	copy(payload[8:], body)
+	msg := &message.TCPMessage{}
+	if err := msg.Write(payload, msgid, routeid); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func decode(msg *message.TCPMessage) (connid int64, body []byte, err error) {
+	payload := msg.Body()
+	if len(payload) < 8 {
+		return 0, nil, ErrorFrame
+	}
+	return int64(binary.BigEndian.Uint64(payload)), payload[8:], nil
+}
@@ -0,0 +1,351 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chen102/ggbond/conn/actor"
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/logger"
+	"github.com/chen102/ggbond/conn/routermanage"
+	"github.com/chen102/ggbond/conn/trace"
+	"github.com/chen102/ggbond/message"
+)
+
+// Router 本地路由，网关未转发的消息由本地处理
+type Router interface {
+	RegisterRoute(id int32, route routermanage.RouterHandle) error
+	RegisterActorRoute(id int32, system *actor.System, resolve actor.Resolver, handler actor.Handle) error
+	RegisterRoomRoute(id int32, locator routermanage.RoomLocator, resolve routermanage.RoomResolver, handler routermanage.RouterHandle) error
+	RegisterContextRoute(id int32, handler routermanage.ContextHandle) error
+	Use(mw ...routermanage.Middleware)
+	HandleMessage(routerid int32, connid int64, msgid int32, parameter []byte) error
+	HandleMessageContext(ctx context.Context, routerid int32, connid int64, msgid int32, parameter []byte) error
+	Routes() []int32
+}
+
+// ConnFinder 网关连接查找，用于把后端回复发送给客户端
+type ConnFinder interface {
+	FindConn(id int64) (connect.ITCPConn, error)
+}
+
+// GatewayOption 网关选项
+type GatewayOption func(options *gatewayoptions) error
+type gatewayoptions struct {
+	backends    []backendRoute
+	dialTimeout *time.Duration
+}
+
+type backendRoute struct {
+	min, max int32
+	addr     string
+}
+
+// min,max:路由ID范围(闭区间) addr:后端服务地址
+func WithBackend(min, max int32, addr string) GatewayOption {
+	return func(options *gatewayoptions) error {
+		if min < 0 || max < min || addr == "" {
+			return errors.New("backend route is not valid")
+		}
+		options.backends = append(options.backends, backendRoute{min, max, addr})
+		return nil
+	}
+}
+
+// dialTimeout:连接后端超时时间
+func WithDialTimeout(dialTimeout time.Duration) GatewayOption {
+	return func(options *gatewayoptions) error {
+		if dialTimeout <= 0 {
+			return errors.New("dialTimeout is not valid")
+		}
+		options.dialTimeout = &dialTimeout
+		return nil
+	}
+}
+
+// Gateway 无状态网关
+// 只负责维持客户端连接，按路由ID范围把消息经长连接转发给后端服务，
+// 后端回复按连接ID发回客户端，范围外的路由由本地路由处理
+type Gateway struct {
+	Router
+	conns    ConnFinder
+	backends []*backend
+}
+
+// NewGateway 创建网关
+// local:本地路由 conns:网关连接管理器
+func NewGateway(local Router, conns ConnFinder, opt ...GatewayOption) *Gateway {
+	var options gatewayoptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			panic(fmt.Errorf("apply option error:%w", err))
+		}
+	}
+	dialTimeout := 3 * time.Second
+	if options.dialTimeout != nil {
+		dialTimeout = *options.dialTimeout
+	}
+	g := &Gateway{
+		Router: local,
+		conns:  conns,
+	}
+	for _, r := range options.backends {
+		b := &backend{
+			backendRoute: r,
+			gateway:      g,
+			dialTimeout:  dialTimeout,
+			send:         make(chan *message.TCPMessage, 4096),
+			stop:         make(chan struct{}),
+		}
+		g.backends = append(g.backends, b)
+		go b.run()
+	}
+	return g
+}
+
+// HandleMessage 路由ID在后端范围内时转发，否则交给本地路由
+func (g *Gateway) HandleMessage(routeid int32, connid int64, msgid int32, parameter []byte) error {
+	return g.HandleMessageContext(context.Background(), routeid, connid, msgid, parameter)
+}
+
+// HandleMessageContext 转发时链路上下文随内部帧发往后端
+func (g *Gateway) HandleMessageContext(ctx context.Context, routeid int32, connid int64, msgid int32, parameter []byte) error {
+	for _, b := range g.backends {
+		if routeid >= b.min && routeid <= b.max {
+			ctx, span := trace.Start(ctx, "gateway.forward", trace.String("backend", b.addr), trace.Int64("route", int64(routeid)))
+			span.SetKind(trace.SpanKindClient)
+			err := b.forward(connid, routeid, msgid, parameter, trace.SpanContextFromContext(ctx).Encode())
+			span.SetError(err)
+			span.End()
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrorGateway, err)
+			}
+			return nil
+		}
+	}
+	return g.Router.HandleMessageContext(ctx, routeid, connid, msgid, parameter)
+}
+
+// ConnClosed 客户端连接关闭，通知转发过该连接的后端释放该连接
+func (g *Gateway) ConnClosed(connid int64) {
+	for _, b := range g.backends {
+		b.closeConn(connid)
+	}
+}
+
+// Close 断开全部后端
+func (g *Gateway) Close() error {
+	for _, b := range g.backends {
+		b.close()
+	}
+	return nil
+}
+
+// 后端回复
+func (g *Gateway) reply(msg *message.TCPMessage) {
+	connid, body, err := decode(msg)
+	if err != nil {
+		logger.L().Warn("gateway decode error", "error", err)
+		return
+	}
+	conn, err := g.conns.FindConn(connid)
+	if err != nil {
+		return
+	}
+	if msg.RouteID() == GATEWAYKICK {
+		conn.SignalClose(connect.NewCloseError(connect.CloseKicked, "kicked by backend", ErrorGateway))
+		return
+	}
+	out := connect.NewMessage("tcp")
+	if err := out.Write(body, msg.MessageID(), msg.RouteID()); err != nil {
+		logger.L().Warn("gateway reply error", "conn", connid, "error", err)
+		return
+	}
+	if err := conn.SendMessage(out); err != nil {
+		logger.L().Warn("gateway reply error", "conn", connid, "error", err)
+	}
+}
+
+// 客户端连接的地址，随GATEWAYOPEN发往后端，未知时为空
+func (g *Gateway) remoteAddr(connid int64) string {
+	conn, err := g.conns.FindConn(connid)
+	if err != nil {
+		return ""
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
+
+// backend 到一个后端的多路复用长连接，断开后自动重连
+// 链路断开时后端已释放链路上的远程连接，网关断开转发过的客户端连接
+type backend struct {
+	backendRoute
+	gateway     *Gateway
+	dialTimeout time.Duration
+	mu          sync.Mutex
+	conn        net.Conn
+	conns       map[int64]struct{} //当前链路上已打开的客户端连接
+	send        chan *message.TCPMessage
+	stop        chan struct{}
+	once        sync.Once
+}
+
+// tracectx:随内部帧发送的链路上下文，可为nil
+// 连接在当前链路上首次转发时先发送GATEWAYOPEN
+func (b *backend) forward(connid int64, routeid, msgid int32, body, tracectx []byte) error {
+	msg, err := encode(connid, routeid, msgid, body)
+	if err != nil {
+		return err
+	}
+	if err := msg.SetTraceContext(tracectx); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return fmt.Errorf("%w: %s", ErrorBackendUnavailable, b.addr)
+	}
+	_, opened := b.conns[connid]
+	need := 1
+	if !opened {
+		need = 2
+	}
+	//只有持锁时写入队列，剩余容量足够时写入不会阻塞
+	if cap(b.send)-len(b.send) < need {
+		return fmt.Errorf("%w: %s", ErrorBackendBusy, b.addr)
+	}
+	if !opened {
+		open, err := encode(connid, GATEWAYOPEN, 0, []byte(b.gateway.remoteAddr(connid)))
+		if err != nil {
+			return err
+		}
+		b.send <- open
+		b.conns[connid] = struct{}{}
+	}
+	b.send <- msg
+	return nil
+}
+
+// 客户端连接关闭，连接在当前链路上打开过时通知后端
+func (b *backend) closeConn(connid int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.conns[connid]; !ok {
+		return
+	}
+	delete(b.conns, connid)
+	msg, err := encode(connid, GATEWAYCLOSE, 0, nil)
+	if err != nil {
+		return
+	}
+	select {
+	case b.send <- msg:
+	default:
+		//队列满时后端只能在链路断开或健康检查时释放该连接
+		logger.L().Warn("gateway close conn dropped", "backend", b.addr, "conn", connid)
+	}
+}
+
+// 后端要求断开的连接已在后端释放
+func (b *backend) kicked(connid int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.conns, connid)
+}
+
+func (b *backend) run() {
+	backoff := 100 * time.Millisecond
+	for {
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+		conn, err := net.DialTimeout("tcp", b.addr, b.dialTimeout)
+		if err != nil {
+			select {
+			case <-b.stop:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff < 5*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = 100 * time.Millisecond
+		logger.L().Info("gateway connected to backend", "addr", b.addr)
+		b.serve(conn)
+		logger.L().Warn("gateway disconnected from backend", "addr", b.addr)
+	}
+}
+
+func (b *backend) serve(conn net.Conn) {
+	b.mu.Lock()
+	b.conn = conn
+	b.conns = make(map[int64]struct{})
+	b.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reader := bufio.NewReader(conn)
+		for {
+			msg := &message.TCPMessage{}
+			if err := msg.ReadAndUnpack(reader); err != nil {
+				return
+			}
+			if msg.RouteID() == GATEWAYKICK {
+				if connid, _, err := decode(msg); err == nil {
+					b.kicked(connid)
+				}
+			}
+			b.gateway.reply(msg)
+		}
+	}()
+	writer := bufio.NewWriter(conn)
+	defer func() {
+		b.mu.Lock()
+		b.conn = nil
+		conns := b.conns
+		b.conns = nil
+		//未写出的帧属于已断开的链路，丢弃
+		for len(b.send) > 0 {
+			<-b.send
+		}
+		b.mu.Unlock()
+		conn.Close()
+		<-done
+		for connid := range conns {
+			if c, err := b.gateway.conns.FindConn(connid); err == nil {
+				c.SignalClose(connect.NewCloseError(connect.CloseInternal, "backend unavailable", fmt.Errorf("%w: %s", ErrorBackendUnavailable, b.addr)))
+			}
+		}
+	}()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-done:
+			return
+		case msg := <-b.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(linkWriteTimeout))
+			if err := msg.PackAndWrite(writer); err != nil {
+				logger.L().Warn("gateway write error", "backend", b.addr, "error", err)
+				return
+			}
+		}
+	}
+}
+
+func (b *backend) close() {
+	b.once.Do(func() {
+		close(b.stop)
+	})
+}
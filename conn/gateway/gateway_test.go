@@ -0,0 +1,251 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/routermanage"
+	"github.com/chen102/ggbond/conn/store"
+)
+
+type routed struct {
+	route  int32
+	conn   int64
+	msgid  int32
+	body   string
+	remote net.Addr
+}
+
+// 后端路由，记录收到的消息并原样回复
+type echoRouter struct {
+	conns  *connmanage.TCPConnManager
+	routes chan routed
+}
+
+func (r echoRouter) HandleMessageContext(ctx context.Context, routerid int32, connid int64, msgid int32, parameter []byte) error {
+	conn, err := r.conns.FindConn(connid)
+	if err != nil {
+		return err
+	}
+	r.routes <- routed{routerid, connid, msgid, string(parameter), conn.RemoteAddr()}
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write(parameter, msgid, routerid); err != nil {
+		return err
+	}
+	return conn.SendMessage(msg)
+}
+
+// 网关上的客户端连接
+type testConns struct {
+	mu    sync.Mutex
+	conns map[int64]connect.ITCPConn
+}
+
+func (c *testConns) FindConn(id int64) (connect.ITCPConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conn, ok := c.conns[id]
+	if !ok {
+		return nil, errors.New("conn not exists")
+	}
+	return conn, nil
+}
+
+type testEnv struct {
+	gateway  *Gateway
+	backend  *Backend
+	backends *connmanage.TCPConnManager
+	routes   chan routed
+	conns    *testConns
+	local    chan int32
+}
+
+// 在本机空闲端口上启动后端，网关把100~199路由转发到后端
+func startTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	env := &testEnv{
+		backends: connmanage.NewTCPConn(store.NewTCPShardMap(8), connect.NopHook{}),
+		routes:   make(chan routed, 10),
+		conns:    &testConns{conns: make(map[int64]connect.ITCPConn)},
+		local:    make(chan int32, 10),
+	}
+	env.backend = NewBackend("127.0.0.1:0", echoRouter{env.backends, env.routes}, env.backends)
+	if err := env.backend.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { env.backend.Stop() })
+	local := routermanage.NewTCPRouter(store.NewSyncMap[routermanage.RouterHandle]())
+	if err := local.RegisterRoute(1, func(msgid int32, connid int64, parameter []byte) error {
+		env.local <- msgid
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	env.gateway = NewGateway(local, env.conns, WithBackend(100, 199, env.backend.listener.Addr().String()))
+	t.Cleanup(func() { env.gateway.Close() })
+	waitFor(t, "backend link", func() bool {
+		b := env.gateway.backends[0]
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.conn != nil
+	})
+	return env
+}
+
+// 经本机TCP连接创建客户端连接，使其带有真实的远端地址
+func (env *testEnv) addConn(t *testing.T, connid int64) connect.ITCPConn {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	conn := connect.NewTCPConn(server, connid, "tcp")
+	env.conns.mu.Lock()
+	env.conns.conns[connid] = conn
+	env.conns.mu.Unlock()
+	return conn
+}
+
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitClosed(t *testing.T, conn connect.ITCPConn) *connect.CloseError {
+	t.Helper()
+	select {
+	case err := <-conn.WaitForClosed():
+		return connect.AsCloseError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for conn close")
+		return nil
+	}
+}
+
+func TestGatewayForwardAndReply(t *testing.T) {
+	env := startTestEnv(t)
+	conn := env.addConn(t, 42)
+	if err := env.gateway.HandleMessage(100, 42, 7, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-env.routes:
+		if r.route != 100 || r.conn != 42 || r.msgid != 7 || r.body != "hello" {
+			t.Fatalf("backend got %+v", r)
+		}
+		//后端连接的地址为网关上客户端连接的地址
+		if r.remote == nil || r.remote.String() != conn.RemoteAddr().String() {
+			t.Fatalf("backend remote addr %v, want %v", r.remote, conn.RemoteAddr())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for forwarded message")
+	}
+	select {
+	case msg := <-conn.MessageChan():
+		if msg.RouteID() != 100 || msg.MessageID() != 7 || string(msg.Body()) != "hello" {
+			t.Fatalf("reply route %d msgid %d body %q", msg.RouteID(), msg.MessageID(), msg.Body())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for reply")
+	}
+	rc, err := env.backends.FindConn(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.MessageChan() == nil {
+		t.Fatal("remote conn has no message chan")
+	}
+
+	//范围外的路由由本地处理
+	if err := env.gateway.HandleMessage(1, 42, 8, nil); err != nil {
+		t.Fatal(err)
+	}
+	if msgid := <-env.local; msgid != 8 {
+		t.Fatalf("local route got msgid %d", msgid)
+	}
+
+	//客户端断开后后端释放连接
+	env.gateway.ConnClosed(42)
+	waitFor(t, "backend conn removed", func() bool {
+		_, err := env.backends.FindConn(42)
+		return err != nil
+	})
+}
+
+func TestGatewayBackendKick(t *testing.T) {
+	env := startTestEnv(t)
+	conn := env.addConn(t, 1)
+	if err := env.gateway.HandleMessage(100, 1, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	<-env.routes
+	rc, err := env.backends.FindConn(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.backends.RemoveConn(rc, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ce := waitClosed(t, conn); ce.Reason != connect.CloseKicked {
+		t.Fatalf("close reason %s", ce.Reason)
+	}
+}
+
+func TestGatewayLinkClosed(t *testing.T) {
+	env := startTestEnv(t)
+	forwarded := env.addConn(t, 1)
+	idle := env.addConn(t, 2)
+	if err := env.gateway.HandleMessage(100, 1, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	<-env.routes
+	//链路断开时后端释放远程连接，网关断开转发过的客户端连接
+	b := env.gateway.backends[0]
+	b.mu.Lock()
+	b.conn.Close()
+	b.mu.Unlock()
+	if ce := waitClosed(t, forwarded); ce.Reason != connect.CloseInternal {
+		t.Fatalf("close reason %s", ce.Reason)
+	}
+	select {
+	case err := <-idle.WaitForClosed():
+		t.Fatalf("conn without backend state closed: %v", err)
+	default:
+	}
+	waitFor(t, "backend conn removed", func() bool {
+		_, err := env.backends.FindConn(1)
+		return err != nil
+	})
+	//重连后新的转发重新打开连接
+	waitFor(t, "backend relink", func() bool {
+		return env.gateway.HandleMessage(100, 2, 2, []byte("again")) == nil
+	})
+	if r := <-env.routes; r.conn != 2 || r.body != "again" {
+		t.Fatalf("backend got %+v", r)
+	}
+}
@@ -0,0 +1,26 @@
+package idgen
+
+import (
+	"errors"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/spaolacci/murmur3"
+)
+
+var ErrorIDGen = errors.New("id generator error")
+
+// Generator 连接ID生成器
+type Generator interface {
+	NextID() (int64, error)
+}
+
+// UUIDGenerator UUIDV4的murmur3 64位hash，不依赖节点ID，但存在极小的碰撞概率
+type UUIDGenerator struct{}
+
+func NewUUIDGenerator() *UUIDGenerator {
+	return &UUIDGenerator{}
+}
+
+func (g *UUIDGenerator) NextID() (int64, error) {
+	return int64(murmur3.Sum64(uuid.NewV4().Bytes()) >> 1), nil
+}
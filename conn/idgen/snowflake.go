@@ -0,0 +1,68 @@
+package idgen
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 雪花ID布局 1位符号 | 41位毫秒时间戳 | 10位节点ID | 12位序列号
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+	MaxNode      = 1<<nodeBits - 1
+	maxSequence  = 1<<sequenceBits - 1
+)
+
+// Epoch 雪花ID时间起点 2024-01-01 UTC
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake 雪花ID生成器
+// 同一节点生成的ID严格递增，不同节点ID不同的节点之间不会重复。
+// 时钟回拨时沿用上次的时间戳继续分配序列号，序列号用尽时借用下一毫秒，不阻塞等待
+type Snowflake struct {
+	mu       sync.Mutex
+	node     int64
+	last     int64 //上次分配使用的毫秒时间戳
+	sequence int64
+	now      func() int64
+}
+
+// NewSnowflake 创建雪花ID生成器
+// node:节点ID，范围 0~1023，集群内唯一
+func NewSnowflake(node int64) (*Snowflake, error) {
+	if node < 0 || node > MaxNode {
+		return nil, fmt.Errorf("%w: node %d out of range [0,%d]", ErrorIDGen, node, MaxNode)
+	}
+	return &Snowflake{
+		node: node,
+		now: func() int64 {
+			return time.Since(Epoch).Milliseconds()
+		},
+	}, nil
+}
+
+func (s *Snowflake) NextID() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now > s.last {
+		s.last = now
+		s.sequence = 0
+	} else {
+		s.sequence++
+		if s.sequence > maxSequence {
+			s.last++
+			s.sequence = 0
+		}
+	}
+	if s.last >= 1<<41 {
+		return 0, fmt.Errorf("%w: timestamp overflow", ErrorIDGen)
+	}
+	return s.last<<(nodeBits+sequenceBits) | s.node<<sequenceBits | s.sequence, nil
+}
+
+// Node 解析ID中的节点ID
+func Node(id int64) int64 {
+	return id >> sequenceBits & MaxNode
+}
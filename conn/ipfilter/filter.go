@@ -0,0 +1,271 @@
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/chen102/ggbond/conn/ratelimit"
+)
+
+var (
+	ErrorIPFilter     = errors.New("ip filter error")
+	ErrorDenied       = errors.New("ip denied")
+	ErrorTooManyConns = errors.New("too many connections from ip")
+)
+
+// Filter 远端IP过滤
+// 拒绝列表优先；允许列表非空时只接受其中的地址；非IP地址(例如unix socket)不过滤
+// 列表与单IP连接数上限可在运行时修改，只对之后的新连接生效
+type Filter struct {
+	mu       sync.RWMutex
+	allow    []*net.IPNet
+	deny     []*net.IPNet
+	maxperip int
+	conns    map[string]int //IP -> 当前连接数
+	accept   *ratelimit.Bucket
+	rate     ratelimit.Rate
+}
+
+// Rules 当前规则
+type Rules struct {
+	Allow         []string `json:"allow"`
+	Deny          []string `json:"deny"`
+	MaxConnsPerIP int      `json:"max_conns_per_ip"`
+	AcceptRate    float64  `json:"accept_rate"`
+	AcceptBurst   int      `json:"accept_burst"`
+}
+
+// NewFilter 创建IP过滤器
+func NewFilter(opt ...FilterOption) (*Filter, error) {
+	var options filteroptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			return nil, fmt.Errorf("%w: apply option error:%w", ErrorIPFilter, err)
+		}
+	}
+	f := &Filter{
+		allow:    options.allow,
+		deny:     options.deny,
+		maxperip: options.maxperip,
+		conns:    make(map[string]int),
+	}
+	if options.accept != nil {
+		f.accept = ratelimit.NewBucket(options.accept.Rate, options.accept.Burst)
+		f.rate = *options.accept
+	}
+	return f, nil
+}
+
+// AllowAccept 接受速率检查，超过时应立即关闭新连接
+func (f *Filter) AllowAccept() bool {
+	return f.accept == nil || f.accept.Allow()
+}
+
+// Permitted IP是否被允许，只检查允许、拒绝列表
+func (f *Filter) Permitted(ip net.IP) bool {
+	if ip == nil {
+		return true
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.permitted(ip)
+}
+
+func (f *Filter) permitted(ip net.IP) bool {
+	for _, n := range f.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, n := range f.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Admit 检查新连接并占用该IP的连接数，成功后需在连接关闭时Release
+func (f *Filter) Admit(addr net.Addr) error {
+	ip := IPOf(addr)
+	if ip == nil {
+		return nil
+	}
+	key := ip.String()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.permitted(ip) {
+		return fmt.Errorf("%w: %w: %s", ErrorIPFilter, ErrorDenied, key)
+	}
+	if f.maxperip > 0 && f.conns[key] >= f.maxperip {
+		return fmt.Errorf("%w: %w: %s", ErrorIPFilter, ErrorTooManyConns, key)
+	}
+	f.conns[key]++
+	return nil
+}
+
+// Release 释放Admit占用的连接数
+func (f *Filter) Release(addr net.Addr) {
+	ip := IPOf(addr)
+	if ip == nil {
+		return
+	}
+	key := ip.String()
+	f.mu.Lock()
+	if f.conns[key]--; f.conns[key] <= 0 {
+		delete(f.conns, key)
+	}
+	f.mu.Unlock()
+}
+
+// AddAllow 加入允许列表，cidr可为单个IP
+func (f *Filter) AddAllow(cidr string) error {
+	n, err := ParseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.allow = add(f.allow, n)
+	f.mu.Unlock()
+	return nil
+}
+
+// RemoveAllow 从允许列表移除，不存在时返回false
+func (f *Filter) RemoveAllow(cidr string) (bool, error) {
+	n, err := ParseCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ok bool
+	f.allow, ok = remove(f.allow, n)
+	return ok, nil
+}
+
+// AddDeny 加入拒绝列表，cidr可为单个IP
+func (f *Filter) AddDeny(cidr string) error {
+	n, err := ParseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.deny = add(f.deny, n)
+	f.mu.Unlock()
+	return nil
+}
+
+// RemoveDeny 从拒绝列表移除，不存在时返回false
+func (f *Filter) RemoveDeny(cidr string) (bool, error) {
+	n, err := ParseCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ok bool
+	f.deny, ok = remove(f.deny, n)
+	return ok, nil
+}
+
+// SetMaxConnsPerIP 设置单IP连接数上限，0为不限
+func (f *Filter) SetMaxConnsPerIP(max int) error {
+	if max < 0 {
+		return fmt.Errorf("%w: max conns per ip is not valid", ErrorIPFilter)
+	}
+	f.mu.Lock()
+	f.maxperip = max
+	f.mu.Unlock()
+	return nil
+}
+
+// Rules 当前规则
+func (f *Filter) Rules() Rules {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return Rules{
+		Allow:         strs(f.allow),
+		Deny:          strs(f.deny),
+		MaxConnsPerIP: f.maxperip,
+		AcceptRate:    f.rate.Rate,
+		AcceptBurst:   f.rate.Burst,
+	}
+}
+
+// Conns 各IP当前连接数
+func (f *Filter) Conns() map[string]int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	conns := make(map[string]int, len(f.conns))
+	for ip, n := range f.conns {
+		conns[ip] = n
+	}
+	return conns
+}
+
+// ParseCIDR 解析CIDR，单个IP按/32或/128处理
+func ParseCIDR(s string) (*net.IPNet, error) {
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: cidr is not valid: %s", ErrorIPFilter, s)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// IPOf 地址中的IP，非IP地址返回nil
+func IPOf(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	case nil:
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+func add(list []*net.IPNet, n *net.IPNet) []*net.IPNet {
+	for _, x := range list {
+		if x.String() == n.String() {
+			return list
+		}
+	}
+	return append(list[:len(list):len(list)], n)
+}
+
+// 返回新切片，不修改读取中的旧切片
+func remove(list []*net.IPNet, n *net.IPNet) ([]*net.IPNet, bool) {
+	out := make([]*net.IPNet, 0, len(list))
+	for _, x := range list {
+		if x.String() != n.String() {
+			out = append(out, x)
+		}
+	}
+	return out, len(out) != len(list)
+}
+
+func strs(list []*net.IPNet) []string {
+	out := make([]string, 0, len(list))
+	for _, n := range list {
+		out = append(out, n.String())
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,67 @@
+package ipfilter
+
+import (
+	"errors"
+	"net"
+
+	"github.com/chen102/ggbond/conn/ratelimit"
+)
+
+// FilterOption IP过滤器选项
+type FilterOption func(options *filteroptions) error
+type filteroptions struct {
+	allow    []*net.IPNet
+	deny     []*net.IPNet
+	maxperip int
+	accept   *ratelimit.Rate
+}
+
+// cidrs:允许列表，可为单个IP，设置后只接受其中的地址
+func WithAllow(cidrs ...string) FilterOption {
+	return func(options *filteroptions) error {
+		for _, c := range cidrs {
+			n, err := ParseCIDR(c)
+			if err != nil {
+				return err
+			}
+			options.allow = add(options.allow, n)
+		}
+		return nil
+	}
+}
+
+// cidrs:拒绝列表，可为单个IP，优先于允许列表
+func WithDeny(cidrs ...string) FilterOption {
+	return func(options *filteroptions) error {
+		for _, c := range cidrs {
+			n, err := ParseCIDR(c)
+			if err != nil {
+				return err
+			}
+			options.deny = add(options.deny, n)
+		}
+		return nil
+	}
+}
+
+// max:单个IP的最大连接数，0为不限
+func WithMaxConnsPerIP(max int) FilterOption {
+	return func(options *filteroptions) error {
+		if max < 0 {
+			return errors.New("max conns per ip is not valid")
+		}
+		options.maxperip = max
+		return nil
+	}
+}
+
+// rate:每秒接受的新连接数 burst:允许的突发连接数，超过时新连接立即关闭，用于吸收重连风暴
+func WithAcceptRate(rate float64, burst int) FilterOption {
+	return func(options *filteroptions) error {
+		if rate <= 0 || burst < 1 {
+			return errors.New("accept rate is not valid")
+		}
+		options.accept = &ratelimit.Rate{Rate: rate, Burst: burst}
+		return nil
+	}
+}
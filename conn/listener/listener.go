@@ -0,0 +1,207 @@
+package listener
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var ErrorListener = errors.New("listener error")
+
+// 监听类型
+const (
+	TCP  = "tcp"  //TCP
+	TLS  = "tls"  //TLS over TCP
+	WS   = "ws"   //WebSocket
+	WSS  = "wss"  //WebSocket over TLS
+	UNIX = "unix" //Unix域套接字，用于本机sidecar
+)
+
+// ProxyWrapper PROXY协议解析，见proxyproto.Parser
+type ProxyWrapper interface {
+	Wrap(conn net.Conn) (net.Conn, error)
+}
+
+// Stats 监听器统计
+type Stats struct {
+	Name     string `json:"name"`
+	Network  string `json:"network"`
+	Addr     string `json:"addr"`
+	Accepted uint64 `json:"accepted"` //累计建立的连接数
+	Rejected uint64 `json:"rejected"` //累计拒绝的连接数，含握手失败
+	Active   int64  `json:"active"`   //当前连接数
+}
+
+// Listener 一个监听地址
+// 接受的连接经Upgrade完成TLS、WebSocket握手后，与TCP连接一样按消息协议读写
+type Listener struct {
+	name      string
+	network   string
+	addr      string
+	tls       *tls.Config
+	path      string
+	proxy     ProxyWrapper
+	handshake time.Duration
+	maxsize   uint64
+	ln        net.Listener
+
+	accepted uint64
+	rejected uint64
+	active   int64
+}
+
+// New 创建监听器，Listen后开始监听
+// network:tcp tls ws wss unix addr:监听地址，unix时为套接字文件路径
+func New(network, addr string, opt ...ListenerOption) (*Listener, error) {
+	var options listeneroptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			return nil, fmt.Errorf("%w: apply option error:%w", ErrorListener, err)
+		}
+	}
+	switch network {
+	case TCP, WS, UNIX:
+	case TLS, WSS:
+		if options.tls == nil {
+			return nil, fmt.Errorf("%w: %s listener requires tls config", ErrorListener, network)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown network %s", ErrorListener, network)
+	}
+	l := &Listener{
+		name:      network + "://" + addr,
+		network:   network,
+		addr:      addr,
+		tls:       options.tls,
+		path:      options.path,
+		proxy:     options.proxy,
+		handshake: 10 * time.Second,
+		maxsize:   maxMessageSize,
+	}
+	if options.name != "" {
+		l.name = options.name
+	}
+	if options.handshake != nil {
+		l.handshake = *options.handshake
+	}
+	if options.maxsize != nil {
+		l.maxsize = *options.maxsize
+	}
+	return l, nil
+}
+
+// Listen 开始监听，unix套接字文件已存在时先删除
+func (l *Listener) Listen() error {
+	network := "tcp"
+	if l.network == UNIX {
+		network = "unix"
+		if fi, err := os.Stat(l.addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(l.addr); err != nil {
+				return fmt.Errorf("%w: %w", ErrorListener, err)
+			}
+		}
+	}
+	ln, err := net.Listen(network, l.addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorListener, err)
+	}
+	l.ln = ln
+	return nil
+}
+
+// Accept 接受一个连接，握手在Upgrade中进行，不阻塞接受循环
+func (l *Listener) Accept() (net.Conn, error) {
+	return l.ln.Accept()
+}
+
+// Close 停止监听
+func (l *Listener) Close() error {
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Close()
+}
+
+// Name 监听器名称，默认为 network://addr
+func (l *Listener) Name() string {
+	return l.name
+}
+
+// Network 监听类型
+func (l *Listener) Network() string {
+	return l.network
+}
+
+// Addr 实际监听地址，未监听时为配置的地址
+func (l *Listener) Addr() string {
+	if l.ln != nil {
+		return l.ln.Addr().String()
+	}
+	return l.addr
+}
+
+// Proxy 该监听器的PROXY协议解析器，未设置时为nil
+func (l *Listener) Proxy() ProxyWrapper {
+	return l.proxy
+}
+
+// Upgrade 完成TLS、WebSocket握手，返回可按消息协议读写的连接
+// 握手期间设置的超时在返回前清除
+func (l *Listener) Upgrade(conn net.Conn) (net.Conn, error) {
+	if l.network == TCP || l.network == UNIX {
+		return conn, nil
+	}
+	if err := conn.SetDeadline(time.Now().Add(l.handshake)); err != nil {
+		return nil, err
+	}
+	if l.network == TLS || l.network == WSS {
+		tlsconn := tls.Server(conn, l.tls)
+		if err := tlsconn.Handshake(); err != nil {
+			return nil, fmt.Errorf("%w: tls handshake error:%w", ErrorListener, err)
+		}
+		conn = tlsconn
+	}
+	if l.network == WS || l.network == WSS {
+		wsconn, err := upgradeWebSocket(conn, l.path, l.maxsize)
+		if err != nil {
+			return nil, err
+		}
+		conn = wsconn
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Opened 记录一个建立的连接
+func (l *Listener) Opened() {
+	atomic.AddUint64(&l.accepted, 1)
+	atomic.AddInt64(&l.active, 1)
+}
+
+// Closed 记录一个关闭的连接，与Opened成对调用
+func (l *Listener) Closed() {
+	atomic.AddInt64(&l.active, -1)
+}
+
+// Rejected 记录一个被拒绝的连接
+func (l *Listener) Rejected() {
+	atomic.AddUint64(&l.rejected, 1)
+}
+
+// Stats 当前统计
+func (l *Listener) Stats() Stats {
+	return Stats{
+		Name:     l.name,
+		Network:  l.network,
+		Addr:     l.Addr(),
+		Accepted: atomic.LoadUint64(&l.accepted),
+		Rejected: atomic.LoadUint64(&l.rejected),
+		Active:   atomic.LoadInt64(&l.active),
+	}
+}
@@ -0,0 +1,94 @@
+package listener
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ListenerOption 监听器选项
+type ListenerOption func(options *listeneroptions) error
+type listeneroptions struct {
+	name      string
+	tls       *tls.Config
+	path      string
+	proxy     ProxyWrapper
+	handshake *time.Duration
+	maxsize   *uint64
+}
+
+// name:监听器名称，用于日志与统计，默认为 network://addr
+func WithName(name string) ListenerOption {
+	return func(options *listeneroptions) error {
+		options.name = name
+		return nil
+	}
+}
+
+// config:TLS配置，tls、wss监听器必须设置
+func WithTLSConfig(config *tls.Config) ListenerOption {
+	return func(options *listeneroptions) error {
+		if config == nil {
+			return errors.New("tls config is nil")
+		}
+		options.tls = config
+		return nil
+	}
+}
+
+// certfile、keyfile:PEM格式的证书与私钥文件，tls、wss监听器可用此代替WithTLSConfig
+func WithCertFile(certfile, keyfile string) ListenerOption {
+	return func(options *listeneroptions) error {
+		cert, err := tls.LoadX509KeyPair(certfile, keyfile)
+		if err != nil {
+			return err
+		}
+		options.tls = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		return nil
+	}
+}
+
+// path:WebSocket握手的请求路径，为空时接受任意路径
+func WithPath(path string) ListenerOption {
+	return func(options *listeneroptions) error {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			return errors.New("path is not valid")
+		}
+		options.path = path
+		return nil
+	}
+}
+
+// proxy:该监听器的PROXY协议解析器，未设置时使用服务器的解析器
+func WithProxyProtocol(proxy ProxyWrapper) ListenerOption {
+	return func(options *listeneroptions) error {
+		if proxy == nil {
+			return errors.New("proxy protocol is nil")
+		}
+		options.proxy = proxy
+		return nil
+	}
+}
+
+// timeout:TLS、WebSocket握手超时时间，默认10秒
+func WithHandshakeTimeout(timeout time.Duration) ListenerOption {
+	return func(options *listeneroptions) error {
+		if timeout <= 0 {
+			return errors.New("handshake timeout is not valid")
+		}
+		options.handshake = &timeout
+		return nil
+	}
+}
+
+// size:WebSocket数据帧的最大负载长度，超过时断开连接，默认为消息协议可表示的最大消息长度
+func WithMaxFrameSize(size uint64) ListenerOption {
+	return func(options *listeneroptions) error {
+		if size == 0 || size > maxMessageSize {
+			return errors.New("max frame size is not valid")
+		}
+		options.maxsize = &size
+		return nil
+	}
+}
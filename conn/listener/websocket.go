@@ -0,0 +1,214 @@
+package listener
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chen102/ggbond/message"
+)
+
+// RFC 6455 握手时拼接在Sec-WebSocket-Key之后的固定GUID
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// 默认的数据帧最大负载，为消息协议可表示的最大消息长度
+const maxMessageSize = message.HeaderSize + message.TraceSize + math.MaxInt32
+
+// 完成WebSocket握手，失败时回复错误状态
+// maxsize:数据帧负载长度上限
+func upgradeWebSocket(conn net.Conn, path string, maxsize uint64) (net.Conn, error) {
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: websocket handshake error:%w", ErrorListener, err)
+	}
+	status := http.StatusBadRequest
+	switch {
+	case req.Method != http.MethodGet:
+		status = http.StatusMethodNotAllowed
+	case path != "" && req.URL.Path != path:
+		status = http.StatusNotFound
+	case !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") || !headerContains(req.Header, "Connection", "upgrade"):
+	case req.Header.Get("Sec-WebSocket-Version") != "13":
+		status = http.StatusUpgradeRequired
+	case req.Header.Get("Sec-WebSocket-Key") == "":
+	default:
+		status = http.StatusSwitchingProtocols
+	}
+	if status != http.StatusSwitchingProtocols {
+		_, _ = fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nSec-WebSocket-Version: 13\r\nConnection: close\r\n\r\n", status, http.StatusText(status))
+		return nil, fmt.Errorf("%w: websocket handshake error: %s %s", ErrorListener, req.Method, req.URL.Path)
+	}
+	sum := sha1.Sum([]byte(req.Header.Get("Sec-WebSocket-Key") + websocketGUID))
+	accept := base64.StdEncoding.EncodeToString(sum[:])
+	if _, err := fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept); err != nil {
+		return nil, fmt.Errorf("%w: websocket handshake error:%w", ErrorListener, err)
+	}
+	return &wsConn{Conn: conn, r: br, maxsize: maxsize}, nil
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn WebSocket连接
+// 数据帧的负载按到达顺序拼接为字节流，消息协议的分帧与TCP相同；每次Write发送一个二进制帧
+// 控制帧在Read中处理：回复ping，收到close时回复并返回io.EOF
+type wsConn struct {
+	net.Conn
+	r         *bufio.Reader
+	maxsize   uint64 //数据帧负载长度上限
+	wmu       sync.Mutex
+	remaining uint64 //当前数据帧未读的负载长度
+	mask      [4]byte
+	pos       uint64
+	closeonce sync.Once
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	for i := 0; i < n; i++ {
+		p[i] ^= c.mask[(c.pos+uint64(i))%4]
+	}
+	c.pos += uint64(n)
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// 读取帧头，处理控制帧，直到遇到数据帧
+func (c *wsConn) nextFrame() error {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return err
+	}
+	fin, opcode := head[0]&0x80 != 0, head[0]&0x0f
+	if head[1]&0x80 == 0 {
+		return fmt.Errorf("%w: websocket client frame is not masked", ErrorListener)
+	}
+	//控制帧不能分片
+	if opcode >= opClose && !fin {
+		return fmt.Errorf("%w: websocket control frame is fragmented", ErrorListener)
+	}
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > c.maxsize {
+		return fmt.Errorf("%w: websocket frame length %d exceeds %d", ErrorListener, length, c.maxsize)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return err
+	}
+	switch opcode {
+	case opContinuation, opText, opBinary:
+		c.remaining, c.mask, c.pos = length, mask, 0
+		return nil
+	case opClose, opPing, opPong:
+		if length > 125 {
+			return fmt.Errorf("%w: websocket control frame is too long", ErrorListener)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+		switch opcode {
+		case opPing:
+			return c.writeFrame(opPong, payload)
+		case opClose:
+			c.sendClose(payload)
+			return io.EOF
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: websocket opcode %d is not supported", ErrorListener, opcode)
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// 服务端帧不加掩码
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// 发送close帧，只发送一次
+func (c *wsConn) sendClose(payload []byte) {
+	c.closeonce.Do(func() {
+		_ = c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_ = c.writeFrame(opClose, payload)
+	})
+}
+
+// Close 发送close帧(1000 正常关闭)后关闭底层连接
+func (c *wsConn) Close() error {
+	c.sendClose([]byte{0x03, 0xe8})
+	return c.Conn.Close()
+}
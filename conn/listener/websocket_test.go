@@ -0,0 +1,217 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// 在本机空闲端口上启动ws监听器，返回握手后的服务端连接与客户端连接
+func wsPair(t *testing.T, path string, opt ...ListenerOption) (net.Conn, net.Conn, *bufio.Reader) {
+	t.Helper()
+	opt = append([]ListenerOption{WithPath("/ws")}, opt...)
+	l, err := New(WS, "127.0.0.1:0", opt...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			accepted <- result{nil, err}
+			return
+		}
+		conn, err = l.Upgrade(conn)
+		accepted <- result{conn, err}
+	}()
+	client, err := net.Dial("tcp", l.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	req := "GET " + path + " HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := client.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(client)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-accepted
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		if res.err == nil {
+			t.Fatal("upgrade succeeded with status", resp.StatusCode)
+		}
+		return nil, client, br
+	}
+	//RFC 6455 示例中的握手结果
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("accept %q", accept)
+	}
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	t.Cleanup(func() { res.conn.Close() })
+	_ = res.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return res.conn, client, br
+}
+
+// 客户端帧，按RFC 6455加掩码
+func clientFrame(fin bool, opcode byte, payload []byte) []byte {
+	b := []byte{opcode}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, 0x80|byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x80|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0x80|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	b = append(b, mask...)
+	for i, v := range payload {
+		b = append(b, v^mask[i%4])
+	}
+	return b
+}
+
+// 读取一个服务端帧
+func readServerFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	if head[0]&0x80 == 0 || head[1]&0x80 != 0 {
+		t.Fatalf("server frame head %x", head)
+	}
+	length := uint64(head[1])
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, _ = io.ReadFull(r, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, _ = io.ReadFull(r, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0f, payload
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	server, client, br := wsPair(t, "/ws")
+	large := bytes.Repeat([]byte("0123456789"), 100)
+	var frames []byte
+	frames = append(frames, clientFrame(true, opBinary, []byte("hello"))...)
+	//分片数据帧之间插入ping
+	frames = append(frames, clientFrame(false, opBinary, []byte("wor"))...)
+	frames = append(frames, clientFrame(true, opPing, []byte("p"))...)
+	frames = append(frames, clientFrame(true, opContinuation, []byte("ld"))...)
+	frames = append(frames, clientFrame(true, opBinary, large)...)
+	if _, err := client.Write(frames); err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte("helloworld"), large...)
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("server read %q", got)
+	}
+	if op, payload := readServerFrame(t, br); op != opPong || string(payload) != "p" {
+		t.Fatalf("pong %d %q", op, payload)
+	}
+
+	//服务端写入为一个二进制帧
+	if _, err := server.Write([]byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	if op, payload := readServerFrame(t, br); op != opBinary || string(payload) != "reply" {
+		t.Fatalf("server frame %d %q", op, payload)
+	}
+
+	//收到close时回复close并返回EOF
+	if _, err := client.Write(clientFrame(true, opClose, []byte{0x03, 0xe8})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Read(got); err != io.EOF {
+		t.Fatalf("read after close: %v", err)
+	}
+	if op, payload := readServerFrame(t, br); op != opClose || !bytes.Equal(payload, []byte{0x03, 0xe8}) {
+		t.Fatalf("close reply %d %x", op, payload)
+	}
+	//关闭时不再重复发送close
+	server.Close()
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("data after close frame: %v", err)
+	}
+}
+
+func TestWebSocketInvalidFrames(t *testing.T) {
+	fragmentedPing := clientFrame(true, opPing, []byte("p"))
+	fragmentedPing[0] &^= 0x80
+	unmasked := []byte{0x80 | opBinary, 1, 'x'}
+	huge := []byte{0x80 | opBinary, 0x80 | 127}
+	huge = binary.BigEndian.AppendUint64(huge, 1<<63)
+	huge = append(huge, 0, 0, 0, 0)
+	for _, c := range []struct {
+		name  string
+		frame []byte
+		opt   []ListenerOption
+	}{
+		{"unmasked", unmasked, nil},
+		{"fragmented control", fragmentedPing, nil},
+		{"long control", clientFrame(true, opPing, make([]byte, 126)), nil},
+		{"length beyond protocol", huge, nil},
+		{"length beyond limit", clientFrame(true, opBinary, make([]byte, 200)), []ListenerOption{WithMaxFrameSize(100)}},
+		{"unknown opcode", clientFrame(true, 0x3, nil), nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			server, client, _ := wsPair(t, "/ws", c.opt...)
+			if _, err := client.Write(c.frame); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := server.Read(make([]byte, 16)); !errors.Is(err, ErrorListener) {
+				t.Fatalf("read invalid frame: %v", err)
+			}
+		})
+	}
+}
+
+func TestWebSocketHandshakeRejected(t *testing.T) {
+	server, _, _ := wsPair(t, "/other")
+	if server != nil {
+		t.Fatal("upgraded on wrong path")
+	}
+	if _, err := New(WS, "127.0.0.1:0", WithMaxFrameSize(0)); err == nil {
+		t.Fatal("zero max frame size accepted")
+	}
+}
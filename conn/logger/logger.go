@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// 库内共享的日志，未通过选项注入日志的组件使用
+var global atomic.Value
+
+func init() {
+	global.Store(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})))
+}
+
+// L 库日志，默认以Info级别输出到标准错误
+func L() *slog.Logger {
+	return global.Load().(*slog.Logger)
+}
+
+// Set 替换库日志，nil时静默
+func Set(l *slog.Logger) {
+	if l == nil {
+		l = Discard()
+	}
+	global.Store(l)
+}
+
+// New 创建日志
+// level:debug info warn error，off时静默 format:text json
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lv slog.Level
+	switch strings.ToLower(level) {
+	case "off":
+		return Discard(), nil
+	case "debug":
+		lv = slog.LevelDebug
+	case "info", "":
+		lv = slog.LevelInfo
+	case "warn":
+		lv = slog.LevelWarn
+	case "error":
+		lv = slog.LevelError
+	default:
+		return nil, fmt.Errorf("log level is not valid: %s", level)
+	}
+	opts := &slog.HandlerOptions{Level: lv}
+	switch format {
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("log format is not valid: %s", format)
+}
+
+// Discard 丢弃全部日志
+func Discard() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// Conn 附加连接字段:连接ID、远端地址
+// conn:底层连接，非net.Conn时不附加远端地址
+func Conn(l *slog.Logger, connid int64, conn interface{}) *slog.Logger {
+	if nc, ok := conn.(net.Conn); ok && nc.RemoteAddr() != nil {
+		return l.With(slog.Int64("conn", connid), slog.String("remote", nc.RemoteAddr().String()))
+	}
+	return l.With(slog.Int64("conn", connid))
+}
@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sample 日志采样，用于每条消息都会触发的热路径日志
+// 同一级别、同一消息在每个tick周期内先输出first条，之后每thereafter条输出一条，thereafter为0时丢弃其余日志
+func Sample(l *slog.Logger, first, thereafter int, tick time.Duration) *slog.Logger {
+	if first < 0 {
+		first = 0
+	}
+	if thereafter < 0 {
+		thereafter = 0
+	}
+	if tick <= 0 {
+		tick = time.Second
+	}
+	return slog.New(&sampler{
+		Handler:    l.Handler(),
+		first:      uint64(first),
+		thereafter: uint64(thereafter),
+		tick:       int64(tick),
+		counters:   &sync.Map{},
+	})
+}
+
+type sampler struct {
+	slog.Handler
+	first      uint64
+	thereafter uint64
+	tick       int64
+	counters   *sync.Map //级别+消息 -> *counter，派生的handler共享计数
+}
+
+type counter struct {
+	reset int64 //本周期结束时间 unix纳秒
+	n     uint64
+}
+
+func (s *sampler) Handle(ctx context.Context, r slog.Record) error {
+	key := r.Level.String() + "\x00" + r.Message
+	v, ok := s.counters.Load(key)
+	if !ok {
+		v, _ = s.counters.LoadOrStore(key, &counter{})
+	}
+	c := v.(*counter)
+	now := r.Time.UnixNano()
+	if reset := atomic.LoadInt64(&c.reset); now >= reset && atomic.CompareAndSwapInt64(&c.reset, reset, now+s.tick) {
+		atomic.StoreUint64(&c.n, 0)
+	}
+	n := atomic.AddUint64(&c.n, 1)
+	if n <= s.first || (s.thereafter > 0 && (n-s.first)%s.thereafter == 0) {
+		return s.Handler.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (s *sampler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sampler{Handler: s.Handler.WithAttrs(attrs), first: s.first, thereafter: s.thereafter, tick: s.tick, counters: s.counters}
+}
+
+func (s *sampler) WithGroup(name string) slog.Handler {
+	return &sampler{Handler: s.Handler.WithGroup(name), first: s.first, thereafter: s.thereafter, tick: s.tick, counters: s.counters}
+}
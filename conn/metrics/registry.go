@@ -0,0 +1,363 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets 默认直方图分桶(秒)，覆盖0.1ms~10s的处理耗时
+var DefaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// Registry 指标注册表，以Prometheus文本格式输出
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]struct{}
+}
+
+type collector interface {
+	describe() (name, help, typ string)
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name, _, _ := c.describe()
+	if _, ok := r.names[name]; ok {
+		panic("metric already registered: " + name)
+	}
+	r.names[name] = struct{}{}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo 按注册顺序输出全部指标
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		name, help, typ := c.describe()
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler /metrics 处理器
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// vec 带标签的指标，标签值组合 -> 子指标
+type vec[T any] struct {
+	name, help string
+	labels     []string
+	mu         sync.RWMutex
+	children   map[string]*T
+	order      []string
+	newchild   func() *T
+}
+
+func (v *vec[T]) with(values ...string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	c, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.children[key]; ok {
+		return c
+	}
+	c = v.newchild()
+	v.children[key] = c
+	v.order = append(v.order, key)
+	return c
+}
+
+// 按标签值排序遍历，输出稳定
+func (v *vec[T]) each(f func(labels string, c *T)) {
+	v.mu.RLock()
+	keys := make([]string, len(v.order))
+	copy(keys, v.order)
+	v.mu.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.mu.RLock()
+		c := v.children[key]
+		v.mu.RUnlock()
+		f(v.labelString(key), c)
+	}
+}
+
+func (v *vec[T]) labelString(key string) string {
+	if len(v.labels) == 0 {
+		return ""
+	}
+	values := strings.Split(key, "\xff")
+	pairs := make([]string, len(v.labels))
+	for i, l := range v.labels {
+		pairs[i] = l + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+// atomicFloat 原子浮点数
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) add(d float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		v := math.Float64bits(math.Float64frombits(old) + d)
+		if atomic.CompareAndSwapUint64(&f.bits, old, v) {
+			return
+		}
+	}
+}
+func (f *atomicFloat) set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// Counter 只增计数器
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add 增加计数，负数忽略
+func (c *Counter) Add(d float64) {
+	if d > 0 {
+		c.v.add(d)
+	}
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	vec[Counter]
+}
+
+// NewCounter 注册计数器，labels为空时使用With()获取唯一的计数器
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec[Counter]{name: name, help: help, labels: labels, children: make(map[string]*Counter), newchild: func() *Counter { return &Counter{} }}}
+	r.register(c)
+	return c
+}
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(values...)
+}
+func (c *CounterVec) describe() (string, string, string) {
+	return c.name, c.help, "counter"
+}
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.each(func(labels string, child *Counter) {
+		writeSample(w, c.name, labels, child.v.load())
+	})
+}
+
+// Gauge 可增减的量
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64) {
+	g.v.set(v)
+}
+func (g *Gauge) Add(d float64) {
+	g.v.add(d)
+}
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+// GaugeVec 带标签的量
+type GaugeVec struct {
+	vec[Gauge]
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec[Gauge]{name: name, help: help, labels: labels, children: make(map[string]*Gauge), newchild: func() *Gauge { return &Gauge{} }}}
+	r.register(g)
+	return g
+}
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.with(values...)
+}
+func (g *GaugeVec) describe() (string, string, string) {
+	return g.name, g.help, "gauge"
+}
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.each(func(labels string, child *Gauge) {
+		writeSample(w, g.name, labels, child.v.load())
+	})
+}
+
+// Sample 采集时计算的一个样本
+type Sample struct {
+	Labels []string //与注册时的标签名一一对应
+	Value  float64
+}
+
+// funcCollector 采集时回调计算的指标，例如队列长度、池命中率
+type funcCollector struct {
+	name, help, typ string
+	labels          []string
+	f               func() []Sample
+}
+
+// NewGaugeFunc 注册采集时计算的量
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, f func() []Sample) {
+	r.register(&funcCollector{name: name, help: help, typ: "gauge", labels: labels, f: f})
+}
+
+// NewCounterFunc 注册采集时计算的计数器，f返回值需单调递增
+func (r *Registry) NewCounterFunc(name, help string, labels []string, f func() []Sample) {
+	r.register(&funcCollector{name: name, help: help, typ: "counter", labels: labels, f: f})
+}
+func (c *funcCollector) describe() (string, string, string) {
+	return c.name, c.help, c.typ
+}
+func (c *funcCollector) write(w *bufio.Writer) {
+	for _, s := range c.f() {
+		pairs := make([]string, 0, len(c.labels))
+		for i, l := range c.labels {
+			if i < len(s.Labels) {
+				pairs = append(pairs, l+`="`+escapeLabel(s.Labels[i])+`"`)
+			}
+		}
+		writeSample(w, c.name, strings.Join(pairs, ","), s.Value)
+	}
+}
+
+// Histogram 直方图
+type Histogram struct {
+	buckets []float64
+	counts  []uint64 //counts[i] 落在(buckets[i-1],buckets[i]]的样本数，最后一个为+Inf
+	sum     atomicFloat
+	count   uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	h.sum.add(v)
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	vec[Histogram]
+	buckets []float64
+}
+
+// NewHistogram 注册直方图，buckets为空时使用DefaultBuckets
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{buckets: buckets}
+	h.vec = vec[Histogram]{name: name, help: help, labels: labels, children: make(map[string]*Histogram), newchild: func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+	}}
+	r.register(h)
+	return h
+}
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values...)
+}
+func (h *HistogramVec) describe() (string, string, string) {
+	return h.name, h.help, "histogram"
+}
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.each(func(labels string, child *Histogram) {
+		sep := ""
+		if labels != "" {
+			sep = ","
+		}
+		var cumulative uint64
+		for i, b := range child.buckets {
+			cumulative += atomic.LoadUint64(&child.counts[i])
+			writeSample(w, h.name+"_bucket", labels+sep+`le="`+formatFloat(b)+`"`, float64(cumulative))
+		}
+		cumulative += atomic.LoadUint64(&child.counts[len(child.buckets)])
+		writeSample(w, h.name+"_bucket", labels+sep+`le="+Inf"`, float64(cumulative))
+		writeSample(w, h.name+"_sum", labels, child.sum.load())
+		writeSample(w, h.name+"_count", labels, float64(atomic.LoadUint64(&child.count)))
+	})
+}
+
+func writeSample(w *bufio.Writer, name, labels string, v float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/message"
+)
+
+// ConnLister 连接列表，用于采集发送队列长度
+type ConnLister interface {
+	AllConn() map[int64]connect.ITCPConn
+}
+
+// PoolStater 消息对象池统计
+type PoolStater interface {
+	Stats() map[string]message.PoolStats
+}
+
+// MaxRoutes 路由标签的最大取值数，超出后记为other，防止客户端发送任意路由ID导致标签膨胀
+const MaxRoutes = 256
+
+// ServerMetrics 服务器指标
+type ServerMetrics struct {
+	registry       *Registry
+	routesmu       sync.RWMutex
+	routes         map[int32]string
+	connsCurrent   *Gauge
+	connsTotal     *Counter
+	connsRejected  *CounterVec
+	connsClosed    *CounterVec
+	messagesIn     *CounterVec
+	messagesOut    *CounterVec
+	bytesIn        *CounterVec
+	bytesOut       *CounterVec
+	handleDuration *HistogramVec
+	sendDropped    *Counter
+	rateLimited    *CounterVec
+	health         *CounterVec
+}
+
+// NewServerMetrics 在注册表中注册服务器指标
+func NewServerMetrics(registry *Registry) *ServerMetrics {
+	return &ServerMetrics{
+		registry:       registry,
+		routes:         make(map[int32]string),
+		connsCurrent:   registry.NewGauge("ggbond_connections_current", "Current number of client connections.").With(),
+		connsTotal:     registry.NewCounter("ggbond_connections_total", "Total number of accepted client connections.").With(),
+		connsRejected:  registry.NewCounter("ggbond_connections_rejected_total", "Total number of rejected client connections.", "reason"),
+		connsClosed:    registry.NewCounter("ggbond_connections_closed_total", "Total number of closed client connections by close reason.", "reason"),
+		messagesIn:     registry.NewCounter("ggbond_messages_in_total", "Total number of messages received per route.", "route"),
+		messagesOut:    registry.NewCounter("ggbond_messages_out_total", "Total number of messages sent per route.", "route"),
+		bytesIn:        registry.NewCounter("ggbond_bytes_in_total", "Total bytes received per route, including frame header.", "route"),
+		bytesOut:       registry.NewCounter("ggbond_bytes_out_total", "Total bytes sent per route, including frame header.", "route"),
+		handleDuration: registry.NewHistogram("ggbond_handler_duration_seconds", "Route handler latency in seconds.", nil, "route"),
+		sendDropped:    registry.NewCounter("ggbond_send_dropped_total", "Total number of messages dropped because the send queue was full.").With(),
+		rateLimited:    registry.NewCounter("ggbond_rate_limited_total", "Total number of rate limited messages by limit scope and action.", "scope", "action"),
+		health:         registry.NewCounter("ggbond_health_transitions_total", "Total number of health check state transitions.", "from", "to"),
+	}
+}
+
+// Registry 指标所在注册表
+func (m *ServerMetrics) Registry() *Registry {
+	return m.registry
+}
+
+// Watch 注册采集时计算的指标:发送队列长度、消息对象池命中率
+func (m *ServerMetrics) Watch(conns ConnLister, pool PoolStater) {
+	m.registry.NewGaugeFunc("ggbond_send_queue_depth", "Total number of messages waiting in connection send queues.", nil, func() []Sample {
+		depth := 0
+		for _, conn := range conns.AllConn() {
+			if ch := conn.MessageChan(); ch != nil {
+				depth += len(ch)
+			}
+		}
+		return []Sample{{Value: float64(depth)}}
+	})
+	m.registry.NewCounterFunc("ggbond_pool_gets_total", "Total number of message pool gets.", []string{"type"}, func() []Sample {
+		var samples []Sample
+		for t, s := range pool.Stats() {
+			samples = append(samples, Sample{Labels: []string{t}, Value: float64(s.Gets)})
+		}
+		return samples
+	})
+	m.registry.NewCounterFunc("ggbond_pool_misses_total", "Total number of message pool gets that allocated a new message.", []string{"type"}, func() []Sample {
+		var samples []Sample
+		for t, s := range pool.Stats() {
+			samples = append(samples, Sample{Labels: []string{t}, Value: float64(s.Misses)})
+		}
+		return samples
+	})
+	m.registry.NewGaugeFunc("ggbond_pool_hit_ratio", "Ratio of message pool gets served from the pool.", []string{"type"}, func() []Sample {
+		var samples []Sample
+		for t, s := range pool.Stats() {
+			ratio := 0.0
+			if s.Gets > 0 {
+				ratio = float64(s.Gets-s.Misses) / float64(s.Gets)
+			}
+			samples = append(samples, Sample{Labels: []string{t}, Value: ratio})
+		}
+		return samples
+	})
+}
+
+func (m *ServerMetrics) route(routeid int32) string {
+	m.routesmu.RLock()
+	label, ok := m.routes[routeid]
+	m.routesmu.RUnlock()
+	if ok {
+		return label
+	}
+	m.routesmu.Lock()
+	defer m.routesmu.Unlock()
+	if label, ok := m.routes[routeid]; ok {
+		return label
+	}
+	if len(m.routes) >= MaxRoutes {
+		return "other"
+	}
+	label = strconv.Itoa(int(routeid))
+	m.routes[routeid] = label
+	return label
+}
+
+func (m *ServerMetrics) ConnAccepted() {
+	m.connsTotal.Inc()
+	m.connsCurrent.Inc()
+}
+
+// ConnClosed 连接关闭 reason:关闭原因
+func (m *ServerMetrics) ConnClosed(reason string) {
+	m.connsCurrent.Dec()
+	m.connsClosed.With(reason).Inc()
+}
+
+func (m *ServerMetrics) ConnRejected(reason string) {
+	m.connsRejected.With(reason).Inc()
+}
+
+// MessageIn 收到消息 size:消息体长度
+func (m *ServerMetrics) MessageIn(routeid int32, size int) {
+	route := m.route(routeid)
+	m.messagesIn.With(route).Inc()
+	m.bytesIn.With(route).Add(float64(size + message.HeaderSize))
+}
+
+// MessageOut 发出消息 size:消息体长度
+func (m *ServerMetrics) MessageOut(routeid int32, size int) {
+	route := m.route(routeid)
+	m.messagesOut.With(route).Inc()
+	m.bytesOut.With(route).Add(float64(size + message.HeaderSize))
+}
+
+func (m *ServerMetrics) HandleDuration(routeid int32, d time.Duration) {
+	m.handleDuration.With(m.route(routeid)).Observe(d.Seconds())
+}
+
+func (m *ServerMetrics) SendDropped() {
+	m.sendDropped.Inc()
+}
+
+// RateLimited 消息超限 scope:超限范围 action:处理方式
+func (m *ServerMetrics) RateLimited(scope, action string) {
+	m.rateLimited.With(scope, action).Inc()
+}
+
+func (m *ServerMetrics) HealthTransition(from, to connect.ConnStat) {
+	m.health.With(from.String(), to.String()).Inc()
+}
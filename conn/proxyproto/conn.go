@@ -0,0 +1,86 @@
+package proxyproto
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/chen102/ggbond/conn/ipfilter"
+)
+
+// Conn 经代理的连接，RemoteAddr为PROXY头中的客户端地址
+type Conn struct {
+	net.Conn
+	source net.Addr
+}
+
+// RemoteAddr 客户端地址
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.source
+}
+
+// ProxyAddr 代理地址，即底层连接的远端地址
+func (c *Conn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+// Parser PROXY协议解析器
+// 来自可信代理的连接必须携带v1或v2头，其他连接按直连处理，不解析，避免客户端伪造地址
+type Parser struct {
+	trusted []*net.IPNet
+	timeout time.Duration
+}
+
+// NewParser 创建PROXY协议解析器
+func NewParser(opt ...ParserOption) (*Parser, error) {
+	var options parseroptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			return nil, fmt.Errorf("%w: apply option error:%w", ErrorProxyProtocol, err)
+		}
+	}
+	if len(options.trusted) == 0 {
+		return nil, fmt.Errorf("%w: trusted proxy is required", ErrorProxyProtocol)
+	}
+	p := &Parser{trusted: options.trusted, timeout: 5 * time.Second}
+	if options.timeout != nil {
+		p.timeout = *options.timeout
+	}
+	return p, nil
+}
+
+// Trusted 远端地址是否为可信代理
+func (p *Parser) Trusted(addr net.Addr) bool {
+	ip := ipfilter.IPOf(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap 读取可信代理连接的PROXY头，返回以客户端地址为RemoteAddr的连接
+// 非可信代理的连接与LOCAL连接原样返回；读取时设置的读超时在返回前清除
+func (p *Parser) Wrap(conn net.Conn) (net.Conn, error) {
+	if !p.Trusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(p.timeout)); err != nil {
+		return nil, err
+	}
+	h, err := ReadHeader(conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	if h.Local || h.Source == nil {
+		return conn, nil
+	}
+	return &Conn{Conn: conn, source: h.Source}, nil
+}
@@ -0,0 +1,135 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var ErrorProxyProtocol = errors.New("proxy protocol error")
+
+// v2签名，v1头至少15字节，先读12字节即可区分两个版本
+var signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const maxV1Length = 107 //v1头最大长度，含\r\n
+
+// Header PROXY协议头
+type Header struct {
+	Version     int
+	Local       bool     //LOCAL命令或UNKNOWN协议，连接由代理自身发起(例如健康检查)，地址不变
+	Source      net.Addr //客户端地址
+	Destination net.Addr //代理接受连接的地址
+}
+
+// ReadHeader 读取PROXY协议v1或v2头
+// 按字节精确读取，不会读入头之后的数据，读取后r可直接用于消息解码
+func ReadHeader(r io.Reader) (*Header, error) {
+	buf := make([]byte, len(signature))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("%w: read header error:%w", ErrorProxyProtocol, err)
+	}
+	if bytes.Equal(buf, signature) {
+		return readV2(r)
+	}
+	if bytes.HasPrefix(buf, []byte("PROXY ")) {
+		return readV1(r, buf)
+	}
+	return nil, fmt.Errorf("%w: header is missing", ErrorProxyProtocol)
+}
+
+// PROXY TCP4 源IP 目的IP 源端口 目的端口\r\n
+func readV1(r io.Reader, buf []byte) (*Header, error) {
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(buf, []byte("\r\n")) {
+		if len(buf) >= maxV1Length {
+			return nil, fmt.Errorf("%w: v1 header is too long", ErrorProxyProtocol)
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, fmt.Errorf("%w: read header error:%w", ErrorProxyProtocol, err)
+		}
+		buf = append(buf, b[0])
+	}
+	fields := strings.Split(string(buf[:len(buf)-2]), " ")
+	h := &Header{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		h.Local = true
+		return h, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: v1 header is not valid", ErrorProxyProtocol)
+	}
+	src, err := tcpAddr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := tcpAddr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	h.Source, h.Destination = src, dst
+	return h, nil
+}
+
+func tcpAddr(family, ipstr, portstr string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(ipstr)
+	if ip == nil || (family == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("%w: v1 address is not valid: %s", ErrorProxyProtocol, ipstr)
+	}
+	port, err := strconv.ParseUint(portstr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: v1 port is not valid: %s", ErrorProxyProtocol, portstr)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// 签名之后:版本与命令(1字节)、协议族与传输协议(1字节)、地址长度(2字节 大端序)、地址与TLV
+func readV2(r io.Reader) (*Header, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, fmt.Errorf("%w: read header error:%w", ErrorProxyProtocol, err)
+	}
+	if head[0]>>4 != 2 {
+		return nil, fmt.Errorf("%w: v2 version is not valid", ErrorProxyProtocol)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(head[2:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("%w: read header error:%w", ErrorProxyProtocol, err)
+	}
+	h := &Header{Version: 2}
+	switch head[0] & 0x0f {
+	case 0x0: //LOCAL
+		h.Local = true
+		return h, nil
+	case 0x1: //PROXY
+	default:
+		return nil, fmt.Errorf("%w: v2 command is not valid", ErrorProxyProtocol)
+	}
+	var iplen int
+	switch head[1] >> 4 {
+	case 0x1: //AF_INET
+		iplen = net.IPv4len
+	case 0x2: //AF_INET6
+		iplen = net.IPv6len
+	default: //AF_UNSPEC、AF_UNIX没有可用的IP地址
+		h.Local = true
+		return h, nil
+	}
+	if len(body) < 2*iplen+4 {
+		return nil, fmt.Errorf("%w: v2 address is too short", ErrorProxyProtocol)
+	}
+	srcip := net.IP(append([]byte(nil), body[:iplen]...))
+	dstip := net.IP(append([]byte(nil), body[iplen:2*iplen]...))
+	srcport := int(binary.BigEndian.Uint16(body[2*iplen:]))
+	dstport := int(binary.BigEndian.Uint16(body[2*iplen+2:]))
+	if head[1]&0x0f == 0x2 { //DGRAM
+		h.Source, h.Destination = &net.UDPAddr{IP: srcip, Port: srcport}, &net.UDPAddr{IP: dstip, Port: dstport}
+	} else {
+		h.Source, h.Destination = &net.TCPAddr{IP: srcip, Port: srcport}, &net.TCPAddr{IP: dstip, Port: dstport}
+	}
+	return h, nil
+}
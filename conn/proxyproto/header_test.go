@@ -0,0 +1,107 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// v2头 cmd:版本与命令 fam:协议族与传输协议 addr:地址与TLV
+func v2(cmd, fam byte, addr ...[]byte) []byte {
+	body := bytes.Join(addr, nil)
+	b := append([]byte(nil), signature...)
+	b = append(b, cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(b[len(b)-2:], uint16(len(body)))
+	return append(b, body...)
+}
+
+func port(p uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, p)
+}
+
+func TestReadHeader(t *testing.T) {
+	ip4src, ip4dst := net.ParseIP("192.168.0.1").To4(), net.ParseIP("10.0.0.1").To4()
+	ip6src, ip6dst := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	for _, c := range []struct {
+		name     string
+		in       []byte
+		version  int
+		local    bool
+		src, dst string
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\n"), 1, false, "192.168.0.1:56324", "10.0.0.1:443"},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), 1, false, "[2001:db8::1]:56324", "[2001:db8::2]:443"},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), 1, true, "", ""},
+		{"v1 unknown with addresses", []byte("PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n"), 1, true, "", ""},
+		{"v2 tcp4", v2(0x21, 0x11, ip4src, ip4dst, port(56324), port(443)), 2, false, "192.168.0.1:56324", "10.0.0.1:443"},
+		{"v2 tcp6", v2(0x21, 0x21, ip6src, ip6dst, port(56324), port(443)), 2, false, "[2001:db8::1]:56324", "[2001:db8::2]:443"},
+		{"v2 udp4", v2(0x21, 0x12, ip4src, ip4dst, port(53), port(53)), 2, false, "192.168.0.1:53", "10.0.0.1:53"},
+		{"v2 tcp4 with tlv", v2(0x21, 0x11, ip4src, ip4dst, port(1), port(2), []byte{0x04, 0, 1, 0}), 2, false, "192.168.0.1:1", "10.0.0.1:2"},
+		{"v2 local", v2(0x20, 0x00), 2, true, "", ""},
+		{"v2 local with addresses", v2(0x20, 0x11, ip4src, ip4dst, port(1), port(2)), 2, true, "", ""},
+		{"v2 unspec", v2(0x21, 0x00), 2, true, "", ""},
+		{"v2 unix", v2(0x21, 0x31, make([]byte, 216)), 2, true, "", ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			//头之后的数据不被读取
+			r := bytes.NewReader(append(c.in, "payload"...))
+			h, err := ReadHeader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Version != c.version || h.Local != c.local {
+				t.Fatalf("version %d local %v", h.Version, h.Local)
+			}
+			if c.local {
+				if h.Source != nil || h.Destination != nil {
+					t.Fatalf("local header has addresses %v %v", h.Source, h.Destination)
+				}
+			} else if h.Source.String() != c.src || h.Destination.String() != c.dst {
+				t.Fatalf("source %v destination %v", h.Source, h.Destination)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+				t.Fatalf("rest %q", rest)
+			}
+		})
+	}
+}
+
+func TestReadHeaderInvalid(t *testing.T) {
+	ip4 := net.ParseIP("10.0.0.1").To4()
+	valid1 := []byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\n")
+	valid2 := v2(0x21, 0x11, ip4, ip4, port(1), port(2))
+	for _, c := range []struct {
+		name string
+		in   []byte
+	}{
+		{"empty", nil},
+		{"no header", []byte("GET / HTTP/1.1\r\n")},
+		{"v1 truncated", valid1[:20]},
+		{"v1 missing crlf", valid1[:len(valid1)-2]},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", maxV1Length) + "\r\n")},
+		{"v1 too long without crlf", []byte("PROXY " + strings.Repeat("x", 200))},
+		{"v1 bad family", []byte("PROXY UDP4 192.168.0.1 10.0.0.1 1 2\r\n")},
+		{"v1 field count", []byte("PROXY TCP4 192.168.0.1 10.0.0.1 1\r\n")},
+		{"v1 family mismatch", []byte("PROXY TCP4 2001:db8::1 10.0.0.1 1 2\r\n")},
+		{"v1 bad ip", []byte("PROXY TCP4 192.168.0.256 10.0.0.1 1 2\r\n")},
+		{"v1 port overflow", []byte("PROXY TCP4 192.168.0.1 10.0.0.1 65536 2\r\n")},
+		{"v2 signature only", signature},
+		{"v2 truncated head", valid2[:len(signature)+2]},
+		{"v2 truncated body", valid2[:len(valid2)-1]},
+		{"v2 length beyond input", append(append([]byte(nil), signature...), 0x21, 0x11, 0xff, 0xff, 0x0a)},
+		{"v2 bad version", v2(0x11, 0x11, ip4, ip4, port(1), port(2))},
+		{"v2 bad command", v2(0x22, 0x11, ip4, ip4, port(1), port(2))},
+		{"v2 short ipv4", v2(0x21, 0x11, ip4, ip4, port(1))},
+		{"v2 short ipv6", v2(0x21, 0x21, ip4, ip4, port(1), port(2))},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if h, err := ReadHeader(bytes.NewReader(c.in)); !errors.Is(err, ErrorProxyProtocol) {
+				t.Fatalf("header %+v error %v", h, err)
+			}
+		})
+	}
+}
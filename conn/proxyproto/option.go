@@ -0,0 +1,41 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/chen102/ggbond/conn/ipfilter"
+)
+
+// ParserOption PROXY协议解析选项
+type ParserOption func(options *parseroptions) error
+type parseroptions struct {
+	trusted []*net.IPNet
+	timeout *time.Duration
+}
+
+// cidrs:可信代理的IP或CIDR，只解析来自这些地址的连接的PROXY头，至少设置一个
+func WithTrusted(cidrs ...string) ParserOption {
+	return func(options *parseroptions) error {
+		for _, c := range cidrs {
+			n, err := ipfilter.ParseCIDR(c)
+			if err != nil {
+				return err
+			}
+			options.trusted = append(options.trusted, n)
+		}
+		return nil
+	}
+}
+
+// timeout:读取PROXY头的超时时间，默认5秒
+func WithHeaderTimeout(timeout time.Duration) ParserOption {
+	return func(options *parseroptions) error {
+		if timeout <= 0 {
+			return errors.New("header timeout is not valid")
+		}
+		options.timeout = &timeout
+		return nil
+	}
+}
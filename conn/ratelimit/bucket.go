@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket 令牌桶
+// 以rate个每秒的速度补充令牌，最多积累burst个，每条消息消耗一个
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket 创建令牌桶，初始为满
+func NewBucket(rate float64, burst int) *Bucket {
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Allow 取一个令牌，不足时返回false
+func (b *Bucket) Allow() bool {
+	return b.AllowAt(time.Now())
+}
+
+func (b *Bucket) AllowAt(now time.Time) bool {
+	return AllowAll(now, b) < 0
+}
+
+// 按经过的时间补充令牌，调用方持有锁
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// AllowAll 所有令牌桶都有令牌时各取一个，否则都不取，返回第一个令牌不足的桶下标，全部足够时返回-1
+// 忽略nil，调用方需保证各处传入的桶顺序一致，防止死锁
+func AllowAll(now time.Time, buckets ...*Bucket) int {
+	for _, b := range buckets {
+		if b != nil {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+		}
+	}
+	for i, b := range buckets {
+		if b == nil {
+			continue
+		}
+		b.refill(now)
+		if b.tokens < 1 {
+			return i
+		}
+	}
+	for _, b := range buckets {
+		if b != nil {
+			b.tokens--
+		}
+	}
+	return -1
+}
+
+// Rate 限速配置 rate:每秒消息数 burst:允许的突发消息数
+type Rate struct {
+	Rate  float64
+	Burst int
+}
+
+func (r Rate) valid() bool {
+	return r.Rate > 0 && r.Burst >= 1
+}
+
+func (r Rate) bucket() *Bucket {
+	return NewBucket(r.Rate, r.Burst)
+}
@@ -0,0 +1,336 @@
+package ratelimit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrorRateLimit = errors.New("rate limit error")
+
+// RATELIMITED 超限回复路由，ActionReply时回复，消息ID为被限流消息的消息ID
+// 消息体:被限流的路由ID(4字节 大端序)、限流范围名(UTF-8)
+const RATELIMITED = 12
+
+// Action 超限处理方式
+type Action int
+
+const (
+	ActionDrop       Action = iota + 1 //丢弃消息
+	ActionReply                        //丢弃消息并回复RATELIMITED
+	ActionDisconnect                   //断开连接
+	ActionBan                          //断开连接并封禁远端IP一段时间
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionDrop:
+		return "drop"
+	case ActionReply:
+		return "reply"
+	case ActionDisconnect:
+		return "disconnect"
+	case ActionBan:
+		return "ban"
+	}
+	return "unknown"
+}
+
+// ParseAction 解析处理方式名 drop reply disconnect ban
+func ParseAction(s string) (Action, error) {
+	for a := ActionDrop; a <= ActionBan; a++ {
+		if a.String() == s {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown action %s", ErrorRateLimit, s)
+}
+
+// ParseRate 解析限速配置 "每秒消息数:突发消息数"，省略突发消息数时与速率相同
+func ParseRate(s string) (Rate, error) {
+	ratestr, burststr, hasburst := strings.Cut(s, ":")
+	rate, err := strconv.ParseFloat(ratestr, 64)
+	if err != nil {
+		return Rate{}, fmt.Errorf("%w: rate is not valid: %s", ErrorRateLimit, s)
+	}
+	burst := int(math.Ceil(rate))
+	if hasburst {
+		if burst, err = strconv.Atoi(burststr); err != nil {
+			return Rate{}, fmt.Errorf("%w: burst is not valid: %s", ErrorRateLimit, s)
+		}
+	}
+	r := Rate{rate, burst}
+	if !r.valid() {
+		return Rate{}, fmt.Errorf("%w: rate is not valid: %s", ErrorRateLimit, s)
+	}
+	return r, nil
+}
+
+// Scope 超限的范围
+type Scope int
+
+const (
+	ScopeGlobal Scope = iota
+	ScopeRoute
+	ScopeConn
+	ScopeIP
+	ScopeBanned //远端IP已被封禁
+	scopeCount
+)
+
+func (s Scope) String() string {
+	switch s {
+	case ScopeGlobal:
+		return "global"
+	case ScopeRoute:
+		return "route"
+	case ScopeConn:
+		return "conn"
+	case ScopeIP:
+		return "ip"
+	case ScopeBanned:
+		return "banned"
+	}
+	return "unknown"
+}
+
+// Decision 超限时的判定
+type Decision struct {
+	Scope  Scope
+	Action Action
+}
+
+type connState struct {
+	ip     string
+	bucket *Bucket
+	iplim  *ipState
+}
+
+type ipState struct {
+	bucket *Bucket
+	conns  int
+}
+
+// Limiter 消息限流器
+// 依次检查连接、远端IP、路由、全局令牌桶，任一不足即判定超限，全部足够时才消耗令牌
+type Limiter struct {
+	global *Bucket
+	routes map[int32]*Bucket
+	conn   *Rate
+	ip     *Rate
+	action Action
+	ban    time.Duration
+
+	conns   sync.Map //连接ID -> *connState
+	mu      sync.Mutex
+	ips     map[string]*ipState
+	bans    map[string]time.Time //远端IP -> 解封时间
+	nbans   int32                //封禁数，没有封禁时检查无需加锁
+	limited [scopeCount]uint64
+}
+
+// NewLimiter 创建限流器，未设置的范围不限流
+func NewLimiter(opt ...LimiterOption) (*Limiter, error) {
+	var options limiteroptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			return nil, fmt.Errorf("%w: apply option error:%w", ErrorRateLimit, err)
+		}
+	}
+	l := &Limiter{
+		routes: make(map[int32]*Bucket, len(options.routes)),
+		conn:   options.conn,
+		ip:     options.ip,
+		action: ActionDrop,
+		ban:    time.Minute,
+		ips:    make(map[string]*ipState),
+		bans:   make(map[string]time.Time),
+	}
+	if options.global != nil {
+		l.global = options.global.bucket()
+	}
+	for id, r := range options.routes {
+		l.routes[id] = r.bucket()
+	}
+	if options.action != nil {
+		l.action = *options.action
+	}
+	if options.ban != nil {
+		l.ban = *options.ban
+	}
+	return l, nil
+}
+
+// Open 连接建立时登记
+func (l *Limiter) Open(connid int64, addr net.Addr) {
+	cs := &connState{ip: host(addr)}
+	if l.conn != nil {
+		cs.bucket = l.conn.bucket()
+	}
+	l.mu.Lock()
+	st, ok := l.ips[cs.ip]
+	if !ok {
+		st = &ipState{}
+		if l.ip != nil {
+			st.bucket = l.ip.bucket()
+		}
+		l.ips[cs.ip] = st
+	}
+	st.conns++
+	l.mu.Unlock()
+	cs.iplim = st
+	l.conns.Store(connid, cs)
+}
+
+// Close 连接关闭时释放，同一IP的连接全部关闭后释放该IP的令牌桶
+func (l *Limiter) Close(connid int64) {
+	v, ok := l.conns.LoadAndDelete(connid)
+	if !ok {
+		return
+	}
+	cs := v.(*connState)
+	l.mu.Lock()
+	if cs.iplim.conns--; cs.iplim.conns <= 0 {
+		delete(l.ips, cs.ip)
+	}
+	l.mu.Unlock()
+}
+
+// Banned 远端IP是否处于封禁中
+func (l *Limiter) Banned(addr net.Addr) bool {
+	return l.banned(host(addr), time.Now())
+}
+
+func (l *Limiter) banned(ip string, now time.Time) bool {
+	if atomic.LoadInt32(&l.nbans) == 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until, ok := l.bans[ip]
+	if !ok {
+		return false
+	}
+	if now.After(until) {
+		delete(l.bans, ip)
+		atomic.StoreInt32(&l.nbans, int32(len(l.bans)))
+		return false
+	}
+	return true
+}
+
+// Allow 检查连接的一条消息，超限时返回判定与false
+// 各范围的令牌都足够时才消耗，被某一范围拒绝的消息不占用其他范围的令牌
+func (l *Limiter) Allow(connid int64, routeid int32) (Decision, bool) {
+	now := time.Now()
+	var cs *connState
+	var connb, ipb *Bucket
+	if v, ok := l.conns.Load(connid); ok {
+		cs = v.(*connState)
+		if l.banned(cs.ip, now) {
+			return l.limit(ScopeBanned, cs, now), false
+		}
+		connb, ipb = cs.bucket, cs.iplim.bucket
+	}
+	//按连接、IP、路由、全局的固定顺序加锁
+	switch AllowAll(now, connb, ipb, l.routes[routeid], l.global) {
+	case -1:
+		return Decision{}, true
+	case 0:
+		return l.limit(ScopeConn, cs, now), false
+	case 1:
+		return l.limit(ScopeIP, cs, now), false
+	case 2:
+		return l.limit(ScopeRoute, cs, now), false
+	default:
+		return l.limit(ScopeGlobal, cs, now), false
+	}
+}
+
+// 计数并确定处理方式
+// 断开与封禁只针对连接、IP范围的超限，全局与路由超限不是单个客户端造成的，只丢弃消息
+func (l *Limiter) limit(scope Scope, cs *connState, now time.Time) Decision {
+	atomic.AddUint64(&l.limited[scope], 1)
+	d := Decision{Scope: scope, Action: l.action}
+	switch {
+	case scope == ScopeBanned:
+		d.Action = ActionBan
+	case scope != ScopeConn && scope != ScopeIP:
+		if l.action == ActionDisconnect || l.action == ActionBan {
+			d.Action = ActionDrop
+		}
+	case l.action == ActionBan:
+		l.mu.Lock()
+		for ip, until := range l.bans { //封禁很少发生，新增时顺便清理过期的封禁
+			if now.After(until) {
+				delete(l.bans, ip)
+			}
+		}
+		l.bans[cs.ip] = now.Add(l.ban)
+		atomic.StoreInt32(&l.nbans, int32(len(l.bans)))
+		l.mu.Unlock()
+	}
+	return d
+}
+
+// Stats 各范围的超限消息数
+func (l *Limiter) Stats() map[string]uint64 {
+	stats := make(map[string]uint64, scopeCount)
+	for s := ScopeGlobal; s < scopeCount; s++ {
+		stats[s.String()] = atomic.LoadUint64(&l.limited[s])
+	}
+	return stats
+}
+
+// Bans 封禁中的远端IP及解封时间
+func (l *Limiter) Bans() map[string]time.Time {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bans := make(map[string]time.Time, len(l.bans))
+	for ip, until := range l.bans {
+		if now.After(until) {
+			delete(l.bans, ip)
+			continue
+		}
+		bans[ip] = until
+	}
+	atomic.StoreInt32(&l.nbans, int32(len(l.bans)))
+	return bans
+}
+
+// ReplyBody 超限回复的消息体
+func ReplyBody(routeid int32, scope Scope) []byte {
+	name := scope.String()
+	body := make([]byte, 4+len(name))
+	binary.BigEndian.PutUint32(body, uint32(routeid))
+	copy(body[4:], name)
+	return body
+}
+
+// ParseReply 解析超限回复的消息体，返回被限流的路由ID与范围名
+func ParseReply(body []byte) (int32, string, error) {
+	if len(body) < 4 {
+		return 0, "", fmt.Errorf("%w: reply body is too short", ErrorRateLimit)
+	}
+	return int32(binary.BigEndian.Uint32(body)), string(body[4:]), nil
+}
+
+// 远端地址的IP部分
+func host(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	h, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return h
+}
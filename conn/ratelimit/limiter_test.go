@@ -0,0 +1,187 @@
+package ratelimit
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// 补充速度极慢的速率，测试期间令牌只减不增
+const slow = 0.001
+
+func newTestLimiter(t *testing.T, opt ...LimiterOption) *Limiter {
+	t.Helper()
+	l, err := NewLimiter(opt...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func addr(ip string, port int) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+}
+
+func expectAllow(t *testing.T, l *Limiter, connid int64, routeid int32) {
+	t.Helper()
+	if d, ok := l.Allow(connid, routeid); !ok {
+		t.Fatalf("conn %d route %d limited by %s", connid, routeid, d.Scope)
+	}
+}
+
+func expectLimit(t *testing.T, l *Limiter, connid int64, routeid int32, scope Scope, action Action) {
+	t.Helper()
+	d, ok := l.Allow(connid, routeid)
+	if ok || d.Scope != scope || d.Action != action {
+		t.Fatalf("conn %d route %d: %v %s %s, want %s %s", connid, routeid, ok, d.Scope, d.Action, scope, action)
+	}
+}
+
+func TestAllowAll(t *testing.T) {
+	now := time.Now()
+	a, b := NewBucket(slow, 1), NewBucket(slow, 2)
+	if i := AllowAll(now, a, nil, b); i != -1 {
+		t.Fatalf("first take denied by %d", i)
+	}
+	//a不足时b不消耗
+	if i := AllowAll(now, a, nil, b); i != 0 {
+		t.Fatalf("second take denied by %d", i)
+	}
+	if b.tokens != 1 {
+		t.Fatalf("denied take consumed b, %v tokens left", b.tokens)
+	}
+	if !b.AllowAt(now) || b.AllowAt(now) {
+		t.Fatal("b tokens")
+	}
+	//按速率补充
+	c := NewBucket(10, 1)
+	if !c.AllowAt(now) || c.AllowAt(now) || !c.AllowAt(now.Add(200*time.Millisecond)) {
+		t.Fatal("bucket refill")
+	}
+}
+
+func TestLimiterDeniedScopeConsumesNothing(t *testing.T) {
+	l := newTestLimiter(t, WithConn(slow, 2), WithRoute(1, slow, 1))
+	l.Open(1, addr("10.0.0.1", 1000))
+	expectAllow(t, l, 1, 1)
+	//路由超限的消息不占用连接的令牌
+	expectLimit(t, l, 1, 1, ScopeRoute, ActionDrop)
+	expectLimit(t, l, 1, 1, ScopeRoute, ActionDrop)
+	expectAllow(t, l, 1, 2)
+	expectLimit(t, l, 1, 2, ScopeConn, ActionDrop)
+
+	l = newTestLimiter(t, WithConn(slow, 1), WithIP(slow, 2), WithGlobal(slow, 1))
+	l.Open(1, addr("10.0.0.1", 1000))
+	l.Open(2, addr("10.0.0.1", 1001))
+	expectAllow(t, l, 1, 1)
+	expectLimit(t, l, 2, 1, ScopeGlobal, ActionDrop)
+	v, _ := l.conns.Load(int64(2))
+	cs := v.(*connState)
+	if cs.bucket.tokens < 1 || cs.iplim.bucket.tokens < 1 {
+		t.Fatalf("global denial consumed conn %v ip %v tokens", cs.bucket.tokens, cs.iplim.bucket.tokens)
+	}
+	expectLimit(t, l, 1, 1, ScopeConn, ActionDrop)
+	if stats := l.Stats(); stats["global"] != 1 || stats["conn"] != 1 {
+		t.Fatalf("stats %v", stats)
+	}
+}
+
+func TestLimiterIPShared(t *testing.T) {
+	l := newTestLimiter(t, WithIP(slow, 2))
+	l.Open(1, addr("10.0.0.1", 1000))
+	l.Open(2, addr("10.0.0.1", 1001))
+	l.Open(3, addr("10.0.0.2", 1000))
+	expectAllow(t, l, 1, 1)
+	expectAllow(t, l, 2, 1)
+	expectLimit(t, l, 1, 1, ScopeIP, ActionDrop)
+	expectAllow(t, l, 3, 1)
+	//同一IP的连接全部关闭后释放令牌桶
+	l.Close(1)
+	l.Close(2)
+	l.Open(4, addr("10.0.0.1", 1002))
+	expectAllow(t, l, 4, 1)
+}
+
+func TestLimiterActionScopes(t *testing.T) {
+	for _, action := range []Action{ActionDisconnect, ActionBan} {
+		l := newTestLimiter(t, WithConn(slow, 1), WithRoute(1, slow, 1), WithGlobal(slow, 3), WithAction(action))
+		l.Open(1, addr("10.0.0.1", 1000))
+		l.Open(2, addr("10.0.0.2", 1000))
+		l.Open(3, addr("10.0.0.3", 1000))
+		l.Open(4, addr("10.0.0.4", 1000))
+		expectAllow(t, l, 1, 1)
+		//全局与路由超限只丢弃消息，不断开、不封禁
+		expectLimit(t, l, 2, 1, ScopeRoute, ActionDrop)
+		expectAllow(t, l, 2, 2)
+		expectAllow(t, l, 3, 2)
+		expectLimit(t, l, 4, 3, ScopeGlobal, ActionDrop)
+		if bans := l.Bans(); len(bans) != 0 {
+			t.Fatalf("%s: bans after global overflow %v", action, bans)
+		}
+		//连接超限按配置处理
+		expectLimit(t, l, 1, 2, ScopeConn, action)
+		banned := l.Banned(addr("10.0.0.1", 2000))
+		if banned != (action == ActionBan) {
+			t.Fatalf("%s: ip banned %v", action, banned)
+		}
+		if action == ActionBan {
+			expectLimit(t, l, 1, 2, ScopeBanned, ActionBan)
+			if l.Banned(addr("10.0.0.2", 1000)) {
+				t.Fatal("innocent ip banned")
+			}
+		}
+	}
+}
+
+func TestLimiterBanExpires(t *testing.T) {
+	l := newTestLimiter(t, WithConn(slow, 1), WithAction(ActionBan), WithBanDuration(time.Minute))
+	l.Open(1, addr("10.0.0.1", 1000))
+	expectAllow(t, l, 1, 1)
+	expectLimit(t, l, 1, 1, ScopeConn, ActionBan)
+	if !l.banned("10.0.0.1", time.Now()) {
+		t.Fatal("ip not banned")
+	}
+	if l.banned("10.0.0.1", time.Now().Add(2*time.Minute)) {
+		t.Fatal("ban not expired")
+	}
+	if bans := l.Bans(); len(bans) != 0 {
+		t.Fatalf("expired ban listed %v", bans)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want Rate
+		ok   bool
+	}{
+		{"10", Rate{10, 10}, true},
+		{"0.5", Rate{0.5, 1}, true},
+		{"10:20", Rate{10, 20}, true},
+		{"0", Rate{}, false},
+		{"10:0", Rate{}, false},
+		{"x", Rate{}, false},
+		{"10:x", Rate{}, false},
+	} {
+		r, err := ParseRate(c.s)
+		if (err == nil) != c.ok || r != c.want {
+			t.Fatalf("ParseRate(%q) = %v %v", c.s, r, err)
+		}
+	}
+	if a, err := ParseAction("ban"); err != nil || a != ActionBan {
+		t.Fatalf("ParseAction ban: %v %v", a, err)
+	}
+	if _, err := ParseAction("kill"); err == nil {
+		t.Fatal("unknown action parsed")
+	}
+}
+
+func TestReplyBody(t *testing.T) {
+	routeid, scope, err := ParseReply(ReplyBody(100, ScopeIP))
+	if err != nil || routeid != 100 || scope != "ip" {
+		t.Fatalf("reply %d %q %v", routeid, scope, err)
+	}
+	if _, _, err := ParseReply([]byte{1}); err == nil {
+		t.Fatal("short reply parsed")
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+)
+
+// LimiterOption 限流器选项
+type LimiterOption func(options *limiteroptions) error
+type limiteroptions struct {
+	global *Rate
+	routes map[int32]Rate
+	conn   *Rate
+	ip     *Rate
+	action *Action
+	ban    *time.Duration
+}
+
+// rate:全部连接的消息总速率 burst:允许的突发消息数
+func WithGlobal(rate float64, burst int) LimiterOption {
+	return func(options *limiteroptions) error {
+		r := Rate{rate, burst}
+		if !r.valid() {
+			return errors.New("global rate is not valid")
+		}
+		options.global = &r
+		return nil
+	}
+}
+
+// routeid:路由ID，该路由在全部连接上的消息总速率，可多次设置不同路由
+func WithRoute(routeid int32, rate float64, burst int) LimiterOption {
+	return func(options *limiteroptions) error {
+		r := Rate{rate, burst}
+		if !r.valid() {
+			return errors.New("route rate is not valid")
+		}
+		if options.routes == nil {
+			options.routes = make(map[int32]Rate)
+		}
+		options.routes[routeid] = r
+		return nil
+	}
+}
+
+// 每个连接的消息速率
+func WithConn(rate float64, burst int) LimiterOption {
+	return func(options *limiteroptions) error {
+		r := Rate{rate, burst}
+		if !r.valid() {
+			return errors.New("conn rate is not valid")
+		}
+		options.conn = &r
+		return nil
+	}
+}
+
+// 同一远端IP全部连接的消息速率
+func WithIP(rate float64, burst int) LimiterOption {
+	return func(options *limiteroptions) error {
+		r := Rate{rate, burst}
+		if !r.valid() {
+			return errors.New("ip rate is not valid")
+		}
+		options.ip = &r
+		return nil
+	}
+}
+
+// action:超限时的处理方式，默认ActionDrop
+func WithAction(action Action) LimiterOption {
+	return func(options *limiteroptions) error {
+		if action < ActionDrop || action > ActionBan {
+			return errors.New("action is not valid")
+		}
+		options.action = &action
+		return nil
+	}
+}
+
+// ban:ActionBan时封禁远端IP的时长，默认1分钟
+func WithBanDuration(ban time.Duration) LimiterOption {
+	return func(options *limiteroptions) error {
+		if ban <= 0 {
+			return errors.New("ban duration is not valid")
+		}
+		options.ban = &ban
+		return nil
+	}
+}
@@ -1,25 +1,49 @@
 package routermanage
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
 
-	"github.com/chen102/ggbond/conn/store"
+	"github.com/chen102/ggbond/conn/actor"
+	"github.com/chen102/ggbond/conn/trace"
+	"github.com/chen102/ggbond/store"
 )
 
 var ErrorRouterManager error = errors.New("router manager error")
 
 type RouterManager struct {
-	store.ITCPStore // 存储具体数据
+	IRouterStore          // 存储具体数据
+	ctxhandles   sync.Map //路由ID -> ContextHandle，需要上下文的路由
+	mu           sync.RWMutex
+	middlewares  []Middleware
 }
-type RouterHandle func(msgid, connid int32, parameter []byte) error
+type RouterHandle func(msgid int32, connid int64, parameter []byte) error
 
-func NewTCPRouter(store store.ITCPStore) *RouterManager {
+// ContextHandle 需要上下文的路由处理函数，上下文携带链路追踪信息
+type ContextHandle func(ctx context.Context, msgid int32, connid int64, parameter []byte) error
+
+// Middleware 路由中间件，按注册顺序包裹路由处理函数
+type Middleware func(routeid int32, next ContextHandle) ContextHandle
+
+// IRouterStore 路由存储
+type IRouterStore = store.Store[int32, RouterHandle]
+
+func NewTCPRouter(store IRouterStore) *RouterManager {
 	return &RouterManager{
-		store,
+		IRouterStore: store,
 	}
 }
 
+// Use 注册中间件，对全部路由生效
+func (r *RouterManager) Use(mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middlewares = append(r.middlewares, mw...)
+}
+
 func (r *RouterManager) RegisterRoute(routeid int32, handler RouterHandle) error {
 	if exists := r.Exist(routeid); exists {
 		return fmt.Errorf("%w: %s ", ErrorRouterManager, "route ID already exists")
@@ -31,10 +55,108 @@ func (r *RouterManager) RegisterRoute(routeid int32, handler RouterHandle) error
 	return nil
 }
 
-func (r *RouterManager) HandleMessage(routeid, connid, msgid int32, parameter []byte) error {
-	handler, err := r.Get(routeid)
-	if err != nil {
-		return fmt.Errorf("%w: %s ", ErrorRouterManager, err)
+// RegisterContextRoute 注册需要上下文的路由
+// 经HandleMessage调用时上下文为context.Background()
+func (r *RouterManager) RegisterContextRoute(routeid int32, handler ContextHandle) error {
+	if err := r.RegisterRoute(routeid, func(msgid int32, connid int64, parameter []byte) error {
+		return handler(context.Background(), msgid, connid, parameter)
+	}); err != nil {
+		return err
+	}
+	r.ctxhandles.Store(routeid, handler)
+	return nil
+}
+
+// RegisterActorRoute 注册实体路由
+// 消息经resolve确定目标实体后投递到实体邮箱，由handler在实体协程中串行处理
+func (r *RouterManager) RegisterActorRoute(routeid int32, system *actor.System, resolve actor.Resolver, handler actor.Handle) error {
+	return r.RegisterRoute(routeid, system.Route(resolve, handler))
+}
+
+// RoomLocator 房间定位，一般为集群节点
+type RoomLocator interface {
+	LocateRoom(roomid int32, connid int64) (string, error)
+	ForwardRoute(ctx context.Context, node string, routeid int32, connid int64, msgid int32, parameter []byte) error
+}
+
+// RoomResolver 从消息中解析目标房间
+type RoomResolver func(msgid int32, connid int64, parameter []byte) (int32, error)
+
+// RegisterRoomRoute 注册房间路由
+// 房间不在本节点时把消息转发到房间所在节点，由该节点的同一路由处理，
+// handler在房间所在节点执行，连接可能在其他节点，回复需经集群发送
+func (r *RouterManager) RegisterRoomRoute(routeid int32, locator RoomLocator, resolve RoomResolver, handler RouterHandle) error {
+	return r.RegisterContextRoute(routeid, func(ctx context.Context, msgid int32, connid int64, parameter []byte) error {
+		roomid, err := resolve(msgid, connid, parameter)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrorRouterManager, err)
+		}
+		node, err := locator.LocateRoom(roomid, connid)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrorRouterManager, err)
+		}
+		if node != "" {
+			return locator.ForwardRoute(ctx, node, routeid, connid, msgid, parameter)
+		}
+		return handler(msgid, connid, parameter)
+	})
+}
+
+// Routes 已注册的路由ID，升序
+func (r *RouterManager) Routes() []int32 {
+	var routes []int32
+	r.RangeStroe(func(routeid int32, handler RouterHandle) bool {
+		routes = append(routes, routeid)
+		return true
+	})
+	sort.Slice(routes, func(i, j int) bool { return routes[i] < routes[j] })
+	return routes
+}
+
+func (r *RouterManager) HandleMessage(routeid int32, connid int64, msgid int32, parameter []byte) error {
+	return r.HandleMessageContext(context.Background(), routeid, connid, msgid, parameter)
+}
+
+// HandleMessageContext 经中间件调用路由处理函数
+// ctx中有链路上下文时记录middleware、handler跨度，没有时不开始新链路
+func (r *RouterManager) HandleMessageContext(ctx context.Context, routeid int32, connid int64, msgid int32, parameter []byte) error {
+	var handler ContextHandle
+	if h, ok := r.ctxhandles.Load(routeid); ok {
+		handler = h.(ContextHandle)
+	} else {
+		h, err := r.Get(routeid)
+		if err != nil {
+			return fmt.Errorf("%w: %s ", ErrorRouterManager, err)
+		}
+		handler = func(ctx context.Context, msgid int32, connid int64, parameter []byte) error {
+			return h(msgid, connid, parameter)
+		}
+	}
+	tracing := trace.SpanContextFromContext(ctx).IsValid()
+	if tracing {
+		handler = traced("handler", routeid, handler)
+	}
+	r.mu.RLock()
+	middlewares := r.middlewares
+	r.mu.RUnlock()
+	if len(middlewares) == 0 {
+		return handler(ctx, msgid, connid, parameter)
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](routeid, handler)
+	}
+	if tracing {
+		handler = traced("middleware", routeid, handler)
+	}
+	return handler(ctx, msgid, connid, parameter)
+}
+
+func traced(name string, routeid int32, handler ContextHandle) ContextHandle {
+	return func(ctx context.Context, msgid int32, connid int64, parameter []byte) error {
+		ctx, span := trace.Start(ctx, name, trace.Int64("route", int64(routeid)))
+		err := handler(ctx, msgid, connid, parameter)
+		span.SetError(err)
+		span.End()
+		return err
 	}
-	return handler.(RouterHandle)(msgid, connid, parameter)
 }
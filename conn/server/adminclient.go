@@ -0,0 +1,17 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/chen102/ggbond/conn/admin"
+)
+
+type IAdmin interface {
+	Handler() http.Handler
+}
+
+// NewAdmin 创建运维管理接口
+// connManager:连接管理器 group:分组管理器 router:路由管理器
+func NewAdmin(connManager ITCPConnManage, group IConnGroupMagage, router IRouterManage, opt ...admin.AdminOption) (IAdmin, error) {
+	return admin.NewAdmin(connManager, group, router, opt...)
+}
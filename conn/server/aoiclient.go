@@ -0,0 +1,23 @@
+package server
+
+import "github.com/chen102/ggbond/conn/connmanage"
+
+type IAOIManage interface {
+	Enter(id int64, x, y, radius float32) error
+	Move(id int64, x, y float32) error
+	Leave(id int64) error
+	Watchers(id int64) ([]int64, error)
+	WatchersAt(x, y float32) []int64
+	Position(id int64) (x, y float32, err error)
+	SetHandle(connmanage.AOIHandle)
+}
+
+// NewAOIManage 创建AOI管理器
+// aoitype:AOI实现类型 minx,miny,maxx,maxy:地图边界 cellsize:网格边长
+func NewAOIManage(aoitype string, minx, miny, maxx, maxy, cellsize float32) IAOIManage {
+	switch aoitype {
+	case "grid":
+		return connmanage.NewGridAOI(minx, miny, maxx, maxy, cellsize)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+)
+
+var ErrorBroadcast error = errors.New("broadcast error")
+
+type IBroadcast interface {
+	Broadcast(g connmanage.GroupHook, from int64, msg connect.IMessage) error
+	SendToUser(userid string, msg connect.IMessage) error
+}
+
+// Broadcast 分组广播
+// 分组绑定了AOI时只发送给视野内的连接，handler无需关心分组是否开启AOI
+// 开启集群时同时转发给其他节点上的分组成员
+type Broadcast struct {
+	connManager ITCPConnManage
+	group       IConnGroupMagage
+	cluster     ICluster
+}
+
+func NewBroadcast(connManager ITCPConnManage, group IConnGroupMagage) *Broadcast {
+	return &Broadcast{
+		connManager: connManager,
+		group:       group,
+	}
+}
+
+// NewClusterBroadcast 集群广播
+func NewClusterBroadcast(connManager ITCPConnManage, group IConnGroupMagage, cluster ICluster) *Broadcast {
+	return &Broadcast{
+		connManager: connManager,
+		group:       group,
+		cluster:     cluster,
+	}
+}
+
+// Broadcast 向分组广播消息
+// from:发送者连接ID,AOI分组据此过滤接收者
+// 先下发本节点成员，再转发给其他节点，转发失败不影响本节点成员
+func (b *Broadcast) Broadcast(g connmanage.GroupHook, from int64, msg connect.IMessage) error {
+	err := b.local(g, from, msg)
+	if b.cluster != nil {
+		if e := b.cluster.BroadcastGroup(g, from, msg); e != nil {
+			return errors.Join(err, fmt.Errorf("%w: %w", ErrorBroadcast, e))
+		}
+	}
+	return err
+}
+
+func (b *Broadcast) local(g connmanage.GroupHook, from int64, msg connect.IMessage) error {
+	receivers, err := b.group.Receivers(g, from)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorBroadcast, err)
+	}
+	var (
+		failed int
+		first  error
+	)
+	for _, id := range receivers {
+		conn, err := b.connManager.FindConn(id)
+		if err != nil {
+			//房间承载在本节点而成员连接在其他节点
+			if b.cluster != nil {
+				_ = b.cluster.SendToConn(id, msg)
+			}
+			continue
+		}
+		//单个接收者发送队列满时跳过，不影响其他成员，丢弃数由连接的OnDrop计入SendDropped
+		if err := conn.SendMessage(msg); err != nil {
+			if failed++; first == nil {
+				first = err
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d receivers failed: %w", ErrorBroadcast, failed, len(receivers), first)
+	}
+	return nil
+}
+
+// SendToUser 向用户发送消息，用户可以在集群任意节点上
+func (b *Broadcast) SendToUser(userid string, msg connect.IMessage) error {
+	if b.cluster == nil {
+		return fmt.Errorf("%w: %s", ErrorBroadcast, "cluster is not enabled")
+	}
+	if err := b.cluster.SendToUser(userid, msg); err != nil {
+		return fmt.Errorf("%w: %w", ErrorBroadcast, err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/store"
+)
+
+func TestBroadcastSkipsFullQueue(t *testing.T) {
+	connmanager := NewConnManage("tcp", store.NewTCPShardMap(8), connect.NopHook{})
+	groups := NewConnGroup()
+	room := testGroup{}
+	if err := groups.AddGroup(room); err != nil {
+		t.Fatal(err)
+	}
+	conns := make([]connect.ITCPConn, 3)
+	for i := range conns {
+		c, peer := net.Pipe()
+		defer c.Close()
+		defer peer.Close()
+		conns[i] = connect.NewConn(c, int64(i+1), "tcp")
+		if err := connmanager.AddConn(conns[i]); err != nil {
+			t.Fatal(err)
+		}
+		if err := groups.AddConnToGroup(room, conns[i].ConnID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//没有写协程消费，填满第一个连接的发送队列
+	slow := conns[0]
+	for len(slow.MessageChan()) < cap(slow.MessageChan()) {
+		if err := slow.SendMessage(connect.NewMessage("tcp")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write([]byte("hi"), 1, 100); err != nil {
+		t.Fatal(err)
+	}
+	err := NewBroadcast(connmanager, groups).Broadcast(room, 0, msg)
+	if !errors.Is(err, connect.ErrorSendQueueFull) {
+		t.Fatalf("expected aggregated queue full error, got %v", err)
+	}
+	for _, c := range conns[1:] {
+		if len(c.MessageChan()) != 1 {
+			t.Fatalf("conn %d did not receive broadcast", c.ConnID())
+		}
+	}
+}
+
+// 转发失败的集群，其余方法不会被调用
+type failingCluster struct {
+	ICluster
+}
+
+var errClusterDown = errors.New("cluster down")
+
+func (failingCluster) BroadcastGroup(g connmanage.GroupHook, from int64, msg connect.IMessage) error {
+	return errClusterDown
+}
+
+func TestClusterBroadcastDeliversLocallyFirst(t *testing.T) {
+	connmanager := NewConnManage("tcp", store.NewTCPShardMap(8), connect.NopHook{})
+	groups := NewConnGroup()
+	room := testGroup{}
+	if err := groups.AddGroup(room); err != nil {
+		t.Fatal(err)
+	}
+	c, peer := net.Pipe()
+	defer c.Close()
+	defer peer.Close()
+	conn := connect.NewConn(c, 1, "tcp")
+	if err := connmanager.AddConn(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := groups.AddConnToGroup(room, conn.ConnID()); err != nil {
+		t.Fatal(err)
+	}
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write([]byte("hi"), 1, 100); err != nil {
+		t.Fatal(err)
+	}
+	err := NewClusterBroadcast(connmanager, groups, failingCluster{}).Broadcast(room, 0, msg)
+	if !errors.Is(err, ErrorBroadcast) || !errors.Is(err, errClusterDown) {
+		t.Fatalf("expected cluster error, got %v", err)
+	}
+	//集群转发失败不影响本节点成员
+	if len(conn.MessageChan()) != 1 {
+		t.Fatal("local member did not receive broadcast")
+	}
+}
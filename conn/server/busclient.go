@@ -0,0 +1,25 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/chen102/ggbond/conn/bus"
+)
+
+type IBus interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string, h bus.Handler) (bus.Subscription, error)
+	Close() error
+}
+
+// NewBus 创建消息总线
+// bustype:总线类型 memory(单进程) redis addr:redis地址，memory类型忽略
+func NewBus(bustype, addr string) (IBus, error) {
+	switch bustype {
+	case "memory":
+		return bus.NewMemoryBus(), nil
+	case "redis":
+		return bus.NewRedisBus(addr)
+	}
+	return nil, fmt.Errorf("%w: unknown bus type %s", bus.ErrorBus, bustype)
+}
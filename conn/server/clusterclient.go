@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+
+	"github.com/chen102/ggbond/conn/cluster"
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+)
+
+type ICluster interface {
+	ID() string
+	Start() error
+	Stop() error
+	Nodes() []string
+	AddConn(connid int64)
+	RemoveConn(connid int64)
+	BindUser(userid string, connid int64) error
+	UnbindUser(userid string)
+	UserNode(userid string) (string, error)
+	ConnNode(connid int64) (string, error)
+	SendToConn(connid int64, msg connect.IMessage) error
+	SendToUser(userid string, msg connect.IMessage) error
+	BroadcastGroup(g connmanage.GroupHook, from int64, msg connect.IMessage) error
+	KickConn(connid int64, reason string) error
+	KickUser(userid, reason string) error
+	RoomNode(roomid int32) (string, error)
+	AddRoom(roomid int32) error
+	RemoveRoom(roomid int32)
+	OnMigrate(f func(roomid int32, to string))
+	LocateRoom(roomid int32, connid int64) (string, error)
+	ForwardRoute(ctx context.Context, node string, routeid int32, connid int64, msgid int32, parameter []byte) error
+}
+
+// NewCluster 创建集群节点
+// id:节点ID addr:内部链路监听地址 connManager:本节点连接管理器 group:本节点分组管理器
+func NewCluster(id, addr string, connManager ITCPConnManage, group IConnGroupMagage, opt ...cluster.ClusterOption) ICluster {
+	return cluster.NewCluster(id, addr, connManager, group, opt...)
+}
@@ -12,11 +12,12 @@ import (
 type ITCPConnManage interface {
 	AddConn(conn connect.ITCPConn) error
 	RemoveConn(conn connect.ITCPConn, err error) error
-	FindConn(id int32) (connect.ITCPConn, error)
+	FindConn(id int64) (connect.ITCPConn, error)
 	CheckHealths(context.Context)
 	SetHook(connect.Hook)
 	Hook() connect.Hook
-	AllConn() map[int32]connect.ITCPConn
+	OnHealthChange(f func(conn connect.ITCPConn, from, to connect.ConnStat))
+	AllConn() map[int64]connect.ITCPConn
 	OutTimeOption(string) int64
 	ReadBuffer() int32
 	WriteBuffer() int32
@@ -25,10 +26,16 @@ type ITCPConnManage interface {
 type IConnGroupMagage interface {
 	AddGroup(g connmanage.GroupHook) error
 	RemoveGroup(g connmanage.GroupHook) error
-	Group(g connmanage.GroupHook) (map[int32]struct{}, error)
-	AddConnToGroup(g connmanage.GroupHook, conn int32) error
-	RemoveConnFromGroup(g connmanage.GroupHook, conn int32) error
+	Group(g connmanage.GroupHook) (map[int64]struct{}, error)
+	Groups() []connmanage.GroupHook
+	ConnGroups(conn int64) []connmanage.GroupHook
+	AddConnToGroup(g connmanage.GroupHook, conn int64) error
+	RemoveConnFromGroup(g connmanage.GroupHook, conn int64) error
 	ClearGroup(g connmanage.GroupHook) error
+	SetAOI(g connmanage.GroupHook, aoi connmanage.AOI) error
+	AOI(g connmanage.GroupHook) (connmanage.AOI, error)
+	Receivers(g connmanage.GroupHook, from int64) ([]int64, error)
+	OnRemoveGroup(f func(g connmanage.GroupHook))
 }
 
 // NewConnManage 创建一个新的连接管理器。
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"github.com/chen102/ggbond/conn/gateway"
+)
+
+type IGateway interface {
+	IRouterManage
+	ConnClosed(connid int64)
+	Close() error
+}
+
+type IBackend interface {
+	Start() error
+	Stop() error
+}
+
+// NewGateway 创建网关，作为路由管理器传入NewTCPServer
+// local:本地路由 connManager:网关连接管理器
+func NewGateway(local IRouterManage, connManager ITCPConnManage, opt ...gateway.GatewayOption) IGateway {
+	return gateway.NewGateway(local, connManager, opt...)
+}
+
+// NewBackend 创建后端服务
+// addr:监听地址 router:后端路由 connManager:后端连接管理器，业务服务使用该管理器查找连接
+func NewBackend(addr string, router IRouterManage, connManager ITCPConnManage) IBackend {
+	return gateway.NewBackend(addr, router, connManager)
+}
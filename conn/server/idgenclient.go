@@ -0,0 +1,23 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/chen102/ggbond/conn/idgen"
+)
+
+type IIDGenerator interface {
+	NextID() (int64, error)
+}
+
+// NewIDGenerator 创建连接ID生成器
+// gentype:snowflake(集群唯一) uuid node:节点ID，snowflake类型范围 0~1023
+func NewIDGenerator(gentype string, node int64) (IIDGenerator, error) {
+	switch gentype {
+	case "snowflake":
+		return idgen.NewSnowflake(node)
+	case "uuid":
+		return idgen.NewUUIDGenerator(), nil
+	}
+	return nil, fmt.Errorf("%w: unknown generator type %s", idgen.ErrorIDGen, gentype)
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net"
+
+	"github.com/chen102/ggbond/conn/ipfilter"
+)
+
+type IIPFilter interface {
+	AllowAccept() bool
+	Admit(addr net.Addr) error
+	Release(addr net.Addr)
+	Permitted(ip net.IP) bool
+	AddAllow(cidr string) error
+	RemoveAllow(cidr string) (bool, error)
+	AddDeny(cidr string) error
+	RemoveDeny(cidr string) (bool, error)
+	SetMaxConnsPerIP(max int) error
+	Rules() ipfilter.Rules
+	Conns() map[string]int
+}
+
+// NewIPFilter 创建远端IP过滤器，经WithIPFilter设置到服务器
+func NewIPFilter(opt ...ipfilter.FilterOption) (IIPFilter, error) {
+	return ipfilter.NewFilter(opt...)
+}
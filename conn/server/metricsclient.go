@@ -0,0 +1,40 @@
+package server
+
+import (
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/metrics"
+)
+
+type IMetrics interface {
+	ConnAccepted()
+	ConnClosed(reason string)
+	ConnRejected(reason string)
+	MessageIn(routeid int32, size int)
+	MessageOut(routeid int32, size int)
+	HandleDuration(routeid int32, d time.Duration)
+	SendDropped()
+	RateLimited(scope, action string)
+	HealthTransition(from, to connect.ConnStat)
+	Watch(conns metrics.ConnLister, pool metrics.PoolStater)
+}
+
+// NewMetrics 创建服务器指标，指标注册在registry中，经registry.Handler()以/metrics输出
+func NewMetrics(registry *metrics.Registry) IMetrics {
+	return metrics.NewServerMetrics(registry)
+}
+
+// 未开启指标时使用
+type nopMetrics struct{}
+
+func (nopMetrics) ConnAccepted()                                           {}
+func (nopMetrics) ConnClosed(reason string)                                {}
+func (nopMetrics) ConnRejected(reason string)                              {}
+func (nopMetrics) MessageIn(routeid int32, size int)                       {}
+func (nopMetrics) MessageOut(routeid int32, size int)                      {}
+func (nopMetrics) HandleDuration(routeid int32, d time.Duration)           {}
+func (nopMetrics) RateLimited(scope, action string)                        {}
+func (nopMetrics) SendDropped()                                            {}
+func (nopMetrics) HealthTransition(from, to connect.ConnStat)              {}
+func (nopMetrics) Watch(conns metrics.ConnLister, pool metrics.PoolStater) {}
@@ -1,11 +1,36 @@
 package server
 
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/chen102/ggbond/conn/listener"
+)
+
 // ServerOption 服务器选项
 type ServerOption func(options *serveroptions) error
 type serveroptions struct {
 	ip         *string
 	port       *int64
 	servername *string
+	timer      ITimer
+	group      IConnGroupMagage
+	cluster    ICluster
+	idgen      IIDGenerator
+	metrics    IMetrics
+	logger     *slog.Logger
+	sampling   *logsampling
+	tracer     ITracer
+	limiter    IRateLimiter
+	ipfilter   IIPFilter
+	proxy      IProxyProtocol
+	listeners  []*listener.Listener
+}
+
+type logsampling struct {
+	first, thereafter int
+	tick              time.Duration
 }
 
 // ip:ipv4地址
@@ -31,3 +56,123 @@ func WithServerName(servername string) ServerOption {
 		return nil
 	}
 }
+
+// timer:定时器，不设置时服务器创建默认定时器
+func WithTimer(timer ITimer) ServerOption {
+	return func(options *serveroptions) error {
+		options.timer = timer
+		return nil
+	}
+}
+
+// group:分组管理器，分组移除时自动取消房间定时任务
+func WithGroup(group IConnGroupMagage) ServerOption {
+	return func(options *serveroptions) error {
+		options.group = group
+		return nil
+	}
+}
+
+// cluster:集群节点，设置后连接会同步到集群目录
+func WithCluster(cluster ICluster) ServerOption {
+	return func(options *serveroptions) error {
+		options.cluster = cluster
+		return nil
+	}
+}
+
+// idgen:连接ID生成器，默认为节点0的雪花ID生成器，集群部署时各节点需使用不同节点ID
+func WithIDGenerator(idgen IIDGenerator) ServerOption {
+	return func(options *serveroptions) error {
+		options.idgen = idgen
+		return nil
+	}
+}
+
+// metrics:服务器指标
+func WithMetrics(metrics IMetrics) ServerOption {
+	return func(options *serveroptions) error {
+		options.metrics = metrics
+		return nil
+	}
+}
+
+// logger:服务器日志，默认为库日志，logger.Discard()可关闭日志
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(options *serveroptions) error {
+		if logger == nil {
+			return errors.New("logger is nil")
+		}
+		options.logger = logger
+		return nil
+	}
+}
+
+// 热路径日志(每条消息的收发、超时重置、路由错误)采样
+// 同一消息每tick周期先输出first条，之后每thereafter条输出一条，默认每秒100条之后每100条输出一条
+func WithLogSampling(first, thereafter int, tick time.Duration) ServerOption {
+	return func(options *serveroptions) error {
+		if first < 0 || thereafter < 0 || tick <= 0 {
+			return errors.New("log sampling is not valid")
+		}
+		options.sampling = &logsampling{first: first, thereafter: thereafter, tick: tick}
+		return nil
+	}
+}
+
+// tracer:链路追踪，默认为trace.Default()，均未设置时不追踪
+func WithTracer(tracer ITracer) ServerOption {
+	return func(options *serveroptions) error {
+		if tracer == nil {
+			return errors.New("tracer is nil")
+		}
+		options.tracer = tracer
+		return nil
+	}
+}
+
+// limiter:消息限流器，为nil时不限流
+func WithRateLimiter(limiter IRateLimiter) ServerOption {
+	return func(options *serveroptions) error {
+		if limiter == nil {
+			return errors.New("limiter is nil")
+		}
+		options.limiter = limiter
+		return nil
+	}
+}
+
+// filter:远端IP过滤器，为nil时不过滤
+func WithIPFilter(filter IIPFilter) ServerOption {
+	return func(options *serveroptions) error {
+		if filter == nil {
+			return errors.New("ip filter is nil")
+		}
+		options.ipfilter = filter
+		return nil
+	}
+}
+
+// proxy:PROXY协议解析器，开启后以可信代理传来的客户端地址作为连接的远端地址，未单独设置解析器的监听器均使用
+func WithProxyProtocol(proxy IProxyProtocol) ServerOption {
+	return func(options *serveroptions) error {
+		if proxy == nil {
+			return errors.New("proxy protocol is nil")
+		}
+		options.proxy = proxy
+		return nil
+	}
+}
+
+// 在ip:port上的TCP监听之外增加一个监听，可多次设置，全部监听共用连接管理器与路由
+// network:tcp tls ws wss unix addr:监听地址，unix时为套接字文件路径 opt:监听器选项，见listener包
+func WithListener(network, addr string, opt ...listener.ListenerOption) ServerOption {
+	return func(options *serveroptions) error {
+		l, err := listener.New(network, addr, opt...)
+		if err != nil {
+			return err
+		}
+		options.listeners = append(options.listeners, l)
+		return nil
+	}
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"net"
+
+	"github.com/chen102/ggbond/conn/proxyproto"
+)
+
+type IProxyProtocol interface {
+	Wrap(conn net.Conn) (net.Conn, error)
+	Trusted(addr net.Addr) bool
+}
+
+// NewProxyProtocol 创建PROXY协议解析器，经WithProxyProtocol设置到服务器
+func NewProxyProtocol(opt ...proxyproto.ParserOption) (IProxyProtocol, error) {
+	return proxyproto.NewParser(opt...)
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"net"
+	"time"
+
+	"github.com/chen102/ggbond/conn/ratelimit"
+)
+
+type IRateLimiter interface {
+	Open(connid int64, addr net.Addr)
+	Close(connid int64)
+	Banned(addr net.Addr) bool
+	Allow(connid int64, routeid int32) (ratelimit.Decision, bool)
+	Stats() map[string]uint64
+	Bans() map[string]time.Time
+}
+
+// NewRateLimiter 创建消息限流器，经WithRateLimiter设置到服务器
+func NewRateLimiter(opt ...ratelimit.LimiterOption) (IRateLimiter, error) {
+	return ratelimit.NewLimiter(opt...)
+}
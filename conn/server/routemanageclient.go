@@ -1,16 +1,24 @@
 package server
 
 import (
+	"context"
+
+	"github.com/chen102/ggbond/conn/actor"
 	"github.com/chen102/ggbond/conn/routermanage"
-	"github.com/chen102/ggbond/conn/store"
 )
 
 type IRouterManage interface {
 	RegisterRoute(id int32, route routermanage.RouterHandle) error
-	HandleMessage(routerid, connid, msgid int32, parameter []byte) error
+	RegisterActorRoute(id int32, system *actor.System, resolve actor.Resolver, handler actor.Handle) error
+	RegisterRoomRoute(id int32, locator routermanage.RoomLocator, resolve routermanage.RoomResolver, handler routermanage.RouterHandle) error
+	RegisterContextRoute(id int32, handler routermanage.ContextHandle) error
+	Use(mw ...routermanage.Middleware)
+	HandleMessage(routerid int32, connid int64, msgid int32, parameter []byte) error
+	HandleMessageContext(ctx context.Context, routerid int32, connid int64, msgid int32, parameter []byte) error
+	Routes() []int32
 }
 
-func NewRouterManage(name string, store store.ITCPStore) IRouterManage {
+func NewRouterManage(name string, store routermanage.IRouterStore) IRouterManage {
 	switch name {
 	case "router":
 		return routermanage.NewTCPRouter(store)
@@ -6,13 +6,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"math"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/ipfilter"
+	"github.com/chen102/ggbond/conn/listener"
+	"github.com/chen102/ggbond/conn/logger"
+	"github.com/chen102/ggbond/conn/ratelimit"
+	"github.com/chen102/ggbond/conn/timer"
+	"github.com/chen102/ggbond/conn/trace"
 	"github.com/chen102/ggbond/message"
 	uuid "github.com/satori/go.uuid"
 	"github.com/spaolacci/murmur3"
@@ -21,13 +29,23 @@ import (
 type TCPServer struct {
 	connManager ITCPConnManage
 	group       IConnGroupMagage
-	listener    net.Listener
+	listeners   []*listener.Listener //首个为ip:port上的TCP监听
 	router      IRouterManage
 	stopChannel chan struct{}
 	ip          string
 	port        int64
 	servername  string
 	msgpool     *message.Pool
+	timer       ITimer
+	cluster     ICluster
+	idgen       IIDGenerator
+	metrics     IMetrics
+	logger      *slog.Logger
+	hotlog      *slog.Logger   //热路径日志，经采样
+	tracer      ITracer        //为nil时不追踪
+	limiter     IRateLimiter   //为nil时不限流
+	ipfilter    IIPFilter      //为nil时不过滤
+	proxy       IProxyProtocol //为nil时不解析PROXY头
 }
 
 // NewTCPServer 创建一个tcp服务器
@@ -65,7 +83,7 @@ func NewTCPServer(connManager ITCPConnManage, router IRouterManage, opt ...Serve
 		servername = *options.servername
 	}
 
-	return &TCPServer{
+	s := &TCPServer{
 		connManager: connManager,
 		group:       NewConnGroup(),
 		router:      router,
@@ -74,116 +92,333 @@ func NewTCPServer(connManager ITCPConnManage, router IRouterManage, opt ...Serve
 		port:        port,
 		servername:  servername,
 		msgpool:     message.NewPool("tcp"),
+		timer:       NewTimer(10 * time.Millisecond),
 	}
+	if options.timer != nil {
+		s.timer = options.timer
+	}
+	if options.group != nil {
+		s.group = options.group
+	}
+	s.cluster = options.cluster
+	s.idgen = options.idgen
+	if s.idgen == nil {
+		s.idgen, _ = NewIDGenerator("snowflake", 0)
+	}
+	//钩子在调用时获取，SetHook替换后立即生效
+	connManager.OnHealthChange(func(conn connect.ITCPConn, from, to connect.ConnStat) {
+		if h, ok := connManager.Hook().(connect.HealthHook); ok {
+			h.OnHealthStateChange(conn, from, to)
+		}
+	})
+	s.metrics = nopMetrics{}
+	if options.metrics != nil {
+		s.metrics = options.metrics
+		s.metrics.Watch(connManager, s.msgpool)
+		connManager.OnHealthChange(func(conn connect.ITCPConn, from, to connect.ConnStat) {
+			s.metrics.HealthTransition(from, to)
+		})
+	}
+	s.logger = logger.L()
+	if options.logger != nil {
+		s.logger = options.logger
+	}
+	sampling := logsampling{first: 100, thereafter: 100, tick: time.Second}
+	if options.sampling != nil {
+		sampling = *options.sampling
+	}
+	s.hotlog = logger.Sample(s.logger, sampling.first, sampling.thereafter, sampling.tick)
+	s.limiter = options.limiter
+	s.ipfilter = options.ipfilter
+	s.proxy = options.proxy
+	primary, err := listener.New(listener.TCP, net.JoinHostPort(ip, strconv.FormatInt(port, 10)))
+	if err != nil {
+		panic(err)
+	}
+	s.listeners = append([]*listener.Listener{primary}, options.listeners...)
+	if options.tracer != nil {
+		s.tracer = options.tracer
+	} else if t := trace.Default(); t != nil {
+		s.tracer = t
+	}
+	//房间移除时取消房间的定时任务
+	s.group.OnRemoveGroup(func(g connmanage.GroupHook) {
+		s.timer.CancelOwner(timer.GroupOwner(g.ID()))
+	})
+	return s
+}
+
+// Timer 获取服务器定时器
+func (s *TCPServer) Timer() ITimer {
+	return s.timer
 }
 
 // 启动服务
 func (s *TCPServer) Start() error {
-	var err error
-	s.listener, err = net.Listen("tcp", fmt.Sprintf("%s:%d", s.ip, s.port))
-	if err != nil {
+	for i, l := range s.listeners {
+		if err := l.Listen(); err != nil {
+			for _, opened := range s.listeners[:i] {
+				opened.Close()
+			}
+			return err
+		}
+	}
+	if err := s.timer.Start(); err != nil {
 		return err
 	}
-	log.Println("TCP server started on " + fmt.Sprintf("%s:%d", s.ip, s.port))
-	go s.acceptConnections()
+	if s.cluster != nil {
+		if err := s.cluster.Start(); err != nil {
+			return err
+		}
+	}
+	s.logger.Info("TCP server started", "addr", fmt.Sprintf("%s:%d", s.ip, s.port), "server", s.servername)
+	for _, l := range s.listeners {
+		s.logger.Info("listener started", "listener", l.Name(), "network", l.Network(), "addr", l.Addr())
+		go s.acceptConnections(l)
+	}
 	return nil
 }
 
 // 停止服务
 func (s *TCPServer) Stop() error {
+	if h, ok := s.connManager.Hook().(connect.StopHook); ok {
+		h.OnServerStop()
+	}
 	close(s.stopChannel)
-	if err := s.listener.Close(); err != nil {
+	var err error
+	for _, l := range s.listeners {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
 		return err
 	}
-	return nil
+	if s.cluster != nil {
+		if err := s.cluster.Stop(); err != nil {
+			return err
+		}
+	}
+	return s.timer.Stop()
+}
+
+// Listeners 各监听器的统计
+func (s *TCPServer) Listeners() []listener.Stats {
+	stats := make([]listener.Stats, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		stats = append(stats, l.Stats())
+	}
+	return stats
 }
 
-func (s *TCPServer) acceptConnections() {
+func (s *TCPServer) acceptConnections(l *listener.Listener) {
 	for {
 		select {
 		case <-s.stopChannel:
 			return
 		default:
-			conn, err := s.listener.Accept()
+			conn, err := l.Accept()
 			if err != nil {
-				log.Printf("Error accepting connection: %v\n", err)
+				s.logger.Error("accept connection error", "listener", l.Name(), "error", err)
 				continue
 			}
-			if s.connManager.OutTimeOption("readwriteTimeout") != 0 {
-				timeout := time.Duration(s.connManager.OutTimeOption("readwriteTimeout")) * time.Second
-				if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
-					log.Printf("Error accepting connection: %v\n", err)
-					continue
-				}
-			}
-			if s.connManager.OutTimeOption("readTimeout") != 0 {
-				timeout := time.Duration(s.connManager.OutTimeOption("readTimeout")) * time.Second
-				if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
-					log.Printf("Error accepting connection: %v\n", err)
-					continue
-				}
-			}
-			if s.connManager.OutTimeOption("writeTimeout") != 0 {
-				timeout := time.Duration(s.connManager.OutTimeOption("writeTimeout")) * time.Second
-				if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
-					log.Printf("Error accepting connection: %v\n", err)
-					continue
-				}
+			//超过接受速率时直接关闭，不创建协程，用于吸收重连风暴
+			if s.ipfilter != nil && !s.ipfilter.AllowAccept() {
+				s.rejected(l, "accept_rate")
+				conn.Close()
+				continue
 			}
+			go s.handle(l, conn)
+		}
+	}
+}
+
+// 记录被拒绝的连接
+func (s *TCPServer) rejected(l *listener.Listener, reason string) {
+	s.metrics.ConnRejected(reason)
+	l.Rejected()
+}
 
-			//设置连接超时时间
-			go s.handle(conn)
+// 设置连接超时时间
+func (s *TCPServer) initDeadline(conn net.Conn) error {
+	for _, timeouttype := range []string{"readwriteTimeout", "readTimeout", "writeTimeout"} {
+		if s.connManager.OutTimeOption(timeouttype) != 0 {
+			timeout := time.Duration(s.connManager.OutTimeOption(timeouttype)) * time.Second
+			if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
-func (s *TCPServer) handle(tcpconn net.Conn) error {
+
+func (s *TCPServer) handle(l *listener.Listener, tcpconn net.Conn) error {
 	var wg sync.WaitGroup
-	conn := connect.NewConn(tcpconn, GenerateConnID(), "tcp")
+	proxy := l.Proxy()
+	if proxy == nil && s.proxy != nil {
+		proxy = s.proxy
+	}
+	if proxy != nil {
+		//解析PROXY头，之后的IP检查、日志、限流均使用客户端地址
+		proxyconn, err := proxy.Wrap(tcpconn)
+		if err != nil {
+			s.rejected(l, "proxy")
+			s.logger.Debug("proxy protocol error", "listener", l.Name(), "remote", tcpconn.RemoteAddr().String(), "error", err)
+			tcpconn.Close()
+			return err
+		}
+		tcpconn = proxyconn
+	}
+	//TLS、WebSocket握手
+	upgraded, err := l.Upgrade(tcpconn)
+	if err != nil {
+		s.rejected(l, "handshake")
+		s.logger.Debug("handshake error", "listener", l.Name(), "remote", tcpconn.RemoteAddr().String(), "error", err)
+		tcpconn.Close()
+		return err
+	}
+	tcpconn = upgraded
+	//握手期间的超时已清除，握手完成后开始计算连接超时
+	if err := s.initDeadline(tcpconn); err != nil {
+		tcpconn.Close()
+		return err
+	}
+	if s.limiter != nil && s.limiter.Banned(tcpconn.RemoteAddr()) {
+		s.rejected(l, "banned")
+		tcpconn.Close()
+		return fmt.Errorf("%w: remote ip is banned", ratelimit.ErrorRateLimit)
+	}
+	if s.ipfilter != nil {
+		if err := s.ipfilter.Admit(tcpconn.RemoteAddr()); err != nil {
+			if errors.Is(err, ipfilter.ErrorTooManyConns) {
+				s.rejected(l, "ip_limit")
+			} else {
+				s.rejected(l, "denied")
+			}
+			s.logger.Debug("conn rejected by ip filter", "remote", tcpconn.RemoteAddr().String(), "error", err)
+			tcpconn.Close()
+			return err
+		}
+		defer s.ipfilter.Release(tcpconn.RemoteAddr())
+	}
+	if h, ok := s.connManager.Hook().(connect.AcceptHook); ok {
+		if err := h.BeforeAccept(tcpconn.RemoteAddr()); err != nil {
+			s.rejected(l, "hook")
+			s.logger.Debug("conn rejected by hook", "remote", tcpconn.RemoteAddr().String(), "error", err)
+			tcpconn.Close()
+			return hookError("before accept", err)
+		}
+	}
+	id, err := s.idgen.NextID()
+	if err != nil {
+		tcpconn.Close()
+		return err
+	}
+	conn := connect.NewConn(tcpconn, id, "tcp")
+	connlog := logger.Conn(s.logger, id, tcpconn).With("listener", l.Name())
 	timeout := time.Now().Add(time.Duration(s.connManager.OutTimeOption("connectionTimedOut")) * time.Second)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	//加入管理器前设置，加入后其他协程即可向连接发送消息
+	if d, ok := conn.(interface{ OnDrop(func(connect.IMessage)) }); ok {
+		d.OnDrop(func(connect.IMessage) { s.metrics.SendDropped() })
+	}
 	if err := s.connManager.AddConn(conn); err != nil {
-		return conn.Close(err)
+		switch {
+		case errors.Is(err, connmanage.ErrorConnIDConflict):
+			s.rejected(l, "id_conflict")
+		case errors.Is(err, connmanage.ErrorMaximumConnection):
+			s.rejected(l, "max_connections")
+		default:
+			s.rejected(l, "error")
+		}
+		return conn.Close(connect.NewCloseError(connect.CloseRejected, "server is full", err))
+	}
+	s.metrics.ConnAccepted()
+	l.Opened()
+	defer l.Closed()
+	if s.limiter != nil {
+		s.limiter.Open(conn.ConnID(), tcpconn.RemoteAddr())
+	}
+	//连接移除时取消连接的定时任务
+	defer s.timer.CancelOwner(timer.ConnOwner(conn.ConnID()))
+	if s.cluster != nil {
+		s.cluster.AddConn(conn.ConnID())
+		defer s.cluster.RemoveConn(conn.ConnID())
+	}
+	//网关模式下通知后端释放连接
+	if g, ok := s.router.(interface{ ConnClosed(int64) }); ok {
+		defer g.ConnClosed(conn.ConnID())
 	}
 	if s.connManager.Hook() != nil {
 		err := s.connManager.Hook().AfterConn(conn)
 		if err != nil {
-			log.Println("hook error:", err)
-			return s.connManager.RemoveConn(conn, err)
+			connlog.Warn("hook error", "error", err)
+			return s.closeConn(conn, connect.NewCloseError(connect.CloseRejected, "", hookError("after conn", err)))
 		}
 	}
 
 	if time.Now().After(timeout) {
-		log.Println("connect timeout...")
-		return s.connManager.RemoveConn(conn, errors.New("connect timeout..."))
+		connlog.Warn("connect timeout")
+		return s.closeConn(conn, connect.NewCloseError(connect.CloseTimeout, "connect timeout", nil))
 	}
-	go s.tcpreader(ctx, &wg, conn, int(s.connManager.ReadBuffer()))
-	go s.tcpwrite(ctx, &wg, conn, int(s.connManager.WriteBuffer()))
+	go s.tcpreader(ctx, &wg, conn, int(s.connManager.ReadBuffer()), connlog)
+	go s.tcpwrite(ctx, &wg, conn, int(s.connManager.WriteBuffer()), connlog)
 	for {
 		select {
 		case <-s.stopChannel:
+			_ = conn.SetReadDeadline(0)
 			cancel()
 			wg.Wait()
-			return s.connManager.RemoveConn(conn, errors.New("server stop"))
+			return s.closeConn(conn, connect.NewCloseError(connect.CloseServerStop, "", nil))
 		case err := <-conn.WaitForClosed(): //读写协程出错，或者正常关闭
-			if err != nil {
-				log.Println("conn closed:", err)
-			}
+			connlog.Debug("conn closed", "reason", err)
+			//外部关闭(例如踢出)时读协程可能阻塞在读取上，立即超时使其退出
+			_ = conn.SetReadDeadline(0)
 			cancel()
 			wg.Wait()
-			return s.connManager.RemoveConn(conn, err)
+			return s.closeConn(conn, err)
 		}
 	}
 }
 
-// 生成UUIDV4的murmur3算法int32 hash值
-func GenerateConnID() int32 {
+// 从管理器移除并关闭连接，退出分组，之后记录指标并通知钩子
+// 调用时读写协程均已退出，关闭时可安全写出断开通知
+func (s *TCPServer) closeConn(conn connect.ITCPConn, reason error) error {
+	ce := connect.AsCloseError(reason)
+	err := s.connManager.RemoveConn(conn, ce)
+	if s.limiter != nil {
+		s.limiter.Close(conn.ConnID())
+	}
+	//退出所在分组，分组绑定的AOI同时移除该连接并向视野内的连接发送离开事件
+	for _, g := range s.group.ConnGroups(conn.ConnID()) {
+		_ = s.group.RemoveConnFromGroup(g, conn.ConnID())
+	}
+	s.metrics.ConnClosed(ce.Reason.String())
+	if h, ok := s.connManager.Hook().(connect.CloseHook); ok {
+		h.OnClose(conn, ce.Reason, ce)
+	}
+	return err
+}
+
+// 连接未实现connect.WriteLocker时使用
+type nopLocker struct{}
+
+func (nopLocker) Lock()   {}
+func (nopLocker) Unlock() {}
+
+func hookError(stage string, err error) error {
+	return fmt.Errorf("%w: %s: %w", connect.ErrorHook, stage, err)
+}
+
+// GenerateMsgID 生成服务端推送消息的消息ID，UUIDV4的murmur3算法int32 hash值
+func GenerateMsgID() int32 {
 	//UUIDV4 HASH
 	hasher := murmur3.New32()
 	_, _ = hasher.Write([]byte(uuid.NewV4().String()))
 	return int32(hasher.Sum32() % math.MaxInt32)
 }
-func (s *TCPServer) tcpreader(ctx context.Context, wg *sync.WaitGroup, conn connect.ITCPConn, buffsize int) {
+func (s *TCPServer) tcpreader(ctx context.Context, wg *sync.WaitGroup, conn connect.ITCPConn, buffsize int, connlog *slog.Logger) {
 	reader := bufio.NewReaderSize(conn.Reader(), buffsize)
 	wg.Add(1)
 	if err := s.resetTimeOut(conn, "readwriteTimeout"); err != nil {
@@ -192,9 +427,10 @@ func (s *TCPServer) tcpreader(ctx context.Context, wg *sync.WaitGroup, conn conn
 	if err := s.resetTimeOut(conn, "readTimeout"); err != nil {
 		return
 	}
-	defer log.Printf("conn %d tcpreader done", conn.ConnID())
+	hotlog := logger.Conn(s.hotlog, conn.ConnID(), nil)
+	defer connlog.Debug("tcpreader done")
 	defer wg.Done()
-	log.Printf("conn %d tcpreader start...", conn.ConnID())
+	connlog.Debug("tcpreader start")
 	for {
 		select {
 		case <-ctx.Done():
@@ -202,9 +438,15 @@ func (s *TCPServer) tcpreader(ctx context.Context, wg *sync.WaitGroup, conn conn
 		default:
 			msg, err := s.msgpool.Get("tcp")
 			if err != nil {
-				conn.SignalClose(fmt.Errorf("get msg err:%w", err))
+				conn.SignalClose(connect.NewCloseError(connect.CloseInternal, "", fmt.Errorf("get msg err:%w", err)))
 				return
 			}
+			var decodestart time.Time
+			if s.tracer != nil {
+				//数据到达后开始计时，解码跨度不包含空闲等待，读取错误由ReadAndUnpack返回
+				_, _ = reader.Peek(1)
+				decodestart = time.Now()
+			}
 			if err := msg.ReadAndUnpack(reader); errors.Is(err, io.EOF) {
 				// log.Println("read eof")
 				conn.SignalClose(fmt.Errorf("readandunpack error:%w", err))
@@ -212,70 +454,162 @@ func (s *TCPServer) tcpreader(ctx context.Context, wg *sync.WaitGroup, conn conn
 			} else if operr, ok := err.(net.Error); ok && operr.Timeout() { //若设置了读超时时间，读超时后关闭连接
 				conn.SignalClose(fmt.Errorf("readandunpack error:%w", err))
 				return
+			} else if err != nil { //连接中断按断开处理，其余为消息格式错误
+				ce := connect.AsCloseError(fmt.Errorf("readandunpack error:%w", err))
+				if ce.Reason == connect.CloseUnknown {
+					ce.Reason = connect.CloseProtocolError
+				}
+				conn.SignalClose(ce)
+				return
 			}
 
-			log.Println("read from conn:", string(msg.Body()), msg.MessageID())
-			if err := s.router.HandleMessage(msg.RouteID(), conn.ConnID(), msg.MessageID(), msg.Body()); err != nil {
-				log.Println("route error:", err, "msg:", msg)
+			hotlog.Debug("read from conn", "route", msg.RouteID(), "msgid", msg.MessageID(), "size", len(msg.Body()))
+			s.metrics.MessageIn(msg.RouteID(), len(msg.Body()))
+			if s.limiter != nil {
+				//超限的消息不分发，也不重置读超时
+				if d, ok := s.limiter.Allow(conn.ConnID(), msg.RouteID()); !ok {
+					hotlog.Warn("rate limited", "route", msg.RouteID(), "msgid", msg.MessageID(), "scope", d.Scope.String(), "action", d.Action.String())
+					keep := s.rateLimited(conn, msg, d)
+					_ = s.msgpool.Put("tcp", msg)
+					if !keep {
+						return
+					}
+					continue
+				}
+			}
+			if h, ok := s.connManager.Hook().(connect.MessageHook); ok {
+				if err := h.OnMessage(conn, msg); err != nil {
+					_ = s.msgpool.Put("tcp", msg)
+					conn.SignalClose(connect.NewCloseError(connect.CloseRejected, "", hookError("on message", err)))
+					return
+				}
+			}
+			begin := time.Now()
+			msgctx, span := s.startMessage(ctx, conn, msg, decodestart)
+			tc, _ := conn.(interface{ SetTraceContext(trace.SpanContext) })
+			if tc != nil && span != nil {
+				tc.SetTraceContext(span.SpanContext())
+			}
+			err = s.router.HandleMessageContext(msgctx, msg.RouteID(), conn.ConnID(), msg.MessageID(), msg.Body())
+			if tc != nil && span != nil {
+				tc.SetTraceContext(trace.SpanContext{})
+			}
+			span.SetError(err)
+			span.End()
+			if err != nil {
+				hotlog.Warn("route error", "route", msg.RouteID(), "msgid", msg.MessageID(), "error", err)
 			}
+			s.metrics.HandleDuration(msg.RouteID(), time.Since(begin))
 			if err := s.msgpool.Put("tcp", msg); err != nil {
-				conn.SignalClose(fmt.Errorf("put msg err:%w", err))
+				conn.SignalClose(connect.NewCloseError(connect.CloseInternal, "", fmt.Errorf("put msg err:%w", err)))
 				return
 			}
 			if err := s.resetTimeOut(conn, "readwriteTimeout"); err != nil {
-				conn.SignalClose(fmt.Errorf("set readwriteTimeout err:%w", err))
+				conn.SignalClose(connect.NewCloseError(connect.CloseInternal, "", fmt.Errorf("set readwriteTimeout err:%w", err)))
 				return
 			}
 			if err := s.resetTimeOut(conn, "readTimeout"); err != nil {
-				conn.SignalClose(fmt.Errorf("set readTimeout err:%w", err))
+				conn.SignalClose(connect.NewCloseError(connect.CloseInternal, "", fmt.Errorf("set readTimeout err:%w", err)))
 				return
 			}
 		}
 	}
 }
-func (s *TCPServer) tcpwrite(ctx context.Context, wg *sync.WaitGroup, conn connect.ITCPConn, buffsize int) {
-	writer := bufio.NewWriterSize(conn.Sender(), buffsize)
-	wg.Add(1)
-	if err := s.resetTimeOut(conn, "readwriteTimeout"); err != nil {
-		conn.SignalClose(fmt.Errorf("set readwriteTimeout err:%w", err))
-		return
+
+// 按判定处理超限消息，连接需要断开时返回false
+func (s *TCPServer) rateLimited(conn connect.ITCPConn, msg connect.IMessage, d ratelimit.Decision) bool {
+	s.metrics.RateLimited(d.Scope.String(), d.Action.String())
+	switch d.Action {
+	case ratelimit.ActionReply:
+		reply := connect.NewMessage("tcp")
+		if err := reply.Write(ratelimit.ReplyBody(msg.RouteID(), d.Scope), msg.MessageID(), ratelimit.RATELIMITED); err == nil {
+			_ = conn.SendMessage(reply)
+		}
+	case ratelimit.ActionDisconnect:
+		conn.SignalClose(connect.NewCloseError(connect.CloseRateLimited, d.Scope.String(), nil))
+		return false
+	case ratelimit.ActionBan:
+		conn.SignalClose(connect.NewCloseError(connect.CloseRateLimited, "banned", nil))
+		return false
 	}
-	if err := s.resetTimeOut(conn, "writeTimeout"); err != nil {
-		conn.SignalClose(fmt.Errorf("set writeTimeout err:%w", err))
-		return
+	return true
+}
+
+// 开始消息跨度，消息携带上游链路上下文时接续上游链路，并补记解码跨度
+func (s *TCPServer) startMessage(ctx context.Context, conn connect.ITCPConn, msg connect.IMessage, start time.Time) (context.Context, *trace.Span) {
+	if s.tracer == nil {
+		return ctx, nil
+	}
+	if sc, err := trace.Decode(msg.TraceContext()); err == nil {
+		ctx = trace.ContextWithRemote(ctx, sc)
 	}
+	ctx, span := s.tracer.StartAt(ctx, "route/"+strconv.Itoa(int(msg.RouteID())), start,
+		trace.Int64("conn", conn.ConnID()), trace.Int64("route", int64(msg.RouteID())), trace.Int64("msgid", int64(msg.MessageID())), trace.Int("size", len(msg.Body())))
+	span.SetKind(trace.SpanKindServer)
+	_, decode := s.tracer.StartAt(ctx, "decode", start)
+	decode.End()
+	return ctx, span
+}
+
+func (s *TCPServer) tcpwrite(ctx context.Context, wg *sync.WaitGroup, conn connect.ITCPConn, buffsize int, connlog *slog.Logger) {
+	writer := bufio.NewWriterSize(conn.Sender(), buffsize)
+	//与关闭连接时写出的断开通知互斥
+	var wl sync.Locker = nopLocker{}
+	if l, ok := conn.(connect.WriteLocker); ok {
+		wl = l.WriteLock()
+	}
+	wg.Add(1)
 	defer wg.Done()
-	defer log.Printf("conn %d tcpwrite done", conn.ConnID())
-	log.Printf("conn %d tcpwrite start...", conn.ConnID())
+	defer connlog.Debug("tcpwrite done")
+	connlog.Debug("tcpwrite start")
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case msg := <-conn.MessageChan():
 			// log.Println("write to conn...")
-			if err := msg.PackAndWrite(writer); err != nil {
-				conn.SignalClose(fmt.Errorf("packandwrite error:%w", err))
-				return
-			} else if operr, ok := err.(net.Error); ok && operr.Timeout() { //若设置了读超时时间，读超时后关闭连接
-				conn.SignalClose(fmt.Errorf("packandwrite error:%w", err))
-				return
+			var span *trace.Span
+			if tm, ok := msg.(*connect.TracedMessage); ok && s.tracer != nil {
+				_, span = s.tracer.StartAt(trace.ContextWithRemote(ctx, tm.Parent), "send", tm.Enqueued,
+					trace.Int64("route", int64(msg.RouteID())), trace.Int("size", len(msg.Body())))
 			}
+			//写超时从本次写入开始计算，空闲期间不会触发
 			if err := s.resetTimeOut(conn, "readwriteTimeout"); err != nil {
-				conn.SignalClose(fmt.Errorf("set readwriteTimeout err:%w", err))
+				span.SetError(err)
+				span.End()
+				conn.SignalClose(connect.NewCloseError(connect.CloseInternal, "", fmt.Errorf("set readwriteTimeout err:%w", err)))
 				return
 			}
 			if err := s.resetTimeOut(conn, "writeTimeout"); err != nil {
-				conn.SignalClose(fmt.Errorf("set writeTimeout err:%w", err))
+				span.SetError(err)
+				span.End()
+				conn.SignalClose(connect.NewCloseError(connect.CloseInternal, "", fmt.Errorf("set writeTimeout err:%w", err)))
 				return
 			}
+			wl.Lock()
+			err := msg.PackAndWrite(writer)
+			wl.Unlock()
+			if err != nil {
+				span.SetError(err)
+				span.End()
+				conn.SignalClose(connect.NewCloseError(connect.CloseWriteError, "", fmt.Errorf("packandwrite error:%w", err)))
+				return
+			} else if operr, ok := err.(net.Error); ok && operr.Timeout() { //若设置了读超时时间，读超时后关闭连接
+				conn.SignalClose(connect.NewCloseError(connect.CloseWriteError, "", fmt.Errorf("packandwrite error:%w", err)))
+				return
+			}
+			span.End()
+			if h, ok := s.connManager.Hook().(connect.SendHook); ok {
+				h.OnSend(conn, msg)
+			}
+			s.metrics.MessageOut(msg.RouteID(), len(msg.Body()))
 			// log.Println("write to conn:", msg)
 		}
 	}
 }
 func (s *TCPServer) resetTimeOut(conn connect.ITCPConn, timeouttype string) error {
 	if s.connManager.OutTimeOption(timeouttype) != 0 {
-
-		log.Println("set timeout:", timeouttype, s.connManager.OutTimeOption(timeouttype))
+		s.hotlog.Debug("set timeout", "conn", conn.ConnID(), "type", timeouttype, "seconds", s.connManager.OutTimeOption(timeouttype))
 		if timeouttype == "readwriteTimeout" {
 			if err := conn.SetDeadline(s.connManager.OutTimeOption(timeouttype)); err != nil {
 				return err
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/routermanage"
+	"github.com/chen102/ggbond/conn/store"
+)
+
+type testGroup struct{}
+
+func (testGroup) ID() int32    { return 1 }
+func (testGroup) Name() string { return "room" }
+
+type aoiEvent struct {
+	event           connmanage.AOIEvent
+	watcher, entity int64
+}
+
+// 启动监听在随机端口的服务器
+func startTestServer(t *testing.T, opt ...ServerOption) (*TCPServer, ITCPConnManage, string) {
+	t.Helper()
+	connmanager := NewConnManage("tcp", store.NewTCPShardMap(8), connect.NopHook{})
+	router := NewRouterManage("router", store.NewSyncMap[routermanage.RouterHandle]())
+	s := NewTCPServer(connmanager, router, append([]ServerOption{WithPort(0)}, opt...)...)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Stop() })
+	return s, connmanager, s.Listeners()[0].Addr
+}
+
+// 等待服务器登记n个连接，返回连接ID
+func waitConns(t *testing.T, connmanager ITCPConnManage, n int) []int64 {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if conns := connmanager.AllConn(); len(conns) == n {
+			ids := make([]int64, 0, n)
+			for id := range conns {
+				ids = append(ids, id)
+			}
+			return ids
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server did not register %d conns", n)
+	return nil
+}
+
+func TestCloseConnLeavesGroupAndAOI(t *testing.T) {
+	groups := NewConnGroup()
+	room := testGroup{}
+	if err := groups.AddGroup(room); err != nil {
+		t.Fatal(err)
+	}
+	aoi := NewAOIManage("grid", 0, 0, 100, 100, 10)
+	events := make(chan aoiEvent, 16)
+	aoi.SetHandle(func(event connmanage.AOIEvent, watcher, entity int64, x, y float32) {
+		events <- aoiEvent{event, watcher, entity}
+	})
+	if err := groups.SetAOI(room, aoi); err != nil {
+		t.Fatal(err)
+	}
+	_, connmanager, addr := startTestServer(t, WithGroup(groups))
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	ids := waitConns(t, connmanager, 1)
+	leaving := ids[0]
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	var neighbour int64
+	for _, id := range waitConns(t, connmanager, 2) {
+		if id != leaving {
+			neighbour = id
+		}
+	}
+	for _, id := range []int64{leaving, neighbour} {
+		if err := groups.AddConnToGroup(room, id); err != nil {
+			t.Fatal(err)
+		}
+		if err := aoi.Enter(id, 50, 50, 20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//清空进入事件
+	for len(events) > 0 {
+		<-events
+	}
+
+	first.Close()
+	waitConns(t, connmanager, 1)
+	select {
+	case e := <-events:
+		if e.event != connmanage.AOILEAVE || e.watcher != neighbour || e.entity != leaving {
+			t.Fatalf("unexpected aoi event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("neighbour did not receive leave event")
+	}
+	members, err := groups.Group(room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := members[leaving]; ok || len(members) != 1 {
+		t.Fatalf("closed conn still in group: %v", members)
+	}
+	if _, err := aoi.Watchers(leaving); err == nil {
+		t.Fatal("closed conn still in aoi")
+	}
+}
+
+func TestForcedCloseDoesNotInterleaveWrites(t *testing.T) {
+	_, connmanager, addr := startTestServer(t)
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := connmanager.FindConn(waitConns(t, connmanager, 1)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	//客户端不读，写协程阻塞在大消息的写出中
+	body := make([]byte, 32<<20)
+	for i := range body {
+		body[i] = 'x'
+	}
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write(body, 1, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SendMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	//健康检查强制移除时写协程仍在写，断开通知不能插入到消息中间，也不能阻塞
+	begin := time.Now()
+	if err := connmanager.RemoveConn(conn, connect.NewCloseError(connect.CloseHeartbeat, "", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Fatalf("forced close blocked for %s", elapsed)
+	}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(client, header); err != nil {
+		t.Fatal(err)
+	}
+	if length := binary.BigEndian.Uint32(header); length != uint32(len(body)) {
+		t.Fatalf("length field %d", length)
+	}
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := client.Read(buf)
+		if i := bytes.IndexFunc(buf[:n], func(r rune) bool { return r != 'x' }); i >= 0 {
+			t.Fatalf("foreign bytes %x inside message body", buf[i:min(n, i+16)])
+		}
+		if err != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"time"
+
+	"github.com/chen102/ggbond/conn/timer"
+)
+
+type ITimer interface {
+	Start() error
+	Stop() error
+	After(owner timer.Owner, d time.Duration, f func()) *timer.Timer
+	Every(owner timer.Owner, d time.Duration, f func()) *timer.Timer
+	CancelOwner(owner timer.Owner)
+	Bind(owner timer.Owner, e timer.Executor)
+}
+
+// NewTimer 创建定时器
+// tick:时间轮精度
+func NewTimer(tick time.Duration) ITimer {
+	return timer.NewScheduler(tick)
+}
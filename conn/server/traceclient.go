@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chen102/ggbond/conn/trace"
+)
+
+type ITracer interface {
+	Start(ctx context.Context, name string, attrs ...trace.Attr) (context.Context, *trace.Span)
+	StartAt(ctx context.Context, name string, start time.Time, attrs ...trace.Attr) (context.Context, *trace.Span)
+	Shutdown(ctx context.Context) error
+}
+
+// NewTraceExporter 创建跨度导出器
+// exportertype:导出器类型 stdout otlp endpoint:OTLP收集器地址，例如 http://127.0.0.1:4318，stdout类型忽略
+func NewTraceExporter(exportertype, endpoint string, opt ...trace.OTLPOption) (trace.Exporter, error) {
+	switch exportertype {
+	case "stdout":
+		return trace.NewStdoutExporter(nil), nil
+	case "otlp":
+		return trace.NewOTLPExporter(endpoint, opt...)
+	}
+	return nil, fmt.Errorf("%w: unknown exporter type %s", trace.ErrorTrace, exportertype)
+}
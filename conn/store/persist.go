@@ -0,0 +1,60 @@
+package store
+
+import (
+	"path/filepath"
+
+	"github.com/chen102/ggbond/store"
+)
+
+// ISessionStore 会话属性 sessionID -> 属性名 -> 序列化后的属性值
+type ISessionStore = store.Store[string, map[string][]byte]
+
+// IUserStore 用户绑定 userID -> sessionID
+type IUserStore = store.Store[string, string]
+
+// IGroupStore 分组成员 groupID -> sessionID列表
+// 连接ID重启后会变化，分组成员按会话持久化
+type IGroupStore = store.Store[int32, []string]
+
+// PersistStore 持久化存储集合，重启后会话恢复时据此找回状态
+type PersistStore struct {
+	Sessions *store.FileStore[string, map[string][]byte]
+	Users    *store.FileStore[string, string]
+	Groups   *store.FileStore[int32, []string]
+}
+
+// OpenPersistStore 打开持久化存储
+// dir:数据根目录，会话、用户、分组分别存放在子目录中
+func OpenPersistStore(dir string, opt ...store.FileStoreOption) (*PersistStore, error) {
+	sessions, err := store.OpenFileStore[string, map[string][]byte](filepath.Join(dir, "sessions"), opt...)
+	if err != nil {
+		return nil, err
+	}
+	users, err := store.OpenFileStore[string, string](filepath.Join(dir, "users"), opt...)
+	if err != nil {
+		sessions.Close()
+		return nil, err
+	}
+	groups, err := store.OpenFileStore[int32, []string](filepath.Join(dir, "groups"), opt...)
+	if err != nil {
+		sessions.Close()
+		users.Close()
+		return nil, err
+	}
+	return &PersistStore{
+		Sessions: sessions,
+		Users:    users,
+		Groups:   groups,
+	}, nil
+}
+
+// Close 写入快照并关闭全部存储
+func (p *PersistStore) Close() error {
+	var res error
+	for _, c := range []interface{ Close() error }{p.Sessions, p.Users, p.Groups} {
+		if err := c.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPersistStoreRestart(t *testing.T) {
+	dir := t.TempDir()
+	p, err := OpenPersistStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := map[string][]byte{"user": []byte(`"u1"`), "level": []byte("3")}
+	if _, err := p.Sessions.Set("s1", session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Sessions.Set("s2", map[string][]byte{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Sessions.Del("s2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Users.Set("u1", "s0"); err != nil {
+		t.Fatal(err)
+	}
+	//覆盖写入，重启后应为最后的值
+	if _, err := p.Users.Set("u1", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Groups.Set(1, []string{"s1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = OpenPersistStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	got, err := p.Sessions.Get("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, session) {
+		t.Fatalf("session = %v, want %v", got, session)
+	}
+	if p.Sessions.Exist("s2") {
+		t.Fatal("deleted session came back")
+	}
+	if userid, err := p.Users.Get("u1"); err != nil || userid != "s1" {
+		t.Fatalf("user = %q, %v, want s1", userid, err)
+	}
+	if members, err := p.Groups.Get(1); err != nil || !reflect.DeepEqual(members, []string{"s1"}) {
+		t.Fatalf("group members = %v, %v, want [s1]", members, err)
+	}
+	if p.Sessions.Len() != 1 || p.Users.Len() != 1 {
+		t.Fatalf("len sessions=%d users=%d", p.Sessions.Len(), p.Users.Len())
+	}
+}
@@ -1,15 +1,24 @@
 package store
 
-import "github.com/chen102/ggbond/store"
-
-type ITCPStore interface {
-	Get(key int32) (interface{}, error)
-	Set(key int32, value interface{}) (int32, error)
-	Del(key int32) error
-	Exist(key int32) bool
-	RangeStroe(f func(key, value interface{}) bool)
-}
+import (
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/store"
+)
+
+// ITCPStore 连接存储
+type ITCPStore = store.Store[int64, connect.ITCPConn]
 
 func NewTCPSyncMap() ITCPStore {
-	return store.NewSyncMap()
+	return store.NewSyncMap[int64, connect.ITCPConn]()
+}
+
+// NewTCPShardMap 分片存储，适合大量连接
+// shardnum:分片数
+func NewTCPShardMap(shardnum int) ITCPStore {
+	return store.NewShardMap[int64, connect.ITCPConn](shardnum)
+}
+
+// NewSyncMap 以int32为键的通用存储，例如路由表
+func NewSyncMap[V any]() store.Store[int32, V] {
+	return store.NewSyncMap[int32, V]()
 }
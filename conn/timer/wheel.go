@@ -0,0 +1,311 @@
+package timer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chen102/ggbond/conn/logger"
+)
+
+var ErrorTimer = errors.New("timer error")
+
+// 分层时间轮参数 第0层256个槽，其余每层64个槽，共5层，可表示2^32个tick
+const (
+	nearbits  = 8
+	nearsize  = 1 << nearbits
+	nearmask  = nearsize - 1
+	levelbits = 6
+	levelsize = 1 << levelbits
+	levelmask = levelsize - 1
+	levels    = 4
+)
+
+// OwnerKind 定时任务所属者类型
+type OwnerKind int32
+
+const (
+	NONE OwnerKind = iota
+	CONN
+	GROUP
+)
+
+// Owner 定时任务所属者，所属者移除时其全部任务自动取消
+type Owner struct {
+	Kind OwnerKind
+	ID   int64
+}
+
+// ConnOwner 连接所属的任务
+func ConnOwner(connid int64) Owner {
+	return Owner{Kind: CONN, ID: connid}
+}
+
+// GroupOwner 分组(房间)所属的任务
+func GroupOwner(groupid int32) Owner {
+	return Owner{Kind: GROUP, ID: int64(groupid)}
+}
+
+// Executor 任务执行器，绑定后所属者的任务投递到执行器中串行执行(例如房间协程)
+type Executor interface {
+	Post(f func()) error
+}
+
+// Timer 定时任务句柄
+type Timer struct {
+	owner    Owner
+	expire   uint64 //到期tick
+	interval uint64 //重复间隔tick，0表示只执行一次
+	f        func()
+	stopped  int32
+}
+
+// Cancel 取消任务，返回是否是本次调用取消的
+func (t *Timer) Cancel() bool {
+	return atomic.CompareAndSwapInt32(&t.stopped, 0, 1)
+}
+
+// Stopped 任务是否已取消或已执行完毕
+func (t *Timer) Stopped() bool {
+	return atomic.LoadInt32(&t.stopped) == 1
+}
+
+// Scheduler 分层时间轮调度器
+type Scheduler struct {
+	mu        sync.Mutex
+	tick      time.Duration
+	current   uint64
+	near      [nearsize][]*Timer
+	level     [levels][levelsize][]*Timer
+	owners    map[Owner]map[*Timer]struct{}
+	executors map[Owner]Executor
+	stop      chan struct{}
+	running   bool
+}
+
+// NewScheduler 创建一个时间轮调度器
+// tick:时间轮精度
+func NewScheduler(tick time.Duration) *Scheduler {
+	if tick <= 0 {
+		panic("timer tick is not valid")
+	}
+	return &Scheduler{
+		tick:      tick,
+		owners:    make(map[Owner]map[*Timer]struct{}),
+		executors: make(map[Owner]Executor),
+	}
+}
+
+// Start 启动时间轮
+func (s *Scheduler) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return fmt.Errorf("%w: already running", ErrorTimer)
+	}
+	s.running = true
+	s.stop = make(chan struct{})
+	go s.run(s.stop)
+	return nil
+}
+
+// Stop 停止时间轮，未执行的任务全部丢弃
+func (s *Scheduler) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return fmt.Errorf("%w: not running", ErrorTimer)
+	}
+	s.running = false
+	close(s.stop)
+	return nil
+}
+
+// After 延迟d后执行一次f
+func (s *Scheduler) After(owner Owner, d time.Duration, f func()) *Timer {
+	t := &Timer{owner: owner, f: f}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.expire = s.current + s.ticks(d)
+	s.add(t)
+	return t
+}
+
+// Every 每隔d执行一次f，直到被取消
+func (s *Scheduler) Every(owner Owner, d time.Duration, f func()) *Timer {
+	t := &Timer{owner: owner, f: f}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.interval = s.ticks(d)
+	t.expire = s.current + t.interval
+	s.add(t)
+	return t
+}
+
+// CancelOwner 取消所属者的全部任务，连接或房间移除时调用
+func (s *Scheduler) CancelOwner(owner Owner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t := range s.owners[owner] {
+		t.Cancel()
+	}
+	delete(s.owners, owner)
+	delete(s.executors, owner)
+}
+
+// Bind 为所属者绑定执行器
+func (s *Scheduler) Bind(owner Owner, e Executor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.executors[owner] = e
+}
+
+// 时长换算为tick数，至少为1，最大为时间轮可表示的范围
+// 非正时长按1个tick处理，避免负数转换为极大值
+func (s *Scheduler) ticks(d time.Duration) uint64 {
+	if d <= 0 {
+		return 1
+	}
+	n := uint64(d / s.tick)
+	if n == 0 {
+		n = 1
+	}
+	if max := uint64(1)<<(nearbits+levels*levelbits) - 1; n > max {
+		n = max
+	}
+	return n
+}
+
+func (s *Scheduler) add(t *Timer) {
+	if t.owner.Kind != NONE {
+		if _, ok := s.owners[t.owner]; !ok {
+			s.owners[t.owner] = make(map[*Timer]struct{})
+		}
+		s.owners[t.owner][t] = struct{}{}
+	}
+	s.place(t)
+}
+
+// 到期时间与当前时间高位相同的层级即为所在层级
+func (s *Scheduler) place(t *Timer) {
+	expire, current := t.expire, s.current
+	if expire|nearmask == current|nearmask {
+		idx := expire & nearmask
+		s.near[idx] = append(s.near[idx], t)
+		return
+	}
+	mask := uint64(nearsize << levelbits)
+	i := 0
+	for ; i < levels-1; i++ {
+		if expire|(mask-1) == current|(mask-1) {
+			break
+		}
+		mask <<= levelbits
+	}
+	idx := (expire >> (nearbits + uint(i)*levelbits)) & levelmask
+	s.level[i][idx] = append(s.level[i][idx], t)
+}
+
+func (s *Scheduler) run(stop chan struct{}) {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.advance()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// 推进一个tick，低层转满一圈时将上层对应槽的任务下放
+func (s *Scheduler) advance() {
+	s.mu.Lock()
+	s.current++
+	ct := s.current
+	mask := uint64(nearsize)
+	high := ct >> nearbits
+	i := 0
+	for ; i < levels && ct&(mask-1) == 0; i++ {
+		if idx := high & levelmask; idx != 0 {
+			s.cascade(i, idx)
+			break
+		}
+		mask <<= levelbits
+		high >>= levelbits
+	}
+	if i == levels {
+		s.cascade(levels-1, 0)
+	}
+	idx := ct & nearmask
+	expired := s.near[idx]
+	s.near[idx] = nil
+	var fire []*Timer
+	for _, t := range expired {
+		if t.Stopped() {
+			s.forget(t)
+			continue
+		}
+		fire = append(fire, t)
+		if t.interval > 0 {
+			t.expire = ct + t.interval
+			s.place(t)
+		} else {
+			s.forget(t)
+		}
+	}
+	executors := make([]Executor, len(fire))
+	for i, t := range fire {
+		executors[i] = s.executors[t.owner]
+	}
+	s.mu.Unlock()
+
+	for i, t := range fire {
+		if t.interval == 0 && !atomic.CompareAndSwapInt32(&t.stopped, 0, 1) {
+			continue
+		}
+		s.exec(executors[i], t.f)
+	}
+}
+
+func (s *Scheduler) cascade(level int, idx uint64) {
+	timers := s.level[level][idx]
+	s.level[level][idx] = nil
+	for _, t := range timers {
+		if t.Stopped() {
+			s.forget(t)
+			continue
+		}
+		s.place(t)
+	}
+}
+
+func (s *Scheduler) forget(t *Timer) {
+	if timers, ok := s.owners[t.owner]; ok {
+		delete(timers, t)
+		if len(timers) == 0 {
+			delete(s.owners, t.owner)
+		}
+	}
+}
+
+// 有执行器时投递到执行器，否则在新协程中执行，防止阻塞时间轮
+func (s *Scheduler) exec(e Executor, f func()) {
+	if e != nil {
+		if err := e.Post(f); err != nil {
+			logger.L().Warn("timer post error", "error", err)
+		}
+		return
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.L().Error("timer task panic", "panic", r)
+			}
+		}()
+		f()
+	}()
+}
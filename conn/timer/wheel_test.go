@@ -0,0 +1,144 @@
+package timer
+
+import (
+	"testing"
+	"time"
+)
+
+// 同步执行任务的执行器，便于逐tick检查
+type syncExecutor struct{}
+
+func (syncExecutor) Post(f func()) error {
+	f()
+	return nil
+}
+
+var testOwner = GroupOwner(1)
+
+func newTestScheduler() *Scheduler {
+	s := NewScheduler(time.Millisecond)
+	s.Bind(testOwner, syncExecutor{})
+	return s
+}
+
+// 定位任务所在的槽，level为-1表示第0层
+func slotOf(s *Scheduler, t *Timer) (level int, idx uint64, ok bool) {
+	for i, slot := range s.near {
+		for _, v := range slot {
+			if v == t {
+				return -1, uint64(i), true
+			}
+		}
+	}
+	for l := range s.level {
+		for i, slot := range s.level[l] {
+			for _, v := range slot {
+				if v == t {
+					return l, uint64(i), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func TestSchedulerTicks(t *testing.T) {
+	s := newTestScheduler()
+	max := uint64(1)<<(nearbits+levels*levelbits) - 1
+	for _, c := range []struct {
+		d    time.Duration
+		want uint64
+	}{
+		{-time.Second, 1},
+		{0, 1},
+		{time.Microsecond, 1},
+		{5 * time.Millisecond, 5},
+		{time.Duration(max+10) * time.Millisecond, max},
+	} {
+		if got := s.ticks(c.d); got != c.want {
+			t.Fatalf("ticks(%v) = %d, want %d", c.d, got, c.want)
+		}
+	}
+}
+
+func TestSchedulerPlace(t *testing.T) {
+	s := newTestScheduler()
+	for _, c := range []struct {
+		ticks uint64
+		level int
+		idx   uint64
+	}{
+		{1, -1, 1},
+		{255, -1, 255},
+		{256, 0, 1},
+		{300, 0, 1},
+		{nearsize << levelbits, 1, 1},
+		{nearsize<<levelbits + 5, 1, 1},
+		{nearsize << (2 * levelbits), 2, 1},
+		{nearsize << (3 * levelbits), 3, 1},
+	} {
+		tm := s.After(testOwner, time.Duration(c.ticks)*time.Millisecond, func() {})
+		level, idx, ok := slotOf(s, tm)
+		if !ok || level != c.level || idx != c.idx {
+			t.Fatalf("%d ticks placed at level %d slot %d (%v), want level %d slot %d", c.ticks, level, idx, ok, c.level, c.idx)
+		}
+	}
+}
+
+func TestSchedulerCascade(t *testing.T) {
+	for _, n := range []uint64{3, 300, nearsize<<levelbits + 7} {
+		s := newTestScheduler()
+		var fired []uint64
+		s.After(testOwner, time.Duration(n)*time.Millisecond, func() { fired = append(fired, s.current) })
+		for i := uint64(0); i < n+10; i++ {
+			s.advance()
+		}
+		if len(fired) != 1 || fired[0] != n {
+			t.Fatalf("timer of %d ticks fired at %v", n, fired)
+		}
+		if _, ok := s.owners[testOwner]; ok {
+			t.Fatalf("fired timer of %d ticks still owned", n)
+		}
+	}
+}
+
+func TestSchedulerNegativeDuration(t *testing.T) {
+	s := newTestScheduler()
+	fired := 0
+	s.After(testOwner, -time.Hour, func() { fired++ })
+	s.advance()
+	if fired != 1 {
+		t.Fatalf("negative duration timer fired %d times after one tick", fired)
+	}
+}
+
+func TestSchedulerEveryAndCancel(t *testing.T) {
+	s := newTestScheduler()
+	var fired []uint64
+	tm := s.Every(testOwner, 100*time.Millisecond, func() { fired = append(fired, s.current) })
+	for i := 0; i < 350; i++ {
+		s.advance()
+	}
+	if len(fired) != 3 || fired[0] != 100 || fired[1] != 200 || fired[2] != 300 {
+		t.Fatalf("repeating timer fired at %v", fired)
+	}
+	if !tm.Cancel() {
+		t.Fatal("cancel running timer")
+	}
+	for i := 0; i < 100; i++ {
+		s.advance()
+	}
+	if len(fired) != 3 {
+		t.Fatalf("canceled timer fired at %v", fired)
+	}
+
+	//取消所属者后其任务不再执行
+	once := s.After(testOwner, 10*time.Millisecond, func() { fired = append(fired, s.current) })
+	s.CancelOwner(testOwner)
+	for i := 0; i < 20; i++ {
+		s.advance()
+	}
+	if len(fired) != 3 || !once.Stopped() {
+		t.Fatalf("owner canceled timer fired at %v", fired)
+	}
+}
@@ -0,0 +1,73 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// StdoutExporter 每个跨度输出一行JSON，用于本地调试
+type StdoutExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutExporter w为nil时输出到标准输出
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &StdoutExporter{w: w}
+}
+
+type stdoutSpan struct {
+	Service  string                 `json:"service"`
+	TraceID  string                 `json:"trace_id"`
+	SpanID   string                 `json:"span_id"`
+	ParentID string                 `json:"parent_id,omitempty"`
+	Name     string                 `json:"name"`
+	Kind     SpanKind               `json:"kind"`
+	Start    time.Time              `json:"start"`
+	Duration string                 `json:"duration"`
+	Attrs    map[string]interface{} `json:"attrs,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+func (e *StdoutExporter) Export(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		out := stdoutSpan{
+			Service:  s.Service(),
+			TraceID:  s.SpanContext().TraceID.String(),
+			SpanID:   s.SpanContext().SpanID.String(),
+			Name:     s.Name(),
+			Kind:     s.Kind(),
+			Start:    s.StartTime(),
+			Duration: s.EndTime().Sub(s.StartTime()).String(),
+			Error:    s.Err(),
+		}
+		if s.Parent().IsValid() {
+			out.ParentID = s.Parent().String()
+		}
+		if attrs := s.Attrs(); len(attrs) > 0 {
+			out.Attrs = make(map[string]interface{}, len(attrs))
+			for _, a := range attrs {
+				out.Attrs[a.Key] = a.Value
+			}
+		}
+		if err := enc.Encode(out); err != nil {
+			return fmt.Errorf("%w: %w", ErrorTrace, err)
+		}
+	}
+	return nil
+}
+
+func (e *StdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
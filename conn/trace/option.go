@@ -0,0 +1,94 @@
+package trace
+
+import (
+	"errors"
+	"time"
+)
+
+// TracerOption 追踪器选项
+type TracerOption func(options *traceroptions) error
+type traceroptions struct {
+	service   *string
+	ratio     *float64
+	batch     *int
+	interval  *time.Duration
+	queuesize *int
+}
+
+// service:服务名，导出为service.name，默认ggbond
+func WithServiceName(service string) TracerOption {
+	return func(options *traceroptions) error {
+		if service == "" {
+			return errors.New("service name is not valid")
+		}
+		options.service = &service
+		return nil
+	}
+}
+
+// ratio:新链路的采样比例 0~1，默认1
+// 带有上游链路上下文的消息沿用上游的采样决定
+func WithSampleRatio(ratio float64) TracerOption {
+	return func(options *traceroptions) error {
+		if ratio < 0 || ratio > 1 {
+			return errors.New("sample ratio is not valid")
+		}
+		options.ratio = &ratio
+		return nil
+	}
+}
+
+// batch:单次导出的最大跨度数 interval:导出周期
+func WithBatch(batch int, interval time.Duration) TracerOption {
+	return func(options *traceroptions) error {
+		if batch <= 0 || interval <= 0 {
+			return errors.New("batch is not valid")
+		}
+		options.batch = &batch
+		options.interval = &interval
+		return nil
+	}
+}
+
+// queuesize:待导出跨度队列长度，队列满时丢弃跨度，不阻塞消息处理
+func WithQueueSize(queuesize int) TracerOption {
+	return func(options *traceroptions) error {
+		if queuesize <= 0 {
+			return errors.New("queue size is not valid")
+		}
+		options.queuesize = &queuesize
+		return nil
+	}
+}
+
+// OTLPOption OTLP导出器选项
+type OTLPOption func(options *otlpoptions) error
+type otlpoptions struct {
+	headers map[string]string
+	timeout *time.Duration
+}
+
+// 请求头，例如收集器的鉴权信息
+func WithHeader(key, value string) OTLPOption {
+	return func(options *otlpoptions) error {
+		if key == "" {
+			return errors.New("header key is not valid")
+		}
+		if options.headers == nil {
+			options.headers = make(map[string]string)
+		}
+		options.headers[key] = value
+		return nil
+	}
+}
+
+// timeout:单次导出请求超时时间，默认10秒
+func WithTimeout(timeout time.Duration) OTLPOption {
+	return func(options *otlpoptions) error {
+		if timeout <= 0 {
+			return errors.New("timeout is not valid")
+		}
+		options.timeout = &timeout
+		return nil
+	}
+}
@@ -0,0 +1,180 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// OTLPExporter 以OTLP/HTTP JSON格式导出到收集器的/v1/traces
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewOTLPExporter 创建OTLP导出器
+// endpoint:收集器地址，例如 http://127.0.0.1:4318，未带路径时使用/v1/traces
+func NewOTLPExporter(endpoint string, opt ...OTLPOption) (*OTLPExporter, error) {
+	var options otlpoptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			return nil, fmt.Errorf("%w: apply option error:%w", ErrorTrace, err)
+		}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("%w: otlp endpoint is not valid: %s", ErrorTrace, endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	timeout := 10 * time.Second
+	if options.timeout != nil {
+		timeout = *options.timeout
+	}
+	return &OTLPExporter{
+		endpoint: u.String(),
+		headers:  options.headers,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// OTLP JSON编码，ID为十六进制字符串，64位整数为十进制字符串
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+type otlpScope struct {
+	Name string `json:"name"`
+}
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` //0未设置 2错误
+	Message string `json:"message,omitempty"`
+}
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func otlpAttr(key string, value interface{}) otlpKeyValue {
+	var v otlpValue
+	switch x := value.(type) {
+	case string:
+		v.StringValue = &x
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		v.IntValue = &s
+	case int32:
+		s := strconv.FormatInt(int64(x), 10)
+		v.IntValue = &s
+	case int:
+		s := strconv.Itoa(x)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &x
+	case bool:
+		v.BoolValue = &x
+	default:
+		s := fmt.Sprint(x)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	//按服务分组，同一进程一般只有一个服务
+	var req otlpRequest
+	index := make(map[string]int)
+	for _, s := range spans {
+		i, ok := index[s.Service()]
+		if !ok {
+			i = len(req.ResourceSpans)
+			index[s.Service()] = i
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource:   otlpResource{Attributes: []otlpKeyValue{otlpAttr("service.name", s.Service())}},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/chen102/ggbond"}}},
+			})
+		}
+		out := otlpSpan{
+			TraceID:           s.SpanContext().TraceID.String(),
+			SpanID:            s.SpanContext().SpanID.String(),
+			Name:              s.Name(),
+			Kind:              s.Kind(),
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime().UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime().UnixNano(), 10),
+		}
+		if s.Parent().IsValid() {
+			out.ParentSpanID = s.Parent().String()
+		}
+		for _, a := range s.Attrs() {
+			out.Attributes = append(out.Attributes, otlpAttr(a.Key, a.Value))
+		}
+		if s.Err() != "" {
+			out.Status = otlpStatus{Code: 2, Message: s.Err()}
+		}
+		scope := &req.ResourceSpans[i].ScopeSpans[0]
+		scope.Spans = append(scope.Spans, out)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorTrace, err)
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorTrace, err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		r.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorTrace, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: otlp export status %d: %s", ErrorTrace, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
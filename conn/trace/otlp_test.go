@@ -0,0 +1,161 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录收到的导出请求的收集器
+type testCollector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  []http.Header
+	paths    []string
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req otlpRequest
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.paths = append(c.paths, r.URL.Path)
+	c.mu.Unlock()
+}
+
+func (c *testCollector) spans() map[string]otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]otlpSpan)
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					spans[s.Name] = s
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func attr(s otlpSpan, key string) (otlpValue, bool) {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return otlpValue{}, false
+}
+
+func TestOTLPExporter(t *testing.T) {
+	collector := &testCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+	exporter, err := NewOTLPExporter(srv.URL, WithHeader("Authorization", "Bearer token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer, err := NewTracer(exporter, WithServiceName("gate"), WithBatch(10, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, parent := tracer.Start(context.Background(), "server.message", Int64("route", 100), String("node", "a"), Bool("cached", true))
+	parent.SetKind(SpanKindServer)
+	_, child := tracer.Start(ctx, "cluster.forward")
+	child.SetKind(SpanKindClient)
+	child.SetError(errors.New("link closed"))
+	child.End()
+	parent.End()
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(shutdown); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := collector.spans()
+	if len(spans) != 2 {
+		t.Fatalf("collector received %d spans", len(spans))
+	}
+	collector.mu.Lock()
+	for i, h := range collector.headers {
+		if collector.paths[i] != "/v1/traces" || h.Get("Content-Type") != "application/json" || h.Get("Authorization") != "Bearer token" {
+			t.Fatalf("request %s headers %v", collector.paths[i], h)
+		}
+	}
+	rs := collector.requests[0].ResourceSpans[0]
+	collector.mu.Unlock()
+	if len(rs.Resource.Attributes) != 1 || rs.Resource.Attributes[0].Key != "service.name" || *rs.Resource.Attributes[0].Value.StringValue != "gate" {
+		t.Fatalf("resource %+v", rs.Resource)
+	}
+
+	p, c := spans["server.message"], spans["cluster.forward"]
+	if p.TraceID != parent.SpanContext().TraceID.String() || p.SpanID != parent.SpanContext().SpanID.String() || p.ParentSpanID != "" {
+		t.Fatalf("parent span %+v", p)
+	}
+	if c.TraceID != p.TraceID || c.ParentSpanID != p.SpanID {
+		t.Fatalf("child span %+v not linked to %+v", c, p)
+	}
+	if p.Kind != SpanKindServer || c.Kind != SpanKindClient {
+		t.Fatalf("kinds %d %d", p.Kind, c.Kind)
+	}
+	//64位整数按十进制字符串编码
+	if v, ok := attr(p, "route"); !ok || v.IntValue == nil || *v.IntValue != "100" {
+		t.Fatalf("route attribute %+v", v)
+	}
+	if v, ok := attr(p, "node"); !ok || v.StringValue == nil || *v.StringValue != "a" {
+		t.Fatalf("node attribute %+v", v)
+	}
+	if v, ok := attr(p, "cached"); !ok || v.BoolValue == nil || !*v.BoolValue {
+		t.Fatalf("cached attribute %+v", v)
+	}
+	if p.Status.Code != 0 || c.Status.Code != 2 || c.Status.Message != "link closed" {
+		t.Fatalf("status %+v %+v", p.Status, c.Status)
+	}
+	start, err1 := strconv.ParseInt(p.StartTimeUnixNano, 10, 64)
+	end, err2 := strconv.ParseInt(p.EndTimeUnixNano, 10, 64)
+	if err1 != nil || err2 != nil || start <= 0 || end < start {
+		t.Fatalf("times %s %s", p.StartTimeUnixNano, p.EndTimeUnixNano)
+	}
+}
+
+func TestOTLPExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "collector overloaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	exporter, err := NewOTLPExporter(srv.URL + "/custom/path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer, err := NewTracer(exporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tracer.Start(context.Background(), "request")
+	span.End()
+	err = exporter.Export(context.Background(), []*Span{span})
+	if !errors.Is(err, ErrorTrace) || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "collector overloaded") {
+		t.Fatalf("export error: %v", err)
+	}
+	tracer.Shutdown(context.Background())
+}
+
+func TestOTLPEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "127.0.0.1:4318", "ftp://127.0.0.1", "http://"} {
+		if _, err := NewOTLPExporter(endpoint); !errors.Is(err, ErrorTrace) {
+			t.Fatalf("endpoint %q: %v", endpoint, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package trace
+
+import (
+	"sync"
+	"time"
+)
+
+// SpanKind 跨度类型，取值与OTLP一致
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2 //收到的客户端消息
+	SpanKindClient   SpanKind = 3 //发往其他节点、后端的请求
+)
+
+// Attr 跨度属性
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attr {
+	return Attr{key, value}
+}
+func Int64(key string, value int64) Attr {
+	return Attr{key, value}
+}
+func Int(key string, value int) Attr {
+	return Attr{key, int64(value)}
+}
+func Bool(key string, value bool) Attr {
+	return Attr{key, value}
+}
+func Float64(key string, value float64) Attr {
+	return Attr{key, value}
+}
+
+// Span 跨度
+// nil跨度的方法均为空操作，未开启追踪时调用方无需判断
+// 未采样的跨度只用于传递链路上下文，不记录属性也不导出
+type Span struct {
+	tracer *Tracer
+	name   string
+	sc     SpanContext
+	parent SpanID
+	start  time.Time
+
+	mu    sync.Mutex
+	kind  SpanKind
+	end   time.Time
+	attrs []Attr
+	err   string
+	ended bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// Recording 是否记录并导出
+func (s *Span) Recording() bool {
+	return s != nil && s.sc.Sampled
+}
+
+func (s *Span) SetKind(kind SpanKind) {
+	if !s.Recording() {
+		return
+	}
+	s.mu.Lock()
+	s.kind = kind
+	s.mu.Unlock()
+}
+
+func (s *Span) SetAttr(attrs ...Attr) {
+	if !s.Recording() {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// SetError 记录错误，err为nil时忽略
+func (s *Span) SetError(err error) {
+	if err == nil || !s.Recording() {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+// EndAt 以指定时间结束，重复调用忽略
+func (s *Span) EndAt(t time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = t
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+// 以下供导出器读取，跨度结束后不再变化
+
+func (s *Span) Name() string {
+	return s.name
+}
+func (s *Span) Parent() SpanID {
+	return s.parent
+}
+func (s *Span) Kind() SpanKind {
+	return s.kind
+}
+func (s *Span) StartTime() time.Time {
+	return s.start
+}
+func (s *Span) EndTime() time.Time {
+	return s.end
+}
+func (s *Span) Attrs() []Attr {
+	return s.attrs
+}
+
+// Err 错误信息，没有错误时为空
+func (s *Span) Err() string {
+	return s.err
+}
+
+// Service 所属服务名
+func (s *Span) Service() string {
+	return s.tracer.service
+}
@@ -0,0 +1,126 @@
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+var ErrorTrace = errors.New("trace error")
+
+// EncodedSize 链路上下文编码长度:追踪ID 16字节、跨度ID 8字节、标志 1字节
+const EncodedSize = 25
+
+const flagSampled = 0x01
+
+// TraceID 追踪ID
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID 跨度ID
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	for !t.IsValid() {
+		binary.BigEndian.PutUint64(t[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(t[8:], rand.Uint64())
+	}
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		binary.BigEndian.PutUint64(s[:], rand.Uint64())
+	}
+	return s
+}
+
+// SpanContext 链路上下文，随消息在客户端、网关、集群节点之间传递
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Encode 编码为EncodedSize字节，无效上下文返回nil
+func (sc SpanContext) Encode() []byte {
+	if !sc.IsValid() {
+		return nil
+	}
+	b := make([]byte, EncodedSize)
+	copy(b, sc.TraceID[:])
+	copy(b[16:], sc.SpanID[:])
+	if sc.Sampled {
+		b[24] = flagSampled
+	}
+	return b
+}
+
+// Decode 解码链路上下文
+func Decode(b []byte) (SpanContext, error) {
+	var sc SpanContext
+	if len(b) != EncodedSize {
+		return sc, fmt.Errorf("%w: span context length %d", ErrorTrace, len(b))
+	}
+	copy(sc.TraceID[:], b[:16])
+	copy(sc.SpanID[:], b[16:24])
+	sc.Sampled = b[24]&flagSampled != 0
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("%w: span context is not valid", ErrorTrace)
+	}
+	return sc, nil
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan 设置当前跨度
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext 当前跨度，没有时返回nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemote 设置从消息中解出的远端父上下文
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext 当前跨度的上下文，没有当前跨度时返回远端父上下文
+// 未开启追踪的节点据此原样转发上游的链路上下文
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
@@ -0,0 +1,174 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/chen102/ggbond/message"
+)
+
+func testSpanContext(sampled bool) SpanContext {
+	return SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: sampled}
+}
+
+func TestSpanContextEncode(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		sc := testSpanContext(sampled)
+		b := sc.Encode()
+		if len(b) != message.TraceSize {
+			t.Fatalf("encoded size %d", len(b))
+		}
+		got, err := Decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != sc {
+			t.Fatalf("decoded %+v, want %+v", got, sc)
+		}
+	}
+	if b := (SpanContext{}).Encode(); b != nil {
+		t.Fatalf("invalid context encoded to %x", b)
+	}
+	if _, err := Decode(make([]byte, EncodedSize)); !errors.Is(err, ErrorTrace) {
+		t.Fatalf("decode zero context: %v", err)
+	}
+	if _, err := Decode(make([]byte, EncodedSize-1)); !errors.Is(err, ErrorTrace) {
+		t.Fatalf("decode short context: %v", err)
+	}
+}
+
+// 编码后再解码，返回编码后的字节
+func roundTrip(t *testing.T, body []byte, tracectx []byte) (*message.TCPMessage, []byte) {
+	t.Helper()
+	out := &message.TCPMessage{}
+	if err := out.Write(body, 7, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.SetTraceContext(tracectx); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := out.PackAndWrite(&buf); err != nil {
+		t.Fatal(err)
+	}
+	raw := append([]byte(nil), buf.Bytes()...)
+	in := &message.TCPMessage{}
+	if err := in.ReadAndUnpack(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("%d bytes left after unpack", buf.Len())
+	}
+	if in.RouteID() != 100 || in.MessageID() != 7 || !bytes.Equal(in.Body(), body) || in.Length() != int32(len(body)) {
+		t.Fatalf("got route %d msgid %d length %d body %q", in.RouteID(), in.MessageID(), in.Length(), in.Body())
+	}
+	return in, raw
+}
+
+func TestMessageWithoutTrace(t *testing.T) {
+	body := []byte("hello")
+	in, raw := roundTrip(t, body, nil)
+	if len(raw) != message.HeaderSize+len(body) {
+		t.Fatalf("frame size %d", len(raw))
+	}
+	//未携带链路上下文时格式不变，长度字段即消息体长度
+	if length := binary.BigEndian.Uint32(raw); length != uint32(len(body)) {
+		t.Fatalf("length field %#x", length)
+	}
+	if in.TraceContext() != nil {
+		t.Fatalf("unexpected trace context %x", in.TraceContext())
+	}
+}
+
+func TestMessageWithTrace(t *testing.T) {
+	sc := testSpanContext(true)
+	for _, body := range [][]byte{[]byte("hello"), nil} {
+		in, raw := roundTrip(t, body, sc.Encode())
+		if len(raw) != message.HeaderSize+message.TraceSize+len(body) {
+			t.Fatalf("frame size %d", len(raw))
+		}
+		//长度字段最高位为标志，低31位为消息体长度
+		length := binary.BigEndian.Uint32(raw)
+		if length&(1<<31) == 0 || length&^(1<<31) != uint32(len(body)) {
+			t.Fatalf("length field %#x", length)
+		}
+		if !bytes.Equal(raw[message.HeaderSize:message.HeaderSize+message.TraceSize], sc.Encode()) {
+			t.Fatalf("trace bytes %x", raw[message.HeaderSize:message.HeaderSize+message.TraceSize])
+		}
+		got, err := Decode(in.TraceContext())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != sc {
+			t.Fatalf("decoded %+v, want %+v", got, sc)
+		}
+	}
+}
+
+func TestMessageStream(t *testing.T) {
+	//带与不带链路上下文的消息交替出现在同一条连接上，复用同一个消息对象读取
+	sc := testSpanContext(false)
+	var buf bytes.Buffer
+	for i, tracectx := range [][]byte{sc.Encode(), nil, sc.Encode()} {
+		msg := &message.TCPMessage{}
+		if err := msg.Write([]byte{byte(i)}, int32(i), 100); err != nil {
+			t.Fatal(err)
+		}
+		if err := msg.SetTraceContext(tracectx); err != nil {
+			t.Fatal(err)
+		}
+		if err := msg.PackAndWrite(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := &message.TCPMessage{}
+	for i := 0; i < 3; i++ {
+		if err := in.ReadAndUnpack(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if in.MessageID() != int32(i) || !bytes.Equal(in.Body(), []byte{byte(i)}) {
+			t.Fatalf("message %d: msgid %d body %x", i, in.MessageID(), in.Body())
+		}
+		if traced := in.TraceContext() != nil; traced != (i != 1) {
+			t.Fatalf("message %d traced %v", i, traced)
+		}
+	}
+}
+
+func TestMessageTraceContextSize(t *testing.T) {
+	msg := &message.TCPMessage{}
+	if err := msg.SetTraceContext(make([]byte, message.TraceSize+1)); !errors.Is(err, message.ErrorTraceContext) {
+		t.Fatalf("set oversized trace context: %v", err)
+	}
+	if err := msg.SetTraceContext(testSpanContext(true).Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.SetTraceContext(nil); err != nil || msg.TraceContext() != nil {
+		t.Fatalf("clear trace context: %v", err)
+	}
+}
+
+func TestRemoteParent(t *testing.T) {
+	tracer, err := NewTracer(NewStdoutExporter(&bytes.Buffer{}), WithSampleRatio(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracer.Shutdown(context.Background())
+	//上游已采样的链路沿用上游的采样决定
+	remote := testSpanContext(true)
+	ctx := ContextWithRemote(context.Background(), remote)
+	_, span := tracer.Start(ctx, "child")
+	if sc := span.SpanContext(); sc.TraceID != remote.TraceID || !sc.Sampled || sc.SpanID == remote.SpanID {
+		t.Fatalf("child context %+v, remote %+v", sc, remote)
+	}
+	if span.Parent() != remote.SpanID {
+		t.Fatalf("parent %s, want %s", span.Parent(), remote.SpanID)
+	}
+	_, root := tracer.Start(context.Background(), "root")
+	if root.Recording() {
+		t.Fatal("new trace sampled with ratio 0")
+	}
+}
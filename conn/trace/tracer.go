@@ -0,0 +1,203 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chen102/ggbond/conn/logger"
+)
+
+// Exporter 跨度导出器
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer 追踪器
+// 结束的跨度进入队列，由后台协程按批导出
+type Tracer struct {
+	exporter Exporter
+	service  string
+	ratio    float64
+	batch    int
+	interval time.Duration
+	queue    chan *Span
+	dropped  uint64
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewTracer 创建追踪器
+// exporter:跨度导出器
+func NewTracer(exporter Exporter, opt ...TracerOption) (*Tracer, error) {
+	var options traceroptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			return nil, fmt.Errorf("%w: apply option error:%w", ErrorTrace, err)
+		}
+	}
+	if exporter == nil {
+		return nil, fmt.Errorf("%w: exporter is nil", ErrorTrace)
+	}
+	t := &Tracer{
+		exporter: exporter,
+		service:  "ggbond",
+		ratio:    1,
+		batch:    512,
+		interval: time.Second,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	queuesize := 4096
+	if options.service != nil {
+		t.service = *options.service
+	}
+	if options.ratio != nil {
+		t.ratio = *options.ratio
+	}
+	if options.batch != nil {
+		t.batch, t.interval = *options.batch, *options.interval
+	}
+	if options.queuesize != nil {
+		queuesize = *options.queuesize
+	}
+	t.queue = make(chan *Span, queuesize)
+	go t.run()
+	return t, nil
+}
+
+// Start 创建跨度，ctx中有当前跨度或远端父上下文时作为其子跨度，否则开始新链路
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return t.StartAt(ctx, name, time.Now(), attrs...)
+}
+
+// StartAt 以指定时间创建跨度，用于事后补记的阶段，例如解码
+func (t *Tracer) StartAt(ctx context.Context, name string, start time.Time, attrs ...Attr) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID, sc.Sampled = parent.TraceID, parent.Sampled
+	} else {
+		sc.TraceID, sc.Sampled = newTraceID(), t.sample()
+	}
+	s := &Span{tracer: t, name: name, sc: sc, parent: parent.SpanID, start: start, kind: SpanKindInternal}
+	if sc.Sampled {
+		s.attrs = append(s.attrs, attrs...)
+	}
+	return ContextWithSpan(ctx, s), s
+}
+
+// Dropped 队列满被丢弃的跨度数
+func (t *Tracer) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Shutdown 导出剩余跨度并关闭导出器
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() {
+		close(t.stop)
+	})
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrorTrace, ctx.Err())
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+func (t *Tracer) sample() bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	return t.ratio > 0 && rand.Float64() < t.ratio
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	spans := make([]*Span, 0, t.batch)
+	flush := func() {
+		if len(spans) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := t.exporter.Export(ctx, spans); err != nil {
+			logger.L().Warn("trace export error", "spans", len(spans), "error", err)
+		}
+		cancel()
+		spans = make([]*Span, 0, t.batch)
+	}
+	for {
+		select {
+		case s := <-t.queue:
+			spans = append(spans, s)
+			if len(spans) >= t.batch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case s := <-t.queue:
+					spans = append(spans, s)
+					if len(spans) >= t.batch {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// 进程默认追踪器，未通过选项注入追踪器的组件(网关后端、集群节点)使用
+var global atomic.Value
+
+type holder struct {
+	t *Tracer
+}
+
+// SetDefault 设置默认追踪器，nil时关闭
+func SetDefault(t *Tracer) {
+	global.Store(holder{t})
+}
+
+// Default 默认追踪器，未设置时返回nil
+func Default() *Tracer {
+	h, _ := global.Load().(holder)
+	return h.t
+}
+
+// Start 使用ctx中当前跨度所属的追踪器创建子跨度，没有时使用默认追踪器
+// 均未设置时返回nil跨度
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return StartAt(ctx, name, time.Now(), attrs...)
+}
+
+func StartAt(ctx context.Context, name string, start time.Time, attrs ...Attr) (context.Context, *Span) {
+	t := Default()
+	if s := SpanFromContext(ctx); s != nil {
+		t = s.tracer
+	}
+	if t == nil {
+		return ctx, nil
+	}
+	return t.StartAt(ctx, name, start, attrs...)
+}
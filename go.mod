@@ -1,6 +1,6 @@
 module github.com/chen102/ggbond
 
-go 1.18
+go 1.21
 
 require (
 	github.com/satori/go.uuid v1.2.0
@@ -2,35 +2,394 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/chen102/ggbond/conn/actor"
+	"github.com/chen102/ggbond/conn/admin"
+	"github.com/chen102/ggbond/conn/cluster"
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/gateway"
+	"github.com/chen102/ggbond/conn/idgen"
+	"github.com/chen102/ggbond/conn/ipfilter"
+	"github.com/chen102/ggbond/conn/listener"
+	"github.com/chen102/ggbond/conn/logger"
+	"github.com/chen102/ggbond/conn/metrics"
+	"github.com/chen102/ggbond/conn/proxyproto"
+	"github.com/chen102/ggbond/conn/ratelimit"
 	"github.com/chen102/ggbond/conn/routermanage"
 	"github.com/chen102/ggbond/conn/server"
 	"github.com/chen102/ggbond/conn/store"
+	"github.com/chen102/ggbond/conn/timer"
+	"github.com/chen102/ggbond/conn/trace"
+	"github.com/chen102/ggbond/service/bench"
 	"github.com/chen102/ggbond/service/hook"
+	"github.com/chen102/ggbond/service/match"
 	"github.com/chen102/ggbond/service/router"
+	"github.com/chen102/ggbond/service/session"
 )
 
 type RouterInstance interface {
 	Handles() map[int32]routermanage.RouterHandle
 }
+
+// 可多次设置的字符串参数
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *listFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
 type IServer interface {
 	Start() error
 	Stop() error
 }
 
+var (
+	port        = flag.Int64("port", 8089, "客户端监听端口")
+	datadir     = flag.String("data", "data", "持久化数据目录")
+	node        = flag.String("node", "", "集群节点ID，为空时单机运行")
+	nodeid      = flag.Int64("nodeid", 0, "连接ID生成器节点号 0~1023，集群内各节点不同")
+	inner       = flag.String("cluster", "127.0.0.1:9089", "集群内部链路监听地址，链路无认证，只能监听在可信内网")
+	peers       = flag.String("peers", "", "集群静态节点列表，格式 节点ID@ip:port，逗号分隔")
+	benchmode   = flag.Bool("bench", false, "注册压测路由(echo、broadcast)，供ggbond-bench使用")
+	metricsaddr = flag.String("metrics", "", "指标HTTP监听地址，例如 127.0.0.1:9100，为空时不开启")
+	redis       = flag.String("redis", "", "集群消息总线redis地址，为空时经节点链路广播")
+	adminaddr   = flag.String("admin", "", "运维管理HTTP监听地址，例如 127.0.0.1:9200，为空时不开启")
+	admintoken  = flag.String("admintoken", "", "运维管理接口访问令牌，为空时不校验")
+	loglevel    = flag.String("loglevel", "info", "日志级别 debug info warn error off")
+	logformat   = flag.String("logformat", "text", "日志格式 text json")
+	tracetype   = flag.String("trace", "", "链路追踪导出方式 stdout otlp，为空时不开启")
+	otlpaddr    = flag.String("otlp", "http://127.0.0.1:4318", "OTLP/HTTP收集器地址")
+	tracesample = flag.Float64("tracesample", 1, "新链路的采样比例 0~1")
+	globalrate  = flag.String("globalrate", "", "全部连接的消息限速，格式 每秒消息数:突发消息数，为空时不限")
+	routerate   = flag.String("routerate", "", "路由消息限速，格式 路由ID=每秒消息数:突发消息数，逗号分隔")
+	connrate    = flag.String("connrate", "", "每个连接的消息限速，格式同globalrate")
+	iprate      = flag.String("iprate", "", "同一IP全部连接的消息限速，格式同globalrate")
+	rateaction  = flag.String("rateaction", "drop", "超限处理方式 drop reply disconnect ban，disconnect与ban只用于连接、IP范围的超限")
+	banduration = flag.Duration("banduration", time.Minute, "rateaction为ban时封禁IP的时长")
+	allowlist   = flag.String("allow", "", "允许连接的IP或CIDR，逗号分隔，为空时不限")
+	denylist    = flag.String("deny", "", "拒绝连接的IP或CIDR，逗号分隔，优先于allow")
+	maxperip    = flag.Int("maxperip", 0, "单个IP的最大连接数，0为不限")
+	acceptrate  = flag.String("acceptrate", "", "新连接接受速率，格式 每秒连接数:突发连接数，为空时不限")
+	proxylist   = flag.String("proxy", "", "可信代理的IP或CIDR，逗号分隔，来自这些地址的连接需携带PROXY协议v1/v2头，为空时不解析")
+	tlscert     = flag.String("tlscert", "", "tls、wss监听使用的PEM证书文件")
+	tlskey      = flag.String("tlskey", "", "tls、wss监听使用的PEM私钥文件")
+	backends    = flag.String("gateway", "", "网关模式，按路由ID范围转发到后端，格式 最小路由-最大路由=ip:port，逗号分隔，为空时不转发")
+	backendaddr = flag.String("backend", "", "后端模式监听地址，接收网关转发的消息，链路无认证，只能监听在可信内网，为空时不开启")
+	listens     listFlag
+)
+
 func main() {
+	flag.Var(&listens, "listen", "额外的监听地址，可多次设置，例如 tls://0.0.0.0:8443 ws://0.0.0.0:8090/ws unix:///tmp/ggbond.sock，?proxy=CIDR,... 为该监听单独设置可信代理")
+	flag.Parse()
+	if *nodeid < 0 || *nodeid > idgen.MaxNode {
+		panic(fmt.Sprintf("nodeid %d out of range [0,%d]", *nodeid, idgen.MaxNode))
+	}
+	//集群内各节点的连接ID生成器节点号须不同，不能沿用默认值
+	if *node != "" && !flagSet("nodeid") {
+		panic("nodeid is required when node is set")
+	}
+	log, err := logger.New(os.Stderr, *loglevel, *logformat)
+	if err != nil {
+		panic(err)
+	}
+	logger.Set(log)
+	persist, err := store.OpenPersistStore(*datadir)
+	if err != nil {
+		panic(err)
+	}
+	defer persist.Close()
 
 	var (
-		connmanager   server.ITCPConnManage   = server.NewConnManage("tcp", store.NewTCPSyncMap(), &hook.ConnHook{})
+		connmanager   server.ITCPConnManage   = server.NewConnManage("tcp", store.NewTCPShardMap(64), &hook.ConnHook{}, connmanage.WithLogger(log))
 		groupmanager  server.IConnGroupMagage = server.NewConnGroup()
-		routermanager server.IRouterManage    = server.NewRouterManage("router", store.NewTCPSyncMap())
-		connsvc       IServer                 = server.NewTCPServer(connmanager, routermanager, server.WithPort(8089))
-		systemsvc     RouterInstance          = router.NewSystemService(connmanager)
+		routermanager server.IRouterManage    = server.NewRouterManage("router", store.NewSyncMap[routermanage.RouterHandle]())
+		aoimanager    server.IAOIManage       = server.NewAOIManage("grid", 0, 0, 1000, 1000, 50)
+		timermanager  server.ITimer           = server.NewTimer(10 * time.Millisecond)
+		actorsystem                           = actor.NewSystem(1024)
+		systemsvc                             = router.NewSystemService(connmanager)
+		matchsvc                              = match.NewMatchService(connmanager, groupmanager)
+		sessionsvc                            = session.NewSessionService(connmanager, persist.Sessions, persist.Users, nil)
 	)
-	groupmanager.AddGroup(&hook.Room{})
-	for id, handle := range systemsvc.Handles() {
-		routermanager.RegisterRoute(id, handle)
+	sessionsvc.SetGroups(persist.Groups, groupmanager)
+	//玩家实体随连接创建与停止，actor.ByConn(actor.PLAYER)路由投递到该实体
+	connmanager.SetHook(connect.ChainHook(connmanager.Hook(), sessionsvc.ConnHook(), matchsvc.ConnHook(), actorsystem.ConnHook(actor.PLAYER)))
+	idgenerator, err := server.NewIDGenerator("snowflake", *nodeid)
+	if err != nil {
+		panic(err)
+	}
+	options := []server.ServerOption{server.WithPort(*port), server.WithTimer(timermanager), server.WithGroup(groupmanager), server.WithIDGenerator(idgenerator), server.WithLogger(log)}
+	if *tracetype != "" {
+		exporter, err := server.NewTraceExporter(*tracetype, *otlpaddr)
+		if err != nil {
+			panic(err)
+		}
+		tracer, err := trace.NewTracer(exporter, trace.WithSampleRatio(*tracesample))
+		if err != nil {
+			panic(err)
+		}
+		//网关后端、集群节点使用默认追踪器
+		trace.SetDefault(tracer)
+		options = append(options, server.WithTracer(tracer))
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracer.Shutdown(ctx); err != nil {
+				log.Warn("trace shutdown error", "error", err)
+			}
+		}()
+	}
+	if *metricsaddr != "" {
+		registry := metrics.NewRegistry()
+		options = append(options, server.WithMetrics(server.NewMetrics(registry)))
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry.Handler())
+		go func() {
+			log.Info("metrics listen", "addr", *metricsaddr)
+			if err := http.ListenAndServe(*metricsaddr, mux); err != nil {
+				log.Error("metrics server error", "error", err)
+			}
+		}()
 	}
+	adminoptions := []admin.AdminOption{admin.WithToken(*admintoken), admin.WithUserFinder(sessionsvc)}
+	if limitoptions := rateLimitOptions(); len(limitoptions) > 0 {
+		limiter, err := server.NewRateLimiter(limitoptions...)
+		if err != nil {
+			panic(err)
+		}
+		options = append(options, server.WithRateLimiter(limiter))
+		adminoptions = append(adminoptions, admin.WithRateLimiter(limiter))
+	}
+	if *proxylist != "" {
+		proxy, err := server.NewProxyProtocol(proxyproto.WithTrusted(strings.Split(*proxylist, ",")...))
+		if err != nil {
+			panic(err)
+		}
+		options = append(options, server.WithProxyProtocol(proxy))
+	}
+	for _, addr := range listens {
+		options = append(options, listenOption(addr))
+	}
+	//开启运维接口时总是创建IP过滤器，以便运行时封禁
+	if filteroptions := ipFilterOptions(); len(filteroptions) > 0 || *adminaddr != "" {
+		filter, err := server.NewIPFilter(filteroptions...)
+		if err != nil {
+			panic(err)
+		}
+		options = append(options, server.WithIPFilter(filter))
+		adminoptions = append(adminoptions, admin.WithIPFilter(filter))
+	}
+	var broadcast server.IBroadcast = server.NewBroadcast(connmanager, groupmanager)
+	if *node != "" {
+		clusteroptions := []cluster.ClusterOption{cluster.WithRouter(routermanager), cluster.WithIDNode(*nodeid)}
+		if *peers != "" {
+			clusteroptions = append(clusteroptions, cluster.WithPeers(strings.Split(*peers, ",")...))
+		}
+		if *redis != "" {
+			clusterbus, err := server.NewBus("redis", *redis)
+			if err != nil {
+				panic(err)
+			}
+			defer clusterbus.Close()
+			clusteroptions = append(clusteroptions, cluster.WithBus(clusterbus))
+		}
+		clusternode := server.NewCluster(*node, *inner, connmanager, groupmanager, clusteroptions...)
+		sessionsvc.SetBinder(clusternode)
+		options = append(options, server.WithCluster(clusternode))
+		adminoptions = append(adminoptions, admin.WithKicker(clusternode))
+		broadcast = server.NewClusterBroadcast(connmanager, groupmanager, clusternode)
+	}
+	//网关模式下范围内的路由转发到后端，其余路由由本节点处理
+	var serverrouter server.IRouterManage = routermanager
+	if gatewayoptions := gatewayOptions(); len(gatewayoptions) > 0 {
+		gw := server.NewGateway(routermanager, connmanager, gatewayoptions...)
+		defer gw.Close()
+		serverrouter = gw
+	}
+	tcpserver := server.NewTCPServer(connmanager, serverrouter, options...)
+	var connsvc IServer = tcpserver
+	adminoptions = append(adminoptions, admin.WithListeners(tcpserver))
+	room := &hook.Room{}
+	groupmanager.AddGroup(room)
+	aoimanager.SetHandle(systemsvc.AOIHandle())
+	groupmanager.SetAOI(room, aoimanager)
+	//房间实体，房间定时任务在房间协程中执行
+	if roomactor, err := actorsystem.Spawn(room.ActorID()); err == nil {
+		timermanager.Bind(timer.GroupOwner(room.ID()), roomactor)
+	}
+	aoisvc := router.NewAOIService(connmanager, groupmanager, room)
+	services := []RouterInstance{systemsvc, matchsvc, sessionsvc, aoisvc}
+	if *benchmode {
+		services = append(services, bench.NewBenchService(connmanager, groupmanager))
+	}
+	for _, svc := range services {
+		for id, handle := range svc.Handles() {
+			routermanager.RegisterRoute(id, handle)
+		}
+	}
+	for id, handle := range aoisvc.ActorHandles() {
+		routermanager.RegisterActorRoute(id, actorsystem, actor.Fixed(room.ActorID()), handle)
+	}
+	if *adminaddr != "" {
+		adminsvc, err := server.NewAdmin(connmanager, groupmanager, routermanager, append(adminoptions, admin.WithBroadcaster(broadcast))...)
+		if err != nil {
+			panic(err)
+		}
+		go func() {
+			log.Info("admin listen", "addr", *adminaddr)
+			if err := http.ListenAndServe(*adminaddr, adminsvc.Handler()); err != nil {
+				log.Error("admin server error", "error", err)
+			}
+		}()
+	}
+	//后端模式下网关转发来的连接与直连的连接使用同一个连接管理器和路由
+	if *backendaddr != "" {
+		backend := server.NewBackend(*backendaddr, routermanager, connmanager)
+		if err := backend.Start(); err != nil {
+			panic(err)
+		}
+		defer backend.Stop()
+	}
+	ctx := context.Background()
 	connsvc.Start()
-	connmanager.CheckHealths(context.Background())
+	go matchsvc.Run(ctx)
+	connmanager.CheckHealths(ctx)
+}
+
+// 由限速参数生成限流器选项，均未设置时返回空
+func rateLimitOptions() []ratelimit.LimiterOption {
+	var options []ratelimit.LimiterOption
+	parse := func(s string) ratelimit.Rate {
+		r, err := ratelimit.ParseRate(s)
+		if err != nil {
+			panic(err)
+		}
+		return r
+	}
+	if *globalrate != "" {
+		r := parse(*globalrate)
+		options = append(options, ratelimit.WithGlobal(r.Rate, r.Burst))
+	}
+	if *routerate != "" {
+		for _, item := range strings.Split(*routerate, ",") {
+			id, rate, ok := strings.Cut(item, "=")
+			routeid, err := strconv.ParseInt(id, 10, 32)
+			if !ok || err != nil {
+				panic(fmt.Errorf("routerate is not valid: %s", item))
+			}
+			r := parse(rate)
+			options = append(options, ratelimit.WithRoute(int32(routeid), r.Rate, r.Burst))
+		}
+	}
+	if *connrate != "" {
+		r := parse(*connrate)
+		options = append(options, ratelimit.WithConn(r.Rate, r.Burst))
+	}
+	if *iprate != "" {
+		r := parse(*iprate)
+		options = append(options, ratelimit.WithIP(r.Rate, r.Burst))
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	action, err := ratelimit.ParseAction(*rateaction)
+	if err != nil {
+		panic(err)
+	}
+	return append(options, ratelimit.WithAction(action), ratelimit.WithBanDuration(*banduration))
+}
+
+// 由网关参数生成网关选项，未设置时返回空
+func gatewayOptions() []gateway.GatewayOption {
+	if *backends == "" {
+		return nil
+	}
+	var options []gateway.GatewayOption
+	for _, item := range strings.Split(*backends, ",") {
+		routes, addr, ok := strings.Cut(item, "=")
+		min, max, ok2 := strings.Cut(routes, "-")
+		minid, err1 := strconv.ParseInt(min, 10, 32)
+		maxid, err2 := strconv.ParseInt(max, 10, 32)
+		if !ok || !ok2 || err1 != nil || err2 != nil {
+			panic(fmt.Errorf("gateway is not valid: %s", item))
+		}
+		options = append(options, gateway.WithBackend(int32(minid), int32(maxid), addr))
+	}
+	return options
+}
+
+// 由IP过滤参数生成过滤器选项，均未设置时返回空
+func ipFilterOptions() []ipfilter.FilterOption {
+	var options []ipfilter.FilterOption
+	if *allowlist != "" {
+		options = append(options, ipfilter.WithAllow(strings.Split(*allowlist, ",")...))
+	}
+	if *denylist != "" {
+		options = append(options, ipfilter.WithDeny(strings.Split(*denylist, ",")...))
+	}
+	if *maxperip != 0 {
+		options = append(options, ipfilter.WithMaxConnsPerIP(*maxperip))
+	}
+	if *acceptrate != "" {
+		r, err := ratelimit.ParseRate(*acceptrate)
+		if err != nil {
+			panic(err)
+		}
+		options = append(options, ipfilter.WithAcceptRate(r.Rate, r.Burst))
+	}
+	return options
+}
+
+// 命令行是否显式设置了该参数
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// 由监听地址 network://addr/path?proxy=CIDR,...&name=名称 生成服务器选项
+func listenOption(addr string) server.ServerOption {
+	u, err := url.Parse(addr)
+	if err != nil {
+		panic(fmt.Errorf("listen is not valid: %w", err))
+	}
+	var opts []listener.ListenerOption
+	if name := u.Query().Get("name"); name != "" {
+		opts = append(opts, listener.WithName(name))
+	}
+	if trusted := u.Query().Get("proxy"); trusted != "" {
+		proxy, err := server.NewProxyProtocol(proxyproto.WithTrusted(strings.Split(trusted, ",")...))
+		if err != nil {
+			panic(err)
+		}
+		opts = append(opts, listener.WithProxyProtocol(proxy))
+	}
+	switch u.Scheme {
+	case listener.TLS, listener.WSS:
+		opts = append(opts, listener.WithCertFile(*tlscert, *tlskey))
+	}
+	switch u.Scheme {
+	case listener.UNIX:
+		return server.WithListener(u.Scheme, u.Path, opts...)
+	case listener.WS, listener.WSS:
+		opts = append(opts, listener.WithPath(u.Path))
+	}
+	return server.WithListener(u.Scheme, u.Host, opts...)
 }
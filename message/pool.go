@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"sync"
+	"sync/atomic"
 )
 
 type IMessage interface {
@@ -14,21 +15,39 @@ type IMessage interface {
 	RouteID() int32
 	Length() int32
 	Write(body []byte, messageID int32, routeID int32) error
+	TraceContext() []byte
+	SetTraceContext(trace []byte) error
 	Reset()
 }
 
 // 消息对象池
 type Pool struct {
-	pool map[string]sync.Pool
+	pool  map[string]*sync.Pool
+	stats map[string]*poolStats
+}
+
+type poolStats struct {
+	gets   uint64
+	misses uint64 //池中无可用对象而新建的次数
+}
+
+// PoolStats 对象池统计
+type PoolStats struct {
+	Gets   uint64
+	Misses uint64
 }
 
 func NewPool(msgtype ...string) *Pool {
 	msgpool := &Pool{
-		pool: make(map[string]sync.Pool),
+		pool:  make(map[string]*sync.Pool),
+		stats: make(map[string]*poolStats),
 	}
 	for _, v := range msgtype {
-		msgpool.pool[v] = sync.Pool{
+		stats := &poolStats{}
+		msgpool.stats[v] = stats
+		msgpool.pool[v] = &sync.Pool{
 			New: func() interface{} {
+				atomic.AddUint64(&stats.misses, 1)
 				if v == "tcp" {
 					return &TCPMessage{}
 				}
@@ -44,9 +63,18 @@ func (p *Pool) Get(msgtype string) (IMessage, error) {
 	if !ok {
 		return nil, errors.New("pool msgtype is null")
 	}
-
+	atomic.AddUint64(&p.stats[msgtype].gets, 1)
 	return data.Get().(IMessage), nil
 }
+
+// Stats 各消息类型的获取次数与未命中次数
+func (p *Pool) Stats() map[string]PoolStats {
+	stats := make(map[string]PoolStats, len(p.stats))
+	for t, s := range p.stats {
+		stats[t] = PoolStats{Gets: atomic.LoadUint64(&s.gets), Misses: atomic.LoadUint64(&s.misses)}
+	}
+	return stats
+}
 func (p *Pool) Put(msgtype string, msg IMessage) error {
 	data, ok := p.pool[msgtype]
 	if !ok {
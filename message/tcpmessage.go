@@ -7,7 +7,18 @@ import (
 	"math"
 )
 
-const headerSize = 12 // 数据包长度、路由id、消息id各4字节
+const HeaderSize = 12 // 数据包长度、路由id、消息id各4字节
+
+// 链路上下文扩展
+// 长度字段最高位置1时，消息头后紧跟TraceSize字节的链路上下文，再跟消息体，长度字段低31位为消息体长度
+// 未携带链路上下文的消息格式不变
+const (
+	TraceSize       = 25
+	traceFlag int32 = -1 << 31
+)
+
+var ErrorTraceContext = errors.New("trace context length is not valid")
+
 type flusher interface {
 	Flush() error
 }
@@ -16,6 +27,7 @@ type TCPMessage struct {
 	messageID int32
 	routeID   int32
 	length    int32
+	trace     []byte
 }
 
 func (m *TCPMessage) Reset() {
@@ -23,6 +35,7 @@ func (m *TCPMessage) Reset() {
 	m.messageID = 0
 	m.routeID = 0
 	m.length = 0
+	m.trace = nil
 }
 func (m *TCPMessage) PackAndWrite(w io.Writer) error {
 	if err := m.pack(w); err != nil {
@@ -46,6 +59,14 @@ func (m *TCPMessage) ReadAndUnpack(r io.Reader) error {
 	if err := binary.Read(r, binary.BigEndian, &m.messageID); err != nil {
 		return err
 	}
+	m.trace = nil
+	if m.length&traceFlag != 0 {
+		m.length &^= traceFlag
+		m.trace = make([]byte, TraceSize)
+		if _, err := io.ReadFull(r, m.trace); err != nil {
+			return err
+		}
+	}
 	if m.length > 0 {
 		m.body = make([]byte, m.length)
 		if err := binary.Read(r, binary.BigEndian, &m.body); err != nil {
@@ -58,7 +79,11 @@ func (m *TCPMessage) ReadAndUnpack(r io.Reader) error {
 
 func (m *TCPMessage) pack(w io.Writer) error {
 	// 写入数据包长度
-	if err := binary.Write(w, binary.BigEndian, m.length); err != nil {
+	length := m.length
+	if m.trace != nil {
+		length |= traceFlag
+	}
+	if err := binary.Write(w, binary.BigEndian, length); err != nil {
 		return err
 	}
 	// 写入路由ID
@@ -69,6 +94,12 @@ func (m *TCPMessage) pack(w io.Writer) error {
 	if err := binary.Write(w, binary.BigEndian, m.messageID); err != nil {
 		return err
 	}
+	// 写入链路上下文
+	if m.trace != nil {
+		if _, err := w.Write(m.trace); err != nil {
+			return err
+		}
+	}
 	// 写入消息体
 	if err := binary.Write(w, binary.BigEndian, m.body); err != nil {
 		return err
@@ -101,3 +132,17 @@ func (m *TCPMessage) Write(body []byte, messageID int32, routeID int32) error {
 	m.length = int32(len(body))
 	return nil
 }
+
+// TraceContext 消息携带的链路上下文，未携带时为nil
+func (m *TCPMessage) TraceContext() []byte {
+	return m.trace
+}
+
+// SetTraceContext 设置随消息发送的链路上下文，nil时清除
+func (m *TCPMessage) SetTraceContext(trace []byte) error {
+	if trace != nil && len(trace) != TraceSize {
+		return ErrorTraceContext
+	}
+	m.trace = trace
+	return nil
+}
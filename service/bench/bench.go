@@ -0,0 +1,117 @@
+package bench
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/routermanage"
+	"github.com/chen102/ggbond/conn/server"
+	"github.com/chen102/ggbond/service/hook"
+)
+
+const (
+	ECHO          = 30 //原样回复消息体
+	BROADCAST     = 31 //加入压测房间并向房间内其他连接推送消息体，推送完成后回复发送者
+	BROADCASTPUSH = 32 //广播推送，消息ID为0，不会与请求的回复混淆
+)
+
+var ErrorBench = errors.New("bench service error")
+
+// BenchService 压测服务，只在压测时注册
+// 广播以BROADCASTPUSH推送给其他成员，发送者只收到BROADCAST回复，回复体为推送的接收者数(4字节 大端序)
+type BenchService struct {
+	server.ITCPConnManage
+	group server.IConnGroupMagage
+	room  *hook.Room
+}
+
+// NewBenchService 初始化压测服务
+// connmanager:连接管理器 group:分组管理器，压测房间创建在其中
+func NewBenchService(connmanager server.ITCPConnManage, group server.IConnGroupMagage) *BenchService {
+	room := &hook.Room{RommID: -1, RoomName: "bench"}
+	_ = group.AddGroup(room)
+	return &BenchService{
+		ITCPConnManage: connmanager,
+		group:          group,
+		room:           room,
+	}
+}
+
+// 路由装载器
+func (s *BenchService) Handles() map[int32]routermanage.RouterHandle {
+	return map[int32]routermanage.RouterHandle{
+		ECHO:      s.Echo(),
+		BROADCAST: s.Broadcast(),
+	}
+}
+
+func (s *BenchService) Echo() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		conn, err := s.FindConn(connid)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrorBench, err)
+		}
+		msg := connect.NewMessage("tcp")
+		if err := msg.Write(parameter, msgid, ECHO); err != nil {
+			return fmt.Errorf("%w: %w", ErrorBench, err)
+		}
+		return conn.SendMessage(msg)
+	}
+}
+
+func (s *BenchService) Broadcast() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		sender, err := s.FindConn(connid)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrorBench, err)
+		}
+		if err := s.group.AddConnToGroup(s.room, connid); err != nil {
+			return fmt.Errorf("%w: %w", ErrorBench, err)
+		}
+		members, err := s.group.Group(s.room)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrorBench, err)
+		}
+		push := connect.NewMessage("tcp")
+		if err := push.Write(parameter, 0, BROADCASTPUSH); err != nil {
+			return fmt.Errorf("%w: %w", ErrorBench, err)
+		}
+		var (
+			sent   uint32
+			failed int
+			first  error
+		)
+		for id := range members {
+			if id == connid {
+				continue
+			}
+			conn, err := s.FindConn(id)
+			if err != nil {
+				//连接已断开
+				_ = s.group.RemoveConnFromGroup(s.room, id)
+				continue
+			}
+			//慢接收者的发送队列满时跳过，不阻塞其他成员
+			if err := conn.SendMessage(push); err != nil {
+				if failed++; first == nil {
+					first = err
+				}
+				continue
+			}
+			sent++
+		}
+		ack := connect.NewMessage("tcp")
+		if err := ack.Write(binary.BigEndian.AppendUint32(nil, sent), msgid, BROADCAST); err != nil {
+			return fmt.Errorf("%w: %w", ErrorBench, err)
+		}
+		if err := sender.SendMessage(ack); err != nil {
+			return fmt.Errorf("%w: %w", ErrorBench, err)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%w: %d of %d receivers failed: %w", ErrorBench, failed, len(members), first)
+		}
+		return nil
+	}
+}
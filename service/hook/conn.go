@@ -1,16 +1,15 @@
 package hook
 
 import (
-	"fmt"
-
 	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/logger"
 )
 
 type ConnHook struct {
 }
 
 func (c *ConnHook) AfterConn(conn connect.ITCPConn) error {
-	fmt.Println("连接成功")
+	logger.L().Debug("连接成功", "conn", conn.ConnID())
 	// time.Sleep(10 * time.Second)
 	return nil
 }
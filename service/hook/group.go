@@ -1,5 +1,7 @@
 package hook
 
+import "github.com/chen102/ggbond/conn/actor"
+
 type Room struct {
 	RommID   int32
 	RoomName string
@@ -12,3 +14,8 @@ func (g *Room) ID() int32 {
 func (g *Room) Name() string {
 	return g.RoomName
 }
+
+// ActorID 房间对应的实体
+func (g *Room) ActorID() actor.ActorID {
+	return actor.ActorID{Kind: actor.ROOM, ID: int64(g.RommID)}
+}
@@ -0,0 +1,480 @@
+package match
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/logger"
+	"github.com/chen102/ggbond/conn/routermanage"
+	"github.com/chen102/ggbond/conn/server"
+	"github.com/chen102/ggbond/service/hook"
+)
+
+const (
+	ENQUEUE = 100 //加入匹配队列
+	CANCEL  = 101 //取消匹配
+	STATUS  = 102 //查询匹配状态
+	MATCHED = 103 //匹配成功推送
+	LEAVE   = 104 //离开匹配房间
+)
+
+var (
+	ErrorMatch       = errors.New("match service error")
+	ErrorInQueue     = errors.New("already in queue")
+	ErrorNotInQueue  = errors.New("not in queue")
+	ErrorTicketParam = errors.New("ticket parameter is not valid")
+	ErrorNotInRoom   = errors.New("not in match room")
+)
+
+// Ticket 匹配票据
+type Ticket struct {
+	ConnID      int64     `json:"-"`
+	Rating      int32     `json:"rating"`
+	Region      string    `json:"region"`
+	Mode        string    `json:"mode"`
+	EnqueueTime time.Time `json:"-"`
+}
+
+// Status 匹配状态
+type Status struct {
+	Queued   bool  `json:"queued"`
+	Position int   `json:"position"`
+	Wait     int64 `json:"wait"` //已等待秒数
+	Queue    int   `json:"queue"`
+}
+
+// Matched 匹配成功推送内容
+type Matched struct {
+	RoomID  int32   `json:"room"`
+	Mode    string  `json:"mode"`
+	Members []int64 `json:"members"`
+}
+
+// MatchService 匹配服务
+// 匹配成功后创建分组，分组成员即本局玩家，最后一名成员离开或断开时移除分组
+type MatchService struct {
+	server.ITCPConnManage
+	group    server.IConnGroupMagage
+	mu       sync.Mutex
+	queue    []*Ticket //按入队时间排序
+	tickets  map[int64]*Ticket
+	rooms    map[int32]*matchRoom         //本服务创建且未移除的房间
+	joined   map[int64]map[int32]struct{} //连接所在的匹配房间
+	rule     Rule
+	teamsize int
+	interval time.Duration
+	roomid   int32
+}
+
+// NewMatchService 初始化匹配服务
+// connmanager:连接管理器 group:分组管理器，匹配成功的房间创建在其中
+func NewMatchService(connmanager server.ITCPConnManage, group server.IConnGroupMagage, opt ...MatchOption) *MatchService {
+	var options matchoptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			panic(fmt.Errorf("apply option error:%w", err))
+		}
+	}
+	s := &MatchService{
+		ITCPConnManage: connmanager,
+		group:          group,
+		tickets:        make(map[int64]*Ticket),
+		rooms:          make(map[int32]*matchRoom),
+		joined:         make(map[int64]map[int32]struct{}),
+		rule:           DefaultRule(),
+		teamsize:       2,
+		interval:       time.Second,
+		roomid:         100000,
+	}
+	if options.rule != nil {
+		s.rule = options.rule
+	}
+	if options.teamsize != nil {
+		s.teamsize = *options.teamsize
+	}
+	if options.interval != nil {
+		s.interval = *options.interval
+	}
+	if options.roombase != nil {
+		s.roomid = *options.roombase
+	}
+	//房间被其他途径移除时不再跟踪
+	group.OnRemoveGroup(func(g connmanage.GroupHook) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r, ok := s.rooms[g.ID()]; ok && r.Room == g {
+			s.forget(r)
+		}
+	})
+	return s
+}
+
+// ConnHook 连接钩子，连接关闭时移出匹配队列并离开所在的匹配房间
+func (s *MatchService) ConnHook() connect.Hook {
+	return matchHook{s: s}
+}
+
+type matchHook struct {
+	connect.NopHook
+	s *MatchService
+}
+
+func (h matchHook) OnClose(conn connect.ITCPConn, reason connect.CloseReason, err error) {
+	_ = h.s.Remove(conn.ConnID())
+	for _, id := range h.s.Rooms(conn.ConnID()) {
+		if err := h.s.Leave(id, conn.ConnID()); err != nil && !errors.Is(err, ErrorNotInRoom) {
+			logger.L().Warn("match leave room error", "conn", conn.ConnID(), "room", id, "error", err)
+		}
+	}
+}
+
+// 路由装载器
+func (s *MatchService) Handles() map[int32]routermanage.RouterHandle {
+	return map[int32]routermanage.RouterHandle{
+		ENQUEUE: s.Enqueue(),
+		CANCEL:  s.Cancel(),
+		STATUS:  s.Status(),
+		LEAVE:   s.LeaveRoom(),
+	}
+}
+
+// Enqueue 加入匹配队列
+// 消息体为json:{"rating":1500,"region":"cn","mode":"5v5"}
+func (s *MatchService) Enqueue() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		t := &Ticket{}
+		if err := json.Unmarshal(parameter, t); err != nil {
+			return fmt.Errorf("ENQUEUE Router Error:%w,RouterId:%d", ErrorTicketParam, ENQUEUE)
+		}
+		t.ConnID = connid
+		t.EnqueueTime = time.Now()
+		if err := s.Add(t); err != nil {
+			return fmt.Errorf("ENQUEUE Router Error:%w,RouterId:%d", err, ENQUEUE)
+		}
+		return s.reply(connid, msgid, ENQUEUE, []byte("ok"))
+	}
+}
+
+// Cancel 取消匹配
+func (s *MatchService) Cancel() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		if err := s.Remove(connid); err != nil {
+			return fmt.Errorf("CANCEL Router Error:%w,RouterId:%d", err, CANCEL)
+		}
+		return s.reply(connid, msgid, CANCEL, []byte("ok"))
+	}
+}
+
+// Status 查询匹配状态
+func (s *MatchService) Status() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		body, err := json.Marshal(s.QueueStatus(connid))
+		if err != nil {
+			return fmt.Errorf("STATUS Router Error:%w,RouterId:%d", err, STATUS)
+		}
+		return s.reply(connid, msgid, STATUS, body)
+	}
+}
+
+// LeaveRoom 离开匹配房间
+// 消息体为房间ID的十进制字符串
+func (s *MatchService) LeaveRoom() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		id, err := strconv.ParseInt(string(parameter), 10, 32)
+		if err != nil {
+			return fmt.Errorf("LEAVE Router Error:%w,RouterId:%d", err, LEAVE)
+		}
+		if err := s.Leave(int32(id), connid); err != nil {
+			return fmt.Errorf("LEAVE Router Error:%w,RouterId:%d", err, LEAVE)
+		}
+		return s.reply(connid, msgid, LEAVE, []byte("ok"))
+	}
+}
+
+// Add 加入队列
+func (s *MatchService) Add(t *Ticket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tickets[t.ConnID]; ok {
+		return fmt.Errorf("%w: %w", ErrorMatch, ErrorInQueue)
+	}
+	s.tickets[t.ConnID] = t
+	s.queue = append(s.queue, t)
+	return nil
+}
+
+// Remove 移出队列
+func (s *MatchService) Remove(connid int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tickets[connid]; !ok {
+		return fmt.Errorf("%w: %w", ErrorMatch, ErrorNotInQueue)
+	}
+	s.remove(connid)
+	return nil
+}
+
+// QueueStatus 获取连接的匹配状态
+func (s *MatchService) QueueStatus(connid int64) Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := Status{Queue: len(s.queue)}
+	for i, t := range s.queue {
+		if t.ConnID == connid {
+			status.Queued = true
+			status.Position = i + 1
+			status.Wait = int64(time.Since(t.EnqueueTime) / time.Second)
+			break
+		}
+	}
+	return status
+}
+
+// Run 启动匹配循环，阻塞直到ctx结束
+func (s *MatchService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, members := range s.match() {
+				if err := s.createRoom(members); err != nil {
+					logger.L().Warn("match create room error", "error", err)
+				}
+			}
+		case <-ctx.Done():
+			logger.L().Info("match service done")
+			return
+		}
+	}
+}
+
+// 按入队顺序，为最早的玩家贪心挑选满足规则的候选人
+func (s *MatchService) match() [][]*Ticket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	//清理已断开的连接
+	var closed []int64
+	for _, t := range s.queue {
+		if _, err := s.FindConn(t.ConnID); err != nil {
+			closed = append(closed, t.ConnID)
+		}
+	}
+	for _, id := range closed {
+		s.remove(id)
+	}
+	var matched [][]*Ticket
+	used := make(map[int64]struct{})
+	for i, a := range s.queue {
+		if _, ok := used[a.ConnID]; ok {
+			continue
+		}
+		members := []*Ticket{a}
+		for _, b := range s.queue[i+1:] {
+			if _, ok := used[b.ConnID]; ok {
+				continue
+			}
+			if s.accept(members, b, now) {
+				members = append(members, b)
+				if len(members) == s.teamsize {
+					break
+				}
+			}
+		}
+		if len(members) < s.teamsize {
+			continue
+		}
+		for _, t := range members {
+			used[t.ConnID] = struct{}{}
+		}
+		matched = append(matched, members)
+	}
+	for id := range used {
+		s.remove(id)
+	}
+	return matched
+}
+
+// 候选人需与已选中的每个人都满足规则，等待时长取两人中较长者
+func (s *MatchService) accept(members []*Ticket, b *Ticket, now time.Time) bool {
+	for _, a := range members {
+		wait := now.Sub(a.EnqueueTime)
+		if w := now.Sub(b.EnqueueTime); w > wait {
+			wait = w
+		}
+		if !s.rule.Match(a, b, wait) {
+			return false
+		}
+	}
+	return true
+}
+
+// 放回队列并保持按入队时间排序，期间已重新入队的连接不再放回
+func (s *MatchService) requeue(tickets []*Ticket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tickets {
+		if _, ok := s.tickets[t.ConnID]; ok {
+			continue
+		}
+		i := sort.Search(len(s.queue), func(i int) bool { return s.queue[i].EnqueueTime.After(t.EnqueueTime) })
+		s.queue = append(s.queue, nil)
+		copy(s.queue[i+1:], s.queue[i:])
+		s.queue[i] = t
+		s.tickets[t.ConnID] = t
+	}
+}
+
+func (s *MatchService) remove(connid int64) {
+	delete(s.tickets, connid)
+	for i, t := range s.queue {
+		if t.ConnID == connid {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// Rooms 获取连接所在的匹配房间ID
+func (s *MatchService) Rooms(connid int64) []int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]int32, 0, len(s.joined[connid]))
+	for id := range s.joined[connid] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Leave 离开匹配房间，最后一名成员离开时移除房间
+func (s *MatchService) Leave(roomid int32, connid int64) error {
+	s.mu.Lock()
+	r, ok := s.rooms[roomid]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %w", ErrorMatch, ErrorNotInRoom)
+	}
+	if _, ok := r.members[connid]; !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %w", ErrorMatch, ErrorNotInRoom)
+	}
+	s.leave(r, connid)
+	empty := len(r.members) == 0
+	if empty {
+		s.forget(r)
+	}
+	s.mu.Unlock()
+	//分组回调可能再次进入本服务，在锁外操作分组
+	if err := s.group.RemoveConnFromGroup(r.Room, connid); err != nil {
+		return fmt.Errorf("%w: %w", ErrorMatch, err)
+	}
+	if empty {
+		if err := s.group.RemoveGroup(r.Room); err != nil {
+			return fmt.Errorf("%w: %w", ErrorMatch, err)
+		}
+	}
+	return nil
+}
+
+// 匹配房间及仍在房间内的成员
+type matchRoom struct {
+	*hook.Room
+	members map[int64]struct{}
+}
+
+func (s *MatchService) leave(r *matchRoom, connid int64) {
+	delete(r.members, connid)
+	delete(s.joined[connid], r.RommID)
+	if len(s.joined[connid]) == 0 {
+		delete(s.joined, connid)
+	}
+}
+
+// 不再跟踪房间，成员的房间索引一并清除
+func (s *MatchService) forget(r *matchRoom) {
+	for connid := range r.members {
+		s.leave(r, connid)
+	}
+	if s.rooms[r.RommID] == r {
+		delete(s.rooms, r.RommID)
+	}
+}
+
+// 创建房间并通知所有成员
+// 有成员已断开时不创建房间，其余成员按原入队时间放回队列
+func (s *MatchService) createRoom(members []*Ticket) error {
+	var alive []*Ticket
+	for _, t := range members {
+		if _, err := s.FindConn(t.ConnID); err == nil {
+			alive = append(alive, t)
+		}
+	}
+	if len(alive) < len(members) {
+		s.requeue(alive)
+		return nil
+	}
+	s.mu.Lock()
+	s.roomid++
+	id := s.roomid
+	s.mu.Unlock()
+	room := &hook.Room{RommID: id, RoomName: "match-" + strconv.Itoa(int(id))}
+	if err := s.group.AddGroup(room); err != nil {
+		return fmt.Errorf("%w: %w", ErrorMatch, err)
+	}
+	matched := Matched{RoomID: id, Mode: members[0].Mode}
+	r := &matchRoom{Room: room, members: make(map[int64]struct{}, len(members))}
+	for _, t := range members {
+		if err := s.group.AddConnToGroup(room, t.ConnID); err != nil {
+			_ = s.group.RemoveGroup(room)
+			return fmt.Errorf("%w: %w", ErrorMatch, err)
+		}
+		r.members[t.ConnID] = struct{}{}
+		matched.Members = append(matched.Members, t.ConnID)
+	}
+	s.mu.Lock()
+	s.rooms[id] = r
+	for connid := range r.members {
+		if s.joined[connid] == nil {
+			s.joined[connid] = make(map[int32]struct{})
+		}
+		s.joined[connid][id] = struct{}{}
+	}
+	s.mu.Unlock()
+	//成员可能在登记前断开，此时关闭钩子找不到该房间，补做离开
+	for connid := range r.members {
+		if _, err := s.FindConn(connid); err != nil {
+			_ = s.Leave(id, connid)
+		}
+	}
+	body, err := json.Marshal(matched)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorMatch, err)
+	}
+	for _, t := range members {
+		if err := s.reply(t.ConnID, server.GenerateMsgID(), MATCHED, body); err != nil {
+			logger.L().Warn("match notify error", "conn", t.ConnID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *MatchService) reply(connid int64, msgid, routeid int32, body []byte) error {
+	conn, err := s.FindConn(connid)
+	if err != nil {
+		return err
+	}
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write(body, msgid, routeid); err != nil {
+		return err
+	}
+	return conn.SendMessage(msg)
+}
@@ -0,0 +1,174 @@
+package match
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/server"
+	"github.com/chen102/ggbond/conn/store"
+	"github.com/chen102/ggbond/service/hook"
+)
+
+func newTestService(t *testing.T, connids ...int64) (*MatchService, server.IConnGroupMagage, map[int64]connect.ITCPConn) {
+	t.Helper()
+	connmanager := server.NewConnManage("tcp", store.NewTCPShardMap(8), connect.NopHook{})
+	group := server.NewConnGroup()
+	conns := make(map[int64]connect.ITCPConn)
+	for _, id := range connids {
+		a, b := net.Pipe()
+		t.Cleanup(func() {
+			a.Close()
+			b.Close()
+		})
+		conn := connect.NewTCPConn(a, id, "tcp")
+		if err := connmanager.AddConn(conn); err != nil {
+			t.Fatal(err)
+		}
+		conns[id] = conn
+	}
+	return NewMatchService(connmanager, group), group, conns
+}
+
+// 入队并完成一轮匹配，返回创建的房间
+func matchRoomOf(t *testing.T, s *MatchService, group server.IConnGroupMagage, connids ...int64) *hook.Room {
+	t.Helper()
+	for _, id := range connids {
+		if err := s.Add(&Ticket{ConnID: id, Rating: 1500, Region: "cn", Mode: "1v1", EnqueueTime: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	matched := s.match()
+	if len(matched) != 1 {
+		t.Fatalf("matched %d rooms", len(matched))
+	}
+	if err := s.createRoom(matched[0]); err != nil {
+		t.Fatal(err)
+	}
+	rooms := s.Rooms(connids[0])
+	if len(rooms) != 1 {
+		t.Fatalf("conn in rooms %v", rooms)
+	}
+	for _, g := range group.Groups() {
+		if g.ID() == rooms[0] {
+			return g.(*hook.Room)
+		}
+	}
+	t.Fatalf("room %d not in group manager", rooms[0])
+	return nil
+}
+
+func groupExists(group server.IConnGroupMagage, room *hook.Room) bool {
+	_, err := group.Group(room)
+	return err == nil
+}
+
+func TestLeaveRemovesEmptyRoom(t *testing.T) {
+	s, group, _ := newTestService(t, 1, 2)
+	room := matchRoomOf(t, s, group, 1, 2)
+	if err := s.Leave(room.RommID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !groupExists(group, room) {
+		t.Fatal("room removed while a member remains")
+	}
+	if err := s.Leave(room.RommID, 1); !errors.Is(err, ErrorNotInRoom) {
+		t.Fatalf("leave twice: %v", err)
+	}
+	if err := s.Leave(room.RommID, 2); err != nil {
+		t.Fatal(err)
+	}
+	if groupExists(group, room) {
+		t.Fatal("empty room not removed")
+	}
+	if rooms := s.Rooms(2); len(rooms) != 0 {
+		t.Fatalf("conn still in rooms %v", rooms)
+	}
+}
+
+func TestCloseRemovesEmptyRoom(t *testing.T) {
+	s, group, conns := newTestService(t, 1, 2)
+	room := matchRoomOf(t, s, group, 1, 2)
+	h := s.ConnHook().(connect.CloseHook)
+	//与服务器关闭连接的顺序一致，先从管理器移除再调用钩子
+	for _, id := range []int64{1, 2} {
+		if err := s.RemoveConn(conns[id], nil); err != nil {
+			t.Fatal(err)
+		}
+		h.OnClose(conns[id], connect.CloseNormal, nil)
+		if exists := groupExists(group, room); exists != (id == 1) {
+			t.Fatalf("after conn %d closed room exists %v", id, exists)
+		}
+	}
+}
+
+func TestRoomRemovedElsewhere(t *testing.T) {
+	s, group, _ := newTestService(t, 1, 2)
+	room := matchRoomOf(t, s, group, 1, 2)
+	if err := group.RemoveGroup(room); err != nil {
+		t.Fatal(err)
+	}
+	if rooms := s.Rooms(1); len(rooms) != 0 {
+		t.Fatalf("conn still in rooms %v", rooms)
+	}
+	if err := s.Leave(room.RommID, 1); !errors.Is(err, ErrorNotInRoom) {
+		t.Fatalf("leave removed room: %v", err)
+	}
+}
+
+func TestDisconnectedMemberRequeuesOthers(t *testing.T) {
+	s, group, conns := newTestService(t, 1, 2, 3)
+	now := time.Now()
+	for i, id := range []int64{1, 2} {
+		if err := s.Add(&Ticket{ConnID: id, Rating: 1500, Region: "cn", Mode: "1v1", EnqueueTime: now.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	matched := s.match()
+	if len(matched) != 1 {
+		t.Fatalf("matched %d rooms", len(matched))
+	}
+	//匹配完成到创建房间之间成员断开，期间有新玩家入队
+	if err := s.RemoveConn(conns[2], nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(&Ticket{ConnID: 3, Rating: 3000, Region: "us", Mode: "5v5", EnqueueTime: now.Add(5 * time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.createRoom(matched[0]); err != nil {
+		t.Fatal(err)
+	}
+	if groups := group.Groups(); len(groups) != 0 {
+		t.Fatalf("room created with a disconnected member: %v", groups)
+	}
+	//按原入队时间放回队首
+	if status := s.QueueStatus(1); !status.Queued || status.Position != 1 || status.Queue != 2 {
+		t.Fatalf("requeued status %+v", status)
+	}
+	if status := s.QueueStatus(2); status.Queued {
+		t.Fatalf("disconnected member requeued %+v", status)
+	}
+}
+
+func TestRatingWindowWidensWithWait(t *testing.T) {
+	s, _, _ := newTestService(t, 1, 2)
+	now := time.Now()
+	a := &Ticket{ConnID: 1, Rating: 1500, Region: "cn", Mode: "1v1", EnqueueTime: now}
+	b := &Ticket{ConnID: 2, Rating: 1650, Region: "cn", Mode: "1v1", EnqueueTime: now}
+	for _, tk := range []*Ticket{a, b} {
+		if err := s.Add(tk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//分差150超出初始窗口100
+	if matched := s.match(); len(matched) != 0 {
+		t.Fatalf("matched outside rating window: %v", matched)
+	}
+	//等待5秒后窗口放宽到150
+	a.EnqueueTime = now.Add(-5 * time.Second)
+	if matched := s.match(); len(matched) != 1 {
+		t.Fatal("not matched after the window widened")
+	}
+}
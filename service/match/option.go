@@ -0,0 +1,56 @@
+package match
+
+import (
+	"errors"
+	"time"
+)
+
+// MatchOption 匹配服务选项
+type MatchOption func(options *matchoptions) error
+type matchoptions struct {
+	rule     Rule
+	teamsize *int
+	interval *time.Duration
+	roombase *int32
+}
+
+// rule:匹配规则
+func WithRule(rule Rule) MatchOption {
+	return func(options *matchoptions) error {
+		if rule == nil {
+			return errors.New("rule is nil")
+		}
+		options.rule = rule
+		return nil
+	}
+}
+
+// teamsize:每局人数
+func WithTeamSize(teamsize int) MatchOption {
+	return func(options *matchoptions) error {
+		if teamsize < 2 {
+			return errors.New("teamsize is not valid")
+		}
+		options.teamsize = &teamsize
+		return nil
+	}
+}
+
+// interval:匹配周期
+func WithInterval(interval time.Duration) MatchOption {
+	return func(options *matchoptions) error {
+		if interval <= 0 {
+			return errors.New("interval is not valid")
+		}
+		options.interval = &interval
+		return nil
+	}
+}
+
+// roombase:匹配房间ID起始值，避免与业务房间冲突
+func WithRoomBase(roombase int32) MatchOption {
+	return func(options *matchoptions) error {
+		options.roombase = &roombase
+		return nil
+	}
+}
@@ -0,0 +1,70 @@
+package match
+
+import "time"
+
+// Rule 匹配规则
+// a:较早入队的玩家 b:候选玩家 wait:a已等待时长，用于放宽匹配窗口
+type Rule interface {
+	Match(a, b *Ticket, wait time.Duration) bool
+}
+
+// RuleFunc 函数形式的匹配规则
+type RuleFunc func(a, b *Ticket, wait time.Duration) bool
+
+func (f RuleFunc) Match(a, b *Ticket, wait time.Duration) bool {
+	return f(a, b, wait)
+}
+
+// SameMode 游戏模式必须一致
+func SameMode() Rule {
+	return RuleFunc(func(a, b *Ticket, wait time.Duration) bool {
+		return a.Mode == b.Mode
+	})
+}
+
+// SameRegion 区域必须一致
+// widenAfter:等待超过该时长后允许跨区匹配，0表示永不跨区
+func SameRegion(widenAfter time.Duration) Rule {
+	return RuleFunc(func(a, b *Ticket, wait time.Duration) bool {
+		if widenAfter > 0 && wait >= widenAfter {
+			return true
+		}
+		return a.Region == b.Region
+	})
+}
+
+// RatingWindow 分差窗口
+// 初始窗口base，每等待interval扩大step，最大不超过max
+func RatingWindow(base, step int32, interval time.Duration, max int32) Rule {
+	return RuleFunc(func(a, b *Ticket, wait time.Duration) bool {
+		window := base
+		if interval > 0 {
+			window += step * int32(wait/interval)
+		}
+		if window > max {
+			window = max
+		}
+		diff := a.Rating - b.Rating
+		if diff < 0 {
+			diff = -diff
+		}
+		return diff <= window
+	})
+}
+
+// All 组合规则，全部满足才匹配
+func All(rules ...Rule) Rule {
+	return RuleFunc(func(a, b *Ticket, wait time.Duration) bool {
+		for _, r := range rules {
+			if !r.Match(a, b, wait) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// DefaultRule 默认规则:同模式，同区域(等待30秒后跨区)，分差100起每5秒放宽50，最大500
+func DefaultRule() Rule {
+	return All(SameMode(), SameRegion(30*time.Second), RatingWindow(100, 50, 5*time.Second, 500))
+}
@@ -0,0 +1,73 @@
+package match
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRatingWindow(t *testing.T) {
+	rule := RatingWindow(100, 50, 5*time.Second, 300)
+	for _, c := range []struct {
+		a, b  int32
+		wait  time.Duration
+		match bool
+	}{
+		{1500, 1600, 0, true},
+		{1600, 1500, 0, true},
+		{1500, 1601, 0, false},
+		{1500, 1650, 4 * time.Second, false},
+		{1500, 1650, 5 * time.Second, true},
+		{1500, 1700, 10 * time.Second, true},
+		{1500, 1800, time.Minute, true},
+		//窗口不超过最大值
+		{1500, 1801, time.Hour, false},
+	} {
+		a, b := &Ticket{Rating: c.a}, &Ticket{Rating: c.b}
+		if got := rule.Match(a, b, c.wait); got != c.match {
+			t.Fatalf("rating %d vs %d after %s: %v, want %v", c.a, c.b, c.wait, got, c.match)
+		}
+	}
+	//放宽周期为0时窗口固定
+	if RatingWindow(100, 50, 0, 300).Match(&Ticket{Rating: 1500}, &Ticket{Rating: 1650}, time.Hour) {
+		t.Fatal("window widened without interval")
+	}
+}
+
+func TestSameRegion(t *testing.T) {
+	cn, us := &Ticket{Region: "cn"}, &Ticket{Region: "us"}
+	rule := SameRegion(30 * time.Second)
+	if !rule.Match(cn, &Ticket{Region: "cn"}, 0) {
+		t.Fatal("same region not matched")
+	}
+	if rule.Match(cn, us, 29*time.Second) {
+		t.Fatal("cross region matched before widening")
+	}
+	if !rule.Match(cn, us, 30*time.Second) {
+		t.Fatal("cross region not matched after widening")
+	}
+	if SameRegion(0).Match(cn, us, time.Hour) {
+		t.Fatal("cross region matched with widening disabled")
+	}
+}
+
+func TestDefaultRule(t *testing.T) {
+	rule := DefaultRule()
+	a := &Ticket{Rating: 1500, Region: "cn", Mode: "5v5"}
+	for _, c := range []struct {
+		b     Ticket
+		wait  time.Duration
+		match bool
+	}{
+		{Ticket{Rating: 1550, Region: "cn", Mode: "5v5"}, 0, true},
+		{Ticket{Rating: 1550, Region: "cn", Mode: "1v1"}, time.Hour, false},
+		{Ticket{Rating: 1550, Region: "us", Mode: "5v5"}, 10 * time.Second, false},
+		{Ticket{Rating: 1550, Region: "us", Mode: "5v5"}, 30 * time.Second, true},
+		{Ticket{Rating: 1900, Region: "cn", Mode: "5v5"}, 35 * time.Second, true},
+		{Ticket{Rating: 2100, Region: "cn", Mode: "5v5"}, time.Hour, false},
+	} {
+		b := c.b
+		if got := rule.Match(a, &b, c.wait); got != c.match {
+			t.Fatalf("%+v after %s: %v, want %v", c.b, c.wait, got, c.match)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package router
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/chen102/ggbond/conn/actor"
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/routermanage"
+	"github.com/chen102/ggbond/conn/server"
+)
+
+const (
+	ROOMENTER = 21 //加入房间并进入AOI
+	ROOMMOVE  = 22 //在房间AOI中移动
+	ROOMLEAVE = 23 //离开AOI并退出房间
+)
+
+var ErrorAOIParam = errors.New("aoi parameter is not valid")
+
+// AOIService 房间AOI服务，客户端进入、移动、离开房间地图
+// 进入、离开视野的事件由AOIHandle推送
+type AOIService struct {
+	server.ITCPConnManage
+	group server.IConnGroupMagage
+	room  connmanage.GroupHook
+}
+
+// NewAOIService 初始化AOI服务
+// group:分组管理器 room:已绑定AOI的房间
+func NewAOIService(connmanager server.ITCPConnManage, group server.IConnGroupMagage, room connmanage.GroupHook) *AOIService {
+	return &AOIService{
+		ITCPConnManage: connmanager,
+		group:          group,
+		room:           room,
+	}
+}
+
+// 路由装载器
+func (s *AOIService) Handles() map[int32]routermanage.RouterHandle {
+	return map[int32]routermanage.RouterHandle{
+		ROOMENTER: s.Enter(),
+		ROOMLEAVE: s.Leave(),
+	}
+}
+
+// 实体路由装载器，经RegisterActorRoute投递到房间实体
+// 移动频繁且不回复，在房间协程中串行处理，与房间定时任务的顺序一致
+func (s *AOIService) ActorHandles() map[int32]actor.Handle {
+	move := s.Move()
+	return map[int32]actor.Handle{
+		ROOMMOVE: func(a *actor.Actor, msgid int32, connid int64, parameter []byte) error {
+			return move(msgid, connid, parameter)
+		},
+	}
+}
+
+// Enter 加入房间并进入AOI
+// 消息体:x、y、视野半径(各4字节float32) 大端序
+func (s *AOIService) Enter() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		v, err := floats(parameter, 3)
+		if err != nil || v[2] < 0 {
+			return fmt.Errorf("ROOMENTER Router Error:%w,RouterId:%d", ErrorAOIParam, ROOMENTER)
+		}
+		aoi, err := s.group.AOI(s.room)
+		if err != nil {
+			return fmt.Errorf("ROOMENTER Router Error:%w,RouterId:%d", err, ROOMENTER)
+		}
+		if err := s.group.AddConnToGroup(s.room, connid); err != nil {
+			return fmt.Errorf("ROOMENTER Router Error:%w,RouterId:%d", err, ROOMENTER)
+		}
+		if err := aoi.Enter(connid, v[0], v[1], v[2]); err != nil {
+			return fmt.Errorf("ROOMENTER Router Error:%w,RouterId:%d", err, ROOMENTER)
+		}
+		return s.reply(connid, msgid, ROOMENTER)
+	}
+}
+
+// Move 在房间AOI中移动
+// 消息体:x、y(各4字节float32) 大端序
+func (s *AOIService) Move() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		v, err := floats(parameter, 2)
+		if err != nil {
+			return fmt.Errorf("ROOMMOVE Router Error:%w,RouterId:%d", ErrorAOIParam, ROOMMOVE)
+		}
+		aoi, err := s.group.AOI(s.room)
+		if err != nil {
+			return fmt.Errorf("ROOMMOVE Router Error:%w,RouterId:%d", err, ROOMMOVE)
+		}
+		if err := aoi.Move(connid, v[0], v[1]); err != nil {
+			return fmt.Errorf("ROOMMOVE Router Error:%w,RouterId:%d", err, ROOMMOVE)
+		}
+		return nil
+	}
+}
+
+// Leave 离开AOI并退出房间，视野内的连接收到离开事件
+func (s *AOIService) Leave() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		if err := s.group.RemoveConnFromGroup(s.room, connid); err != nil {
+			return fmt.Errorf("ROOMLEAVE Router Error:%w,RouterId:%d", err, ROOMLEAVE)
+		}
+		return s.reply(connid, msgid, ROOMLEAVE)
+	}
+}
+
+func (s *AOIService) reply(connid int64, msgid, routeid int32) error {
+	conn, err := s.FindConn(connid)
+	if err != nil {
+		return err
+	}
+	msg := connect.NewMessage("tcp")
+	if err := msg.Write([]byte("ok"), msgid, routeid); err != nil {
+		return err
+	}
+	return conn.SendMessage(msg)
+}
+
+// 解析n个大端序float32，拒绝NaN与无穷大
+func floats(b []byte, n int) ([]float32, error) {
+	if len(b) != 4*n {
+		return nil, ErrorAOIParam
+	}
+	v := make([]float32, n)
+	for i := range v {
+		f := math.Float32frombits(binary.BigEndian.Uint32(b[4*i:]))
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return nil, ErrorAOIParam
+		}
+		v[i] = f
+	}
+	return v, nil
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chen102/ggbond/conn/actor"
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/routermanage"
+	"github.com/chen102/ggbond/conn/server"
+	"github.com/chen102/ggbond/conn/store"
+	"github.com/chen102/ggbond/service/hook"
+)
+
+func encodeFloats(v ...float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.BigEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+func TestAOIServiceRoutes(t *testing.T) {
+	connmanager := server.NewConnManage("tcp", store.NewTCPShardMap(8), connect.NopHook{})
+	group := server.NewConnGroup()
+	room := &hook.Room{RommID: 1, RoomName: "room"}
+	if err := group.AddGroup(room); err != nil {
+		t.Fatal(err)
+	}
+	aoi := connmanage.NewGridAOI(0, 0, 1000, 1000, 50)
+	//移动在房间实体协程中处理，事件需加锁记录
+	var mu sync.Mutex
+	var events []connmanage.AOIEvent
+	aoi.SetHandle(func(event connmanage.AOIEvent, watcher, entity int64, x, y float32) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+	takeEvents := func() []connmanage.AOIEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		res := events
+		events = nil
+		return res
+	}
+	if err := group.SetAOI(room, aoi); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{1, 2} {
+		a, b := net.Pipe()
+		defer a.Close()
+		defer b.Close()
+		if err := connmanager.AddConn(connect.NewTCPConn(a, id, "tcp")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewAOIService(connmanager, group, room)
+	routers := routermanage.NewTCPRouter(store.NewSyncMap[routermanage.RouterHandle]())
+	for id, handle := range s.Handles() {
+		if err := routers.RegisterRoute(id, handle); err != nil {
+			t.Fatal(err)
+		}
+	}
+	system := actor.NewSystem(8)
+	if _, err := system.Spawn(room.ActorID()); err != nil {
+		t.Fatal(err)
+	}
+	for id, handle := range s.ActorHandles() {
+		if err := routers.RegisterActorRoute(id, system, actor.Fixed(room.ActorID()), handle); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handle := func(routeid int32, msgid int32, connid int64, body []byte) error {
+		return routers.HandleMessage(routeid, connid, msgid, body)
+	}
+
+	if err := handle(ROOMENTER, 1, 1, encodeFloats(100, 100, 50)); err != nil {
+		t.Fatal(err)
+	}
+	if err := handle(ROOMENTER, 1, 2, encodeFloats(120, 100, 50)); err != nil {
+		t.Fatal(err)
+	}
+	if members, _ := group.Group(room); len(members) != 2 {
+		t.Fatalf("members %v", members)
+	}
+	if events := takeEvents(); len(events) != 2 || events[0] != connmanage.AOIENTER || events[1] != connmanage.AOIENTER {
+		t.Fatalf("enter events %v", events)
+	}
+	//移动投递到房间实体后立即返回
+	if err := handle(ROOMMOVE, 2, 2, encodeFloats(130, 100)); err != nil {
+		t.Fatal(err)
+	}
+	//邮箱按顺序执行，其后的任务执行时移动已处理完
+	done := make(chan struct{})
+	if err := system.Tell(room.ActorID(), func(*actor.Actor) { close(done) }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for room actor")
+	}
+	if x, _, err := aoi.Position(2); err != nil || x != 130 {
+		t.Fatalf("position %v %v", x, err)
+	}
+	if events := takeEvents(); len(events) != 1 || events[0] != connmanage.AOIMOVE {
+		t.Fatalf("move events %v", events)
+	}
+	if err := handle(ROOMLEAVE, 3, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if members, _ := group.Group(room); len(members) != 1 {
+		t.Fatalf("members after leave %v", members)
+	}
+	if events := takeEvents(); len(events) != 1 || events[0] != connmanage.AOILEAVE {
+		t.Fatalf("leave events %v", events)
+	}
+
+	for _, body := range [][]byte{nil, encodeFloats(1, 2), encodeFloats(1, 2, -1), encodeFloats(float32(math.NaN()), 0, 1)} {
+		if err := handle(ROOMENTER, 4, 2, body); !errors.Is(err, ErrorAOIParam) {
+			t.Fatalf("enter with %x: %v", body, err)
+		}
+	}
+	if err := s.Move()(5, 2, encodeFloats(1, 2)); !errors.Is(err, connmanage.ErrorAOIEntityNotFound) {
+		t.Fatalf("move after leave: %v", err)
+	}
+}
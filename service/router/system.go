@@ -1,10 +1,14 @@
 package router
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"strconv"
 
 	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/logger"
 	"github.com/chen102/ggbond/conn/routermanage"
 	"github.com/chen102/ggbond/conn/server"
 )
@@ -16,16 +20,18 @@ type SystemService struct {
 const (
 	PING           = 1
 	ACTIVESHUTDOWN = 10
+	DISCONNECT     = connect.DISCONNECT //断开通知，由服务端在关闭连接前推送
+	AOIEVENT       = 20
 )
 
-//初始化系统服务
+// 初始化系统服务
 func NewSystemService(connmanager server.ITCPConnManage) *SystemService {
 	return &SystemService{
 		connmanager,
 	}
 }
 
-//路由装载器
+// 路由装载器
 func (b *SystemService) Handles() map[int32]routermanage.RouterHandle {
 	return map[int32]routermanage.RouterHandle{
 		PING:           b.Ping(),
@@ -33,13 +39,13 @@ func (b *SystemService) Handles() map[int32]routermanage.RouterHandle {
 	}
 }
 func (b *SystemService) Ping() routermanage.RouterHandle {
-	return func(msgid, connid int32, parameter []byte) error {
+	return func(msgid int32, connid int64, parameter []byte) error {
 		conn, err := b.FindConn(connid)
 		if err != nil {
 			return fmt.Errorf("PING Router Error:%w,RouterId:%d", err, PING)
 		}
 		msg := connect.NewMessage("tcp")
-		if err := msg.Write([]byte(strconv.Itoa(int(msgid))+":PONG"), server.GenerateConnID(), PING); err != nil {
+		if err := msg.Write([]byte(strconv.Itoa(int(msgid))+":PONG"), msgid, PING); err != nil {
 			return fmt.Errorf("PING Router Error:%w,RouterId:%d", err, PING)
 		}
 		if err := conn.SendMessage(msg); err != nil {
@@ -50,13 +56,13 @@ func (b *SystemService) Ping() routermanage.RouterHandle {
 	}
 }
 func (b *SystemService) ActiveShutdown() routermanage.RouterHandle {
-	return func(msgid, connid int32, parameter []byte) error {
+	return func(msgid int32, connid int64, parameter []byte) error {
 		conn, err := b.FindConn(connid)
 		if err != nil {
 			return fmt.Errorf("ActiveShutdown Router Error:%w,RouterId:%d", err, ACTIVESHUTDOWN)
 		}
 		msg := connect.NewMessage("tcp")
-		if err := msg.Write([]byte("ok"), server.GenerateConnID(), ACTIVESHUTDOWN); err != nil {
+		if err := msg.Write([]byte("ok"), msgid, ACTIVESHUTDOWN); err != nil {
 			return fmt.Errorf("ActiveShutdown Router Error:%w,RouterId:%d", err, ACTIVESHUTDOWN)
 		}
 		if err := conn.SendMessage(msg); err != nil {
@@ -65,3 +71,26 @@ func (b *SystemService) ActiveShutdown() routermanage.RouterHandle {
 		return nil
 	}
 }
+
+// AOI事件推送
+// 消息体:事件类型(4字节)、实体ID(8字节)、x、y(各4字节) 大端序
+func (b *SystemService) AOIHandle() connmanage.AOIHandle {
+	return func(event connmanage.AOIEvent, watcher, entity int64, x, y float32) {
+		conn, err := b.FindConn(watcher)
+		if err != nil {
+			return
+		}
+		buf := bytes.NewBuffer(make([]byte, 0, 20))
+		for _, v := range []interface{}{int32(event), entity, x, y} {
+			_ = binary.Write(buf, binary.BigEndian, v)
+		}
+		msg := connect.NewMessage("tcp")
+		if err := msg.Write(buf.Bytes(), server.GenerateMsgID(), AOIEVENT); err != nil {
+			logger.L().Warn("AOIEVENT Router Error", "conn", conn.ConnID(), "error", err)
+			return
+		}
+		if err := conn.SendMessage(msg); err != nil {
+			logger.L().Warn("AOIEVENT Router Error", "conn", conn.ConnID(), "error", err)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/connmanage"
+	"github.com/chen102/ggbond/conn/logger"
+	"github.com/chen102/ggbond/conn/routermanage"
+	"github.com/chen102/ggbond/conn/server"
+	"github.com/chen102/ggbond/conn/store"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	RESUME = 2 //创建或恢复会话
+)
+
+// 会话相关的连接属性
+const (
+	SESSIONATTR = "session"
+	USERATTR    = "user"
+)
+
+var (
+	ErrorSession         = errors.New("session error")
+	ErrorNoSession       = errors.New("conn has no session")
+	ErrorSessionNotFound = errors.New("session not exists")
+	ErrorNoGroupStore    = errors.New("group store not set")
+)
+
+// UserBinder 用户目录，例如集群节点，绑定用户后可跨节点向用户发送消息
+type UserBinder interface {
+	BindUser(userid string, connid int64) error
+}
+
+// SessionService 会话服务
+// 连接属性按会话保存，客户端重连后携带会话ID即可恢复属性
+type SessionService struct {
+	server.ITCPConnManage
+	sessions   store.ISessionStore
+	users      store.IUserStore
+	serializer connect.Serializer
+	online     sync.Map //sessionID -> connID
+	binder     UserBinder
+	gmu        sync.Mutex //分组成员记录的读改写
+	groups     store.IGroupStore
+	group      server.IConnGroupMagage
+}
+
+// NewSessionService 初始化会话服务
+// sessions:会话属性存储 users:用户绑定存储 serializer:属性序列化器，为nil时使用json
+func NewSessionService(connmanager server.ITCPConnManage, sessions store.ISessionStore, users store.IUserStore, serializer connect.Serializer) *SessionService {
+	if serializer == nil {
+		serializer = connect.JSONSerializer{}
+	}
+	return &SessionService{
+		ITCPConnManage: connmanager,
+		sessions:       sessions,
+		users:          users,
+		serializer:     serializer,
+	}
+}
+
+// SetBinder 设置用户目录
+func (s *SessionService) SetBinder(binder UserBinder) {
+	s.binder = binder
+}
+
+// SetGroups 设置分组成员存储
+// 通过JoinGroup加入的分组按会话记录，会话恢复时重新加入，分组移除时删除记录
+func (s *SessionService) SetGroups(groups store.IGroupStore, group server.IConnGroupMagage) {
+	s.groups = groups
+	s.group = group
+	group.OnRemoveGroup(func(g connmanage.GroupHook) {
+		s.gmu.Lock()
+		defer s.gmu.Unlock()
+		if err := groups.Del(g.ID()); err != nil {
+			logger.L().Warn("session group delete error", "group", g.ID(), "error", err)
+		}
+	})
+}
+
+// ConnHook 连接钩子，连接关闭时保存会话并标记离线
+func (s *SessionService) ConnHook() connect.Hook {
+	return sessionHook{s: s}
+}
+
+type sessionHook struct {
+	connect.NopHook
+	s *SessionService
+}
+
+func (h sessionHook) OnClose(conn connect.ITCPConn, reason connect.CloseReason, err error) {
+	if err := h.s.Offline(conn); err != nil {
+		logger.L().Warn("session offline error", "conn", conn.ConnID(), "error", err)
+	}
+}
+
+// 路由装载器
+func (s *SessionService) Handles() map[int32]routermanage.RouterHandle {
+	return map[int32]routermanage.RouterHandle{
+		RESUME: s.Resume(),
+	}
+}
+
+// Resume 创建或恢复会话
+// 消息体为空时创建新会话，否则为要恢复的会话ID，回复会话ID
+func (s *SessionService) Resume() routermanage.RouterHandle {
+	return func(msgid int32, connid int64, parameter []byte) error {
+		conn, err := s.FindConn(connid)
+		if err != nil {
+			return fmt.Errorf("RESUME Router Error:%w,RouterId:%d", err, RESUME)
+		}
+		sessionid := string(parameter)
+		resumed := sessionid != ""
+		if !resumed {
+			sessionid = uuid.NewV4().String()
+		} else {
+			s.takeover(sessionid, connid)
+			if err := s.restore(conn, sessionid); err != nil {
+				return fmt.Errorf("RESUME Router Error:%w,RouterId:%d", err, RESUME)
+			}
+		}
+		conn.Attrs().Set(SESSIONATTR, sessionid)
+		s.online.Store(sessionid, connid)
+		if resumed {
+			s.rejoin(connid, sessionid)
+		}
+		if err := s.Save(connid); err != nil {
+			return fmt.Errorf("RESUME Router Error:%w,RouterId:%d", err, RESUME)
+		}
+		msg := connect.NewMessage("tcp")
+		if err := msg.Write([]byte(sessionid), msgid, RESUME); err != nil {
+			return fmt.Errorf("RESUME Router Error:%w,RouterId:%d", err, RESUME)
+		}
+		return conn.SendMessage(msg)
+	}
+}
+
+// Save 持久化连接属性
+func (s *SessionService) Save(connid int64) error {
+	conn, err := s.FindConn(connid)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	sessionid, ok := conn.Attrs().GetString(SESSIONATTR)
+	if !ok {
+		return fmt.Errorf("%w: %w", ErrorSession, ErrorNoSession)
+	}
+	data, err := conn.Attrs().Export(s.serializer)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	if _, err := s.sessions.Set(sessionid, data); err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	return nil
+}
+
+// Bind 绑定用户与连接所在会话，登录成功后调用
+func (s *SessionService) Bind(connid int64, userid string) error {
+	conn, err := s.FindConn(connid)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	sessionid, ok := conn.Attrs().GetString(SESSIONATTR)
+	if !ok {
+		return fmt.Errorf("%w: %w", ErrorSession, ErrorNoSession)
+	}
+	conn.Attrs().Set(USERATTR, userid)
+	if _, err := s.users.Set(userid, sessionid); err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	if s.binder != nil {
+		if err := s.binder.BindUser(userid, connid); err != nil {
+			return fmt.Errorf("%w: %w", ErrorSession, err)
+		}
+	}
+	return s.Save(connid)
+}
+
+// JoinGroup 连接加入分组，连接有会话时记录该会话为分组成员
+// 连接关闭时只退出分组，记录保留到LeaveGroup或分组移除
+func (s *SessionService) JoinGroup(connid int64, g connmanage.GroupHook) error {
+	if s.group == nil {
+		return fmt.Errorf("%w: %w", ErrorSession, ErrorNoGroupStore)
+	}
+	conn, err := s.FindConn(connid)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	if err := s.group.AddConnToGroup(g, connid); err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	sessionid, ok := conn.Attrs().GetString(SESSIONATTR)
+	if !ok {
+		return nil
+	}
+	return s.updateGroup(g.ID(), func(members []string) []string {
+		for _, id := range members {
+			if id == sessionid {
+				return members
+			}
+		}
+		return append(members, sessionid)
+	})
+}
+
+// LeaveGroup 连接退出分组，删除会话的成员记录
+func (s *SessionService) LeaveGroup(connid int64, g connmanage.GroupHook) error {
+	if s.group == nil {
+		return fmt.Errorf("%w: %w", ErrorSession, ErrorNoGroupStore)
+	}
+	if err := s.group.RemoveConnFromGroup(g, connid); err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	conn, err := s.FindConn(connid)
+	if err != nil {
+		return nil
+	}
+	sessionid, ok := conn.Attrs().GetString(SESSIONATTR)
+	if !ok {
+		return nil
+	}
+	return s.updateGroup(g.ID(), func(members []string) []string {
+		res := make([]string, 0, len(members))
+		for _, id := range members {
+			if id != sessionid {
+				res = append(res, id)
+			}
+		}
+		return res
+	})
+}
+
+// 修改分组成员记录，成员为空时删除记录
+func (s *SessionService) updateGroup(groupid int32, f func(members []string) []string) error {
+	s.gmu.Lock()
+	defer s.gmu.Unlock()
+	members, _ := s.groups.Get(groupid)
+	members = f(members)
+	var err error
+	if len(members) == 0 {
+		err = s.groups.Del(groupid)
+	} else {
+		_, err = s.groups.Set(groupid, members)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	return nil
+}
+
+// 会话恢复后重新加入记录的分组，分组已不存在时跳过
+func (s *SessionService) rejoin(connid int64, sessionid string) {
+	if s.group == nil {
+		return
+	}
+	for _, g := range s.group.Groups() {
+		s.gmu.Lock()
+		members, _ := s.groups.Get(g.ID())
+		s.gmu.Unlock()
+		for _, id := range members {
+			if id != sessionid {
+				continue
+			}
+			if err := s.group.AddConnToGroup(g, connid); err != nil {
+				logger.L().Warn("session rejoin group error", "conn", connid, "group", g.ID(), "error", err)
+			}
+			break
+		}
+	}
+}
+
+// 会话仍绑定在其他在线连接上时(例如客户端未察觉断线就重连)，保存其属性后将其踢下线
+// 一个会话只绑定一个连接，旧连接关闭时不再覆盖会话属性
+func (s *SessionService) takeover(sessionid string, connid int64) {
+	v, ok := s.online.Load(sessionid)
+	if !ok || v.(int64) == connid {
+		return
+	}
+	old, err := s.FindConn(v.(int64))
+	if err != nil {
+		return
+	}
+	if err := s.Save(old.ConnID()); err != nil {
+		logger.L().Warn("session save error", "conn", old.ConnID(), "error", err)
+	}
+	old.SignalClose(connect.NewCloseError(connect.CloseKicked, "session resumed on another connection", ErrorSession))
+}
+
+// UserConn 查找用户当前在线的连接
+func (s *SessionService) UserConn(userid string) (connect.ITCPConn, error) {
+	sessionid, err := s.users.Get(userid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	connid, ok := s.online.Load(sessionid)
+	if !ok {
+		return nil, fmt.Errorf("%w: %w", ErrorSession, ErrorSessionNotFound)
+	}
+	return s.FindConn(connid.(int64))
+}
+
+// Offline 连接断开时保存属性并标记会话离线，会话已绑定到其他连接时不保存
+func (s *SessionService) Offline(conn connect.ITCPConn) error {
+	sessionid, ok := conn.Attrs().GetString(SESSIONATTR)
+	if !ok {
+		return nil
+	}
+	//会话已在其他连接恢复时属性以新连接为准
+	if !s.online.CompareAndDelete(sessionid, conn.ConnID()) {
+		return nil
+	}
+	data, err := conn.Attrs().Export(s.serializer)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	if _, err := s.sessions.Set(sessionid, data); err != nil {
+		return fmt.Errorf("%w: %w", ErrorSession, err)
+	}
+	return nil
+}
+
+func (s *SessionService) restore(conn connect.ITCPConn, sessionid string) error {
+	data, err := s.sessions.Get(sessionid)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorSessionNotFound, err)
+	}
+	return conn.Attrs().Import(s.serializer, data)
+}
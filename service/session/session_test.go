@@ -0,0 +1,194 @@
+package session
+
+import (
+	"net"
+	"testing"
+
+	"github.com/chen102/ggbond/conn/connect"
+	"github.com/chen102/ggbond/conn/server"
+	"github.com/chen102/ggbond/conn/store"
+	"github.com/chen102/ggbond/service/hook"
+)
+
+type testServer struct {
+	*SessionService
+	connmanager server.ITCPConnManage
+	group       server.IConnGroupMagage
+}
+
+// 使用持久化存储创建会话服务，每次调用相当于一次重启
+func startTestServer(t *testing.T, persist *store.PersistStore, rooms ...*hook.Room) *testServer {
+	t.Helper()
+	connmanager := server.NewConnManage("tcp", store.NewTCPShardMap(8), connect.NopHook{})
+	group := server.NewConnGroup()
+	for _, room := range rooms {
+		if err := group.AddGroup(room); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewSessionService(connmanager, persist.Sessions, persist.Users, nil)
+	s.SetGroups(persist.Groups, group)
+	return &testServer{SessionService: s, connmanager: connmanager, group: group}
+}
+
+func (s *testServer) addConn(t *testing.T, connid int64) connect.ITCPConn {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	conn := connect.NewTCPConn(a, connid, "tcp")
+	if err := s.connmanager.AddConn(conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// 创建或恢复会话，返回会话ID
+func (s *testServer) resume(t *testing.T, conn connect.ITCPConn, sessionid string) string {
+	t.Helper()
+	if err := s.Resume()(1, conn.ConnID(), []byte(sessionid)); err != nil {
+		t.Fatal(err)
+	}
+	id, ok := conn.Attrs().GetString(SESSIONATTR)
+	if !ok || (sessionid != "" && id != sessionid) {
+		t.Fatalf("session %q, want %q", id, sessionid)
+	}
+	return id
+}
+
+// 与服务器关闭连接的顺序一致:移出管理器、退出分组、调用钩子
+func (s *testServer) closeConn(t *testing.T, conn connect.ITCPConn) {
+	t.Helper()
+	_ = s.connmanager.RemoveConn(conn, nil)
+	for _, g := range s.group.ConnGroups(conn.ConnID()) {
+		_ = s.group.RemoveConnFromGroup(g, conn.ConnID())
+	}
+	s.ConnHook().(connect.CloseHook).OnClose(conn, connect.CloseNormal, nil)
+}
+
+func inGroup(t *testing.T, group server.IConnGroupMagage, room *hook.Room, connid int64) bool {
+	t.Helper()
+	members, err := group.Group(room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok := members[connid]
+	return ok
+}
+
+func TestResumeRejoinsGroupsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	persist, err := store.OpenPersistStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := &hook.Room{RommID: 1, RoomName: "room"}
+	other := &hook.Room{RommID: 2, RoomName: "other"}
+	s := startTestServer(t, persist, room, other)
+	conn := s.addConn(t, 1)
+	sessionid := s.resume(t, conn, "")
+	if err := s.JoinGroup(conn.ConnID(), room); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.JoinGroup(conn.ConnID(), other); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LeaveGroup(conn.ConnID(), other); err != nil {
+		t.Fatal(err)
+	}
+	//断线重连，连接关闭时退出分组，恢复会话后重新加入
+	s.closeConn(t, conn)
+	if inGroup(t, s.group, room, 1) {
+		t.Fatal("closed conn still in group")
+	}
+	conn = s.addConn(t, 2)
+	s.resume(t, conn, sessionid)
+	if !inGroup(t, s.group, room, 2) || inGroup(t, s.group, other, 2) {
+		t.Fatal("resumed conn not rejoined to the joined groups only")
+	}
+	s.closeConn(t, conn)
+	if err := persist.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//重启后连接ID变化，按会话重新加入
+	persist, err = store.OpenPersistStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer persist.Close()
+	s = startTestServer(t, persist, room, other)
+	conn = s.addConn(t, 100)
+	s.resume(t, conn, sessionid)
+	if !inGroup(t, s.group, room, 100) || inGroup(t, s.group, other, 100) {
+		t.Fatal("group membership not restored after restart")
+	}
+	//分组移除时删除记录
+	if err := s.group.RemoveGroup(room); err != nil {
+		t.Fatal(err)
+	}
+	if persist.Groups.Exist(room.ID()) {
+		t.Fatal("removed group still persisted")
+	}
+}
+
+func TestResumeKicksLiveConn(t *testing.T) {
+	persist, err := store.OpenPersistStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer persist.Close()
+	room := &hook.Room{RommID: 1, RoomName: "room"}
+	s := startTestServer(t, persist, room)
+	old := s.addConn(t, 1)
+	sessionid := s.resume(t, old, "")
+	if err := s.JoinGroup(old.ConnID(), room); err != nil {
+		t.Fatal(err)
+	}
+	old.Attrs().Set("level", "3")
+
+	//旧连接未断开时在新连接上恢复会话，旧连接被踢下线，属性转到新连接
+	conn := s.addConn(t, 2)
+	s.resume(t, conn, sessionid)
+	select {
+	case err := <-old.WaitForClosed():
+		if ce := connect.AsCloseError(err); ce.Reason != connect.CloseKicked {
+			t.Fatalf("old conn close reason %s", ce.Reason)
+		}
+	default:
+		t.Fatal("old conn not kicked")
+	}
+	if level, _ := conn.Attrs().GetString("level"); level != "3" {
+		t.Fatalf("resumed level %q", level)
+	}
+	if !inGroup(t, s.group, room, 2) {
+		t.Fatal("resumed conn not rejoined")
+	}
+	if err := s.Bind(conn.ConnID(), "user"); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := s.UserConn("user"); err != nil || c.ConnID() != 2 {
+		t.Fatalf("user conn %v %v", c, err)
+	}
+
+	//旧连接随后关闭，不覆盖新连接的属性，会话仍在线
+	conn.Attrs().Set("level", "4")
+	if err := s.Save(conn.ConnID()); err != nil {
+		t.Fatal(err)
+	}
+	s.closeConn(t, old)
+	if c, err := s.UserConn("user"); err != nil || c.ConnID() != 2 {
+		t.Fatalf("user conn after old closed %v %v", c, err)
+	}
+	if !inGroup(t, s.group, room, 2) {
+		t.Fatal("resumed conn left group with the old conn")
+	}
+	s.closeConn(t, conn)
+	conn = s.addConn(t, 3)
+	s.resume(t, conn, sessionid)
+	if level, _ := conn.Attrs().GetString("level"); level != "4" {
+		t.Fatalf("level after old conn closed %q", level)
+	}
+}
@@ -0,0 +1,378 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chen102/ggbond/conn/logger"
+)
+
+const FILESTORE = "file"
+
+var ErrFileStore = errors.New("file store error")
+
+const (
+	snapshotfile = "snapshot.json"
+	logfile      = "append.log"
+)
+
+const (
+	opset = "set"
+	opdel = "del"
+)
+
+// 追加日志记录，每行一条json
+type record[K comparable, V any] struct {
+	Op    string `json:"op"`
+	Key   K      `json:"key"`
+	Value V      `json:"value,omitempty"`
+}
+
+// 快照文件内容
+type entry[K comparable, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+}
+
+// FileStoreOption 文件存储选项
+type FileStoreOption func(options *filestoreoptions) error
+type filestoreoptions struct {
+	snapshotInterval *time.Duration
+	snapshotRecords  *int
+	syncWrite        *bool
+}
+
+// snapshotInterval:定时快照周期，0表示不定时快照
+func WithSnapshotInterval(snapshotInterval time.Duration) FileStoreOption {
+	return func(options *filestoreoptions) error {
+		if snapshotInterval < 0 {
+			return errors.New("snapshotInterval is not valid")
+		}
+		options.snapshotInterval = &snapshotInterval
+		return nil
+	}
+}
+
+// snapshotRecords:追加日志达到该条数后自动快照，0表示不按条数快照
+func WithSnapshotRecords(snapshotRecords int) FileStoreOption {
+	return func(options *filestoreoptions) error {
+		if snapshotRecords < 0 {
+			return errors.New("snapshotRecords is not valid")
+		}
+		options.snapshotRecords = &snapshotRecords
+		return nil
+	}
+}
+
+// syncWrite:每次写入后fsync，牺牲性能换取掉电不丢数据
+func WithSyncWrite(syncWrite bool) FileStoreOption {
+	return func(options *filestoreoptions) error {
+		options.syncWrite = &syncWrite
+		return nil
+	}
+}
+
+// FileStore 文件存储
+// 数据常驻内存，写操作追加到日志文件，定期将全量数据写入快照并清空日志
+// 启动时加载快照并重放日志恢复数据
+type FileStore[K comparable, V any] struct {
+	mu               sync.RWMutex
+	m                map[K]V
+	dir              string
+	logf             *os.File
+	w                *bufio.Writer
+	records          int
+	snapshotRecords  int
+	syncWrite        bool
+	stop             chan struct{}
+	done             chan struct{}
+	snapshotInterval time.Duration
+	closeonce        sync.Once
+	closeerr         error
+}
+
+// OpenFileStore 打开文件存储，目录不存在时自动创建
+// dir:数据目录，每个存储独占一个目录
+func OpenFileStore[K comparable, V any](dir string, opt ...FileStoreOption) (*FileStore[K, V], error) {
+	var options filestoreoptions
+	for _, o := range opt {
+		if err := o(&options); err != nil {
+			return nil, fmt.Errorf("%w: apply option error:%w", ErrFileStore, err)
+		}
+	}
+	s := &FileStore[K, V]{
+		m:                make(map[K]V),
+		dir:              dir,
+		snapshotRecords:  10000,
+		snapshotInterval: time.Minute,
+	}
+	if options.snapshotRecords != nil {
+		s.snapshotRecords = *options.snapshotRecords
+	}
+	if options.snapshotInterval != nil {
+		s.snapshotInterval = *options.snapshotInterval
+	}
+	if options.syncWrite != nil {
+		s.syncWrite = *options.syncWrite
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if err := s.replay(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	logf, err := os.OpenFile(filepath.Join(dir, logfile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	s.logf = logf
+	s.w = bufio.NewWriter(logf)
+	if s.snapshotInterval > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.run()
+	}
+	return s, nil
+}
+
+func (s *FileStore[K, V]) Get(key K) (V, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res, ok := s.m[key]
+	if !ok {
+		var zero V
+		return zero, fmt.Errorf("%w:%v", ErrNotFound, key)
+	}
+	return res, nil
+}
+func (s *FileStore[K, V]) Set(key K, value V) (K, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(record[K, V]{Op: opset, Key: key, Value: value}); err != nil {
+		return key, err
+	}
+	s.m[key] = value
+	return key, s.compact()
+}
+func (s *FileStore[K, V]) SetNX(key K, value V) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.m[key]; ok {
+		return false, nil
+	}
+	if err := s.append(record[K, V]{Op: opset, Key: key, Value: value}); err != nil {
+		return false, err
+	}
+	s.m[key] = value
+	return true, s.compact()
+}
+func (s *FileStore[K, V]) Del(key K) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.m[key]; !ok {
+		return nil
+	}
+	if err := s.append(record[K, V]{Op: opdel, Key: key}); err != nil {
+		return err
+	}
+	delete(s.m, key)
+	return s.compact()
+}
+func (s *FileStore[K, V]) Exist(key K) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.m[key]
+	return ok
+}
+func (s *FileStore[K, V]) RangeStroe(f func(key K, value V) bool) {
+	s.mu.RLock()
+	snapshot := make([]entry[K, V], 0, len(s.m))
+	for k, v := range s.m {
+		snapshot = append(snapshot, entry[K, V]{k, v})
+	}
+	s.mu.RUnlock()
+	for _, e := range snapshot {
+		if !f(e.Key, e.Value) {
+			return
+		}
+	}
+}
+func (s *FileStore[K, V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.m)
+}
+
+// Snapshot 立即写入快照并清空追加日志
+func (s *FileStore[K, V]) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+// Close 写入快照并关闭文件，重复调用返回第一次的结果
+func (s *FileStore[K, V]) Close() error {
+	s.closeonce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+			<-s.done
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.snapshot(); err != nil {
+			s.closeerr = err
+			return
+		}
+		s.closeerr = s.logf.Close()
+	})
+	return s.closeerr
+}
+
+func (s *FileStore[K, V]) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				logger.L().Error("file store snapshot error", "error", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *FileStore[K, V]) append(r record[K, V]) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if s.syncWrite {
+		if err := s.logf.Sync(); err != nil {
+			return fmt.Errorf("%w: %w", ErrFileStore, err)
+		}
+	}
+	s.records++
+	return nil
+}
+
+// 日志条数达到阈值时快照
+func (s *FileStore[K, V]) compact() error {
+	if s.snapshotRecords > 0 && s.records >= s.snapshotRecords {
+		return s.snapshot()
+	}
+	return nil
+}
+
+// 先写临时文件再重命名，保证快照文件始终完整
+func (s *FileStore[K, V]) snapshot() error {
+	entries := make([]entry[K, V], 0, len(s.m))
+	for k, v := range s.m {
+		entries = append(entries, entry[K, V]{k, v})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	tmp := filepath.Join(s.dir, snapshotfile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotfile)); err != nil {
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	if err := s.logf.Truncate(0); err != nil {
+		return fmt.Errorf("%w: %w", ErrFileStore, err)
+	}
+	s.records = 0
+	return nil
+}
+
+func (s *FileStore[K, V]) load() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotfile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []entry[K, V]
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("load snapshot:%w", err)
+	}
+	for _, e := range entries {
+		s.m[e.Key] = e.Value
+	}
+	return nil
+}
+
+// 重放追加日志，最后一行不完整(写入时崩溃)时忽略并截断
+// 不截断时之后追加的记录会接在残缺行后面，下次启动无法解析
+func (s *FileStore[K, V]) replay() error {
+	path := filepath.Join(s.dir, logfile)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	var offset int64 //最后一个完整行之后的位置
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				logger.L().Warn("file store truncate torn log record", "path", path, "offset", offset, "bytes", len(line))
+				return os.Truncate(path, offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		var r record[K, V]
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("replay log:%w", err)
+		}
+		switch r.Op {
+		case opset:
+			s.m[r.Key] = r.Value
+		case opdel:
+			delete(s.m, r.Key)
+		}
+		s.records++
+	}
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestFileStore(t *testing.T, dir string) *FileStore[string, int] {
+	t.Helper()
+	//不定时快照，数据只在追加日志中
+	s, err := OpenFileStore[string, int](dir, WithSnapshotInterval(0), WithSnapshotRecords(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func expectValues(t *testing.T, s *FileStore[string, int], want map[string]int) {
+	t.Helper()
+	if s.Len() != len(want) {
+		t.Fatalf("len %d, want %d", s.Len(), len(want))
+	}
+	for k, v := range want {
+		if got, err := s.Get(k); err != nil || got != v {
+			t.Fatalf("%s = %d, %v, want %d", k, got, err, v)
+		}
+	}
+}
+
+func TestFileStoreReplayWithoutClose(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	for i, k := range []string{"a", "b", "c"} {
+		if _, err := s.Set(k, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Set("a", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Del("b"); err != nil {
+		t.Fatal(err)
+	}
+	//模拟进程崩溃:不调用Close，不写快照
+	s.logf.Close()
+	if _, err := os.Stat(filepath.Join(dir, snapshotfile)); !os.IsNotExist(err) {
+		t.Fatalf("snapshot written before close: %v", err)
+	}
+
+	s = openTestFileStore(t, dir)
+	expectValues(t, s, map[string]int{"a": 10, "c": 2})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileStoreTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	if _, err := s.Set("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	s.logf.Close()
+	//写入时崩溃，最后一行只写了一半
+	path := filepath.Join(dir, logfile)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"op":"set","key":"b","val`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s = openTestFileStore(t, dir)
+	expectValues(t, s, map[string]int{"a": 1})
+	//残缺行已截断，之后追加的记录从新的一行开始
+	if _, err := s.Set("c", 3); err != nil {
+		t.Fatal(err)
+	}
+	s.logf.Close()
+
+	s = openTestFileStore(t, dir)
+	defer s.Close()
+	expectValues(t, s, map[string]int{"a": 1, "c": 3})
+}
+
+func TestFileStoreCloseTwice(t *testing.T) {
+	s, err := OpenFileStore[string, int](t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const SHARDMAPSTORE = "shardmap"
+
+// ShardMapStore 分片map存储
+// 按key的hash分为N个分片，每个分片独立加锁，适合大量连接频繁增删
+type ShardMapStore[K Integer, V any] struct {
+	shards []*shard[K, V]
+	mask   uint64
+	n      int64
+}
+
+type shard[K Integer, V any] struct {
+	sync.RWMutex
+	m map[K]V
+}
+
+// NewShardMap 创建分片存储
+// shardnum:分片数，向上取整为2的幂
+func NewShardMap[K Integer, V any](shardnum int) *ShardMapStore[K, V] {
+	if shardnum <= 0 {
+		panic("shardnum is not valid")
+	}
+	size := 1
+	for size < shardnum {
+		size <<= 1
+	}
+	s := &ShardMapStore[K, V]{
+		shards: make([]*shard[K, V], size),
+		mask:   uint64(size - 1),
+	}
+	for i := range s.shards {
+		s.shards[i] = &shard[K, V]{m: make(map[K]V)}
+	}
+	return s
+}
+
+// murmur3 fmix64，连接ID分布不均时也能打散到各分片
+func (s *ShardMapStore[K, V]) shard(key K) *shard[K, V] {
+	h := uint64(key)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return s.shards[h&s.mask]
+}
+
+func (s *ShardMapStore[K, V]) Get(key K) (V, error) {
+	sh := s.shard(key)
+	sh.RLock()
+	res, ok := sh.m[key]
+	sh.RUnlock()
+	if !ok {
+		var zero V
+		return zero, fmt.Errorf("%w:%d", ErrNotFound, key)
+	}
+	return res, nil
+}
+func (s *ShardMapStore[K, V]) Set(key K, value V) (K, error) {
+	sh := s.shard(key)
+	sh.Lock()
+	if _, ok := sh.m[key]; !ok {
+		atomic.AddInt64(&s.n, 1)
+	}
+	sh.m[key] = value
+	sh.Unlock()
+	return key, nil
+}
+func (s *ShardMapStore[K, V]) SetNX(key K, value V) (bool, error) {
+	sh := s.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+	if _, ok := sh.m[key]; ok {
+		return false, nil
+	}
+	sh.m[key] = value
+	atomic.AddInt64(&s.n, 1)
+	return true, nil
+}
+func (s *ShardMapStore[K, V]) Del(key K) error {
+	sh := s.shard(key)
+	sh.Lock()
+	if _, ok := sh.m[key]; ok {
+		delete(sh.m, key)
+		atomic.AddInt64(&s.n, -1)
+	}
+	sh.Unlock()
+	return nil
+}
+func (s *ShardMapStore[K, V]) Exist(key K) bool {
+	sh := s.shard(key)
+	sh.RLock()
+	_, ok := sh.m[key]
+	sh.RUnlock()
+	return ok
+}
+
+// RangeStroe 遍历所有分片
+// 遍历时复制分片快照，回调中可以安全地增删
+func (s *ShardMapStore[K, V]) RangeStroe(f func(key K, value V) bool) {
+	for _, sh := range s.shards {
+		sh.RLock()
+		keys := make([]K, 0, len(sh.m))
+		values := make([]V, 0, len(sh.m))
+		for k, v := range sh.m {
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+		sh.RUnlock()
+		for i := range keys {
+			if !f(keys[i], values[i]) {
+				return
+			}
+		}
+	}
+}
+func (s *ShardMapStore[K, V]) Len() int {
+	return int(atomic.LoadInt64(&s.n))
+}
@@ -0,0 +1,18 @@
+package store
+
+// Store 键值存储
+// K:键类型 V:值类型，类型不匹配的存储在编译期即报错
+type Store[K comparable, V any] interface {
+	Get(key K) (V, error)
+	Set(key K, value V) (K, error)
+	SetNX(key K, value V) (bool, error) //键不存在时写入，返回是否写入
+	Del(key K) error
+	Exist(key K) bool
+	RangeStroe(f func(key K, value V) bool)
+	Len() int
+}
+
+// Integer 可分片的整数键
+type Integer interface {
+	~int | ~int32 | ~int64 | ~uint32 | ~uint64
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+const benchKeys = 1 << 16
+
+// 连接表的典型负载:读多写少，连接建立、断开时写
+func benchmarkGet(b *testing.B, s Store[int64, int]) {
+	for i := int64(0); i < benchKeys; i++ {
+		_, _ = s.Set(i, int(i))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			_, _ = s.Get(r.Int63n(benchKeys))
+		}
+	})
+}
+
+func benchmarkSetDel(b *testing.B, s Store[int64, int]) {
+	var next int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := atomic.AddInt64(&next, 1)
+			_, _ = s.SetNX(key, 0)
+			_ = s.Del(key)
+		}
+	})
+}
+
+// 每10次操作中1次写入、删除，其余读取
+func benchmarkMixed(b *testing.B, s Store[int64, int]) {
+	for i := int64(0); i < benchKeys; i++ {
+		_, _ = s.Set(i, int(i))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		for i := 0; pb.Next(); i++ {
+			key := r.Int63n(benchKeys)
+			if i%10 == 0 {
+				_ = s.Del(key)
+				_, _ = s.Set(key, int(key))
+				continue
+			}
+			_, _ = s.Get(key)
+		}
+	})
+}
+
+func benchmarkLen(b *testing.B, s Store[int64, int]) {
+	for i := int64(0); i < benchKeys; i++ {
+		_, _ = s.Set(i, int(i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = s.Len()
+	}
+}
+
+func BenchmarkShardMapGet(b *testing.B)    { benchmarkGet(b, NewShardMap[int64, int](64)) }
+func BenchmarkSyncMapGet(b *testing.B)     { benchmarkGet(b, NewSyncMap[int64, int]()) }
+func BenchmarkShardMapSetDel(b *testing.B) { benchmarkSetDel(b, NewShardMap[int64, int](64)) }
+func BenchmarkSyncMapSetDel(b *testing.B)  { benchmarkSetDel(b, NewSyncMap[int64, int]()) }
+func BenchmarkShardMapMixed(b *testing.B)  { benchmarkMixed(b, NewShardMap[int64, int](64)) }
+func BenchmarkSyncMapMixed(b *testing.B)   { benchmarkMixed(b, NewSyncMap[int64, int]()) }
+func BenchmarkShardMapLen(b *testing.B)    { benchmarkLen(b, NewShardMap[int64, int](64)) }
+func BenchmarkSyncMapLen(b *testing.B)     { benchmarkLen(b, NewSyncMap[int64, int]()) }
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// 各存储实现共用的正确性测试
+func testStoreBasic(t *testing.T, s Store[int64, string]) {
+	if _, err := s.Get(1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get missing key: %v", err)
+	}
+	if _, err := s.Set(1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Set(1, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get(1); err != nil || v != "b" {
+		t.Fatalf("get after overwrite: %q %v", v, err)
+	}
+	if s.Len() != 1 {
+		t.Fatalf("len after overwrite %d", s.Len())
+	}
+	if ok, err := s.SetNX(1, "c"); err != nil || ok {
+		t.Fatalf("setnx existing key: %v %v", ok, err)
+	}
+	if ok, err := s.SetNX(2, "c"); err != nil || !ok {
+		t.Fatalf("setnx new key: %v %v", ok, err)
+	}
+	if !s.Exist(2) || s.Len() != 2 {
+		t.Fatalf("exist %v len %d", s.Exist(2), s.Len())
+	}
+	if err := s.Del(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Del(1); err != nil {
+		t.Fatal(err)
+	}
+	if s.Exist(1) || s.Len() != 1 {
+		t.Fatalf("after del exist %v len %d", s.Exist(1), s.Len())
+	}
+
+	for i := int64(10); i < 20; i++ {
+		if _, err := s.Set(i, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keys []int64
+	s.RangeStroe(func(key int64, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	if len(keys) != 11 || keys[0] != 2 || keys[10] != 19 {
+		t.Fatalf("range keys %v", keys)
+	}
+	n := 0
+	s.RangeStroe(func(key int64, value string) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Fatalf("range did not stop, visited %d", n)
+	}
+	//遍历中删除
+	s.RangeStroe(func(key int64, value string) bool {
+		_ = s.Del(key)
+		return true
+	})
+	if s.Len() != 0 {
+		t.Fatalf("len after deleting in range %d", s.Len())
+	}
+}
+
+// 并发覆盖写与删除后计数与实际元素数一致
+func testStoreConcurrentLen(t *testing.T, s Store[int64, string]) {
+	const keys, workers, rounds = 16, 8, 1000
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				key := int64((w + i) % keys)
+				if (w+i)%2 == 0 {
+					_, _ = s.Set(key, "v")
+				} else {
+					_ = s.Del(key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	n := 0
+	s.RangeStroe(func(key int64, value string) bool {
+		n++
+		return true
+	})
+	if s.Len() != n {
+		t.Fatalf("len %d, actual %d", s.Len(), n)
+	}
+}
+
+func TestSyncMap(t *testing.T) {
+	testStoreBasic(t, NewSyncMap[int64, string]())
+	for i := 0; i < 20; i++ {
+		testStoreConcurrentLen(t, NewSyncMap[int64, string]())
+	}
+}
+
+func TestShardMap(t *testing.T) {
+	for _, n := range []int{1, 3, 16} {
+		testStoreBasic(t, NewShardMap[int64, string](n))
+		testStoreConcurrentLen(t, NewShardMap[int64, string](n))
+	}
+}
+
+func TestShardMapSize(t *testing.T) {
+	for _, c := range []struct{ n, want int }{{1, 1}, {3, 4}, {16, 16}, {17, 32}} {
+		if got := len(NewShardMap[int64, int](c.n).shards); got != c.want {
+			t.Fatalf("NewShardMap(%d) has %d shards, want %d", c.n, got, c.want)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("zero shards did not panic")
+		}
+	}()
+	NewShardMap[int64, int](0)
+}
@@ -4,38 +4,58 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
 const SYNCMAPSTORE = "syncmap"
 
 var ErrNotFound = errors.New("syncmap store:not found")
 
-type SyncMapStore struct {
-	sync.Map
+type SyncMapStore[K comparable, V any] struct {
+	m sync.Map
+	n int64
 }
 
-func NewSyncMap() *SyncMapStore {
-	return &SyncMapStore{}
+func NewSyncMap[K comparable, V any]() *SyncMapStore[K, V] {
+	return &SyncMapStore[K, V]{}
 }
-func (s *SyncMapStore) Get(key int32) (interface{}, error) {
-	res, ok := s.Load(key)
+func (s *SyncMapStore[K, V]) Get(key K) (V, error) {
+	res, ok := s.m.Load(key)
 	if !ok {
-		return nil, fmt.Errorf("%w:%d", ErrNotFound, key)
+		var zero V
+		return zero, fmt.Errorf("%w:%v", ErrNotFound, key)
 	}
-	return res, nil
+	return res.(V), nil
 }
-func (s *SyncMapStore) Set(key int32, value interface{}) (int32, error) {
-	s.Store(key, value)
+func (s *SyncMapStore[K, V]) Set(key K, value V) (K, error) {
+	//Swap一次完成覆盖与判断，与Del并发时计数不会漂移
+	if _, loaded := s.m.Swap(key, value); !loaded {
+		atomic.AddInt64(&s.n, 1)
+	}
 	return key, nil
 }
-func (s *SyncMapStore) Del(key int32) error {
-	s.Delete(key)
+func (s *SyncMapStore[K, V]) SetNX(key K, value V) (bool, error) {
+	if _, loaded := s.m.LoadOrStore(key, value); loaded {
+		return false, nil
+	}
+	atomic.AddInt64(&s.n, 1)
+	return true, nil
+}
+func (s *SyncMapStore[K, V]) Del(key K) error {
+	if _, loaded := s.m.LoadAndDelete(key); loaded {
+		atomic.AddInt64(&s.n, -1)
+	}
 	return nil
 }
-func (s *SyncMapStore) Exist(key int32) bool {
-	_, ok := s.Load(key)
+func (s *SyncMapStore[K, V]) Exist(key K) bool {
+	_, ok := s.m.Load(key)
 	return ok
 }
-func (s *SyncMapStore) RangeStroe(f func(key, value interface{}) bool) {
-	s.Range(f)
+func (s *SyncMapStore[K, V]) RangeStroe(f func(key K, value V) bool) {
+	s.m.Range(func(key, value interface{}) bool {
+		return f(key.(K), value.(V))
+	})
+}
+func (s *SyncMapStore[K, V]) Len() int {
+	return int(atomic.LoadInt64(&s.n))
 }